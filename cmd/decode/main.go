@@ -0,0 +1,121 @@
+// Command decode prints the Kafka requests of hex-encoded frames, to reproduce decoding
+// issues without capturing traffic:
+//
+//	echo 0000001900030001000000070003636c69000000010006 6f7264657273 | go run cmd/decode/main.go
+//
+// Frames (size, header and body) may be concatenated. Whitespace is ignored, as are
+// lines starting with '#'.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+)
+
+var (
+	input = flag.String("f", "", "File to read frames from, stdin if empty")
+	raw   = flag.Bool("raw", false, "Read binary frames instead of hex, e.g. a TCP payload dump")
+)
+
+// topicsExtractor is implemented by request bodies carrying topics
+type topicsExtractor interface {
+	ExtractTopics() []string
+}
+
+func main() {
+	flag.Parse()
+
+	src := io.Reader(os.Stdin)
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.Fatalf("could not open %s: %v", *input, err)
+		}
+		defer f.Close()
+		src = f
+	}
+
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		log.Fatalf("could not read frames: %v", err)
+	}
+
+	if !*raw {
+		if data, err = decodeHex(data); err != nil {
+			log.Fatalf("could not decode hex: %v", err)
+		}
+	}
+
+	if !printRequests(bufio.NewReader(bytes.NewReader(data))) {
+		os.Exit(1)
+	}
+}
+
+// decodeHex decodes hex text, skipping whitespace and comment lines
+func decodeHex(text []byte) ([]byte, error) {
+	var digits strings.Builder
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		digits.WriteString(strings.Join(strings.Fields(line), ""))
+	}
+	return hex.DecodeString(digits.String())
+}
+
+// printRequests decodes and prints requests until the end of r, it returns false if any
+// frame couldn't be decoded
+func printRequests(r *bufio.Reader) bool {
+	ok := true
+	for i := 1; ; i++ {
+		req, readBytes, err := kafka.DecodeRequest(r)
+		if err == io.EOF {
+			return ok
+		}
+		if err == io.ErrUnexpectedEOF {
+			fmt.Printf("#%d: truncated frame\n", i)
+			return false
+		}
+		if err != nil {
+			ok = false
+			fmt.Printf("#%d: %v\n", i, err)
+			e, isDecodingErr := err.(kafka.PacketDecodingError)
+			if !isDecodingErr {
+				return false
+			}
+			// skip the rest of the frame like the sniffer does
+			_, _ = r.Discard(kafka.UnreadBytes(e, readBytes))
+			continue
+		}
+
+		printRequest(i, req)
+	}
+}
+
+func printRequest(i int, req *kafka.Request) {
+	fmt.Printf("#%d: key=%d version=%d correlation_id=%d client_id=%q body=%T\n",
+		i, req.Key, req.Version, req.CorrelationID, req.ClientID, req.Body)
+
+	if extractor, ok := req.Body.(topicsExtractor); ok {
+		fmt.Printf("topics: %s\n", strings.Join(extractor.ExtractTopics(), ", "))
+	}
+
+	body, err := json.MarshalIndent(req.Body, "", "  ")
+	if err != nil {
+		fmt.Printf("%+v\n", req.Body)
+		return
+	}
+	fmt.Println(string(body))
+}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Shopify/sarama"
+
+	"github.com/d-ulyanov/kafka-sniffer/events"
 )
 
 var (
@@ -64,8 +68,20 @@ func main() {
 	}()
 
 	t := time.NewTicker(time.Duration(*sendInterval) * time.Second)
+	defer t.Stop()
+
+	// Return on SIGINT/SIGTERM so that the producer is closed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case sig := <-signals:
+			log.Printf("received %s, closing producer", sig)
+			return
+		case <-t.C:
+		}
 
-	for range t.C {
 		// Create messages for all configured topics
 		messages := make([]*sarama.ProducerMessage, 0, len(topicList))
 		for _, topic := range topicList {
@@ -116,19 +132,8 @@ func newDataCollector(brokerList []string) (sarama.SyncProducer, error) {
 	
 	// Configure SASL if enabled
 	if *useSASL {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = *saslUsername
-		config.Net.SASL.Password = *saslPassword
-		
-		switch *saslMechanism {
-		case "PLAIN":
-			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
-		case "SCRAM-SHA-256":
-			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
-		case "SCRAM-SHA-512":
-			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		default:
-			log.Fatalf("Unsupported SASL mechanism: %s", *saslMechanism)
+		if err := events.ConfigureSASL(config, *saslMechanism, *saslUsername, *saslPassword); err != nil {
+			log.Fatal(err)
 		}
 	}
 
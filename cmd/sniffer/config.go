@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// unconfigurableFlags can't be set in the config file: the file itself, and the CPU profile
+// started before the file is read
+var unconfigurableFlags = map[string]bool{"config": true, "cpuprofile": true}
+
+// loadConfig sets the flags from the JSON object of the given file, whose keys are the flag
+// names, e.g. {"interfaces": "eth0,eth1", "latency": true, "stream-idle-timeout": "5m"}.
+// Flags given on the command line keep their value. Unknown keys are rejected all at once.
+func loadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config: %v", err)
+	}
+
+	var values map[string]json.RawMessage
+	if err = json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("could not parse config %s: %v", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	var unknown []string
+	for name := range values {
+		if flag.Lookup(name) == nil || unconfigurableFlags[name] {
+			unknown = append(unknown, name)
+		}
+		names = append(names, name)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in config %s: %s, the keys are the flag names listed by -h",
+			path, strings.Join(unknown, ", "))
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	sort.Strings(names)
+	for _, name := range names {
+		if explicit[name] {
+			continue
+		}
+		value, err := configValue(values[name])
+		if err != nil {
+			return fmt.Errorf("invalid value of %s in config %s: %v", name, path, err)
+		}
+		if err = flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value of %s in config %s: %v", name, path, err)
+		}
+	}
+	return nil
+}
+
+// configValue returns the flag value of a JSON value. Strings are taken as is, numbers and
+// booleans as written, and arrays of strings are joined with commas for the comma-separated
+// flags.
+func configValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", fmt.Errorf("empty value")
+	}
+
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '[':
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return "", fmt.Errorf("arrays must hold strings")
+		}
+		return strings.Join(list, ","), nil
+	case '{':
+		return "", fmt.Errorf("objects aren't supported")
+	case 'n':
+		return "", fmt.Errorf("null isn't supported, remove the key to keep the default")
+	default:
+		// numbers and booleans
+		return string(raw), nil
+	}
+}
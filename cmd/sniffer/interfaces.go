@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// findInterfaces returns the capture devices, in the order of -list-interfaces
+func findInterfaces() ([]pcap.Interface, error) {
+	if err := loadPcap(); err != nil {
+		return nil, err
+	}
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return nil, fmt.Errorf("could not list interfaces: %v", err)
+	}
+	return devices, nil
+}
+
+// printInterfaces writes the capture devices with their index, description and addresses.
+// On Windows the names look like \Device\NPF_{GUID}, the index is easier to pass to -i.
+func printInterfaces(w io.Writer, devices []pcap.Interface) {
+	for i, device := range devices {
+		fmt.Fprintf(w, "%d. %s", i+1, device.Name)
+		if device.Description != "" {
+			fmt.Fprintf(w, " (%s)", device.Description)
+		}
+		fmt.Fprintln(w)
+
+		addresses := make([]string, 0, len(device.Addresses))
+		for _, address := range device.Addresses {
+			if address.Netmask != nil {
+				addresses = append(addresses, (&net.IPNet{IP: address.IP, Mask: address.Netmask}).String())
+			} else {
+				addresses = append(addresses, address.IP.String())
+			}
+		}
+		if len(addresses) > 0 {
+			fmt.Fprintf(w, "   %s\n", strings.Join(addresses, ", "))
+		}
+	}
+}
+
+// resolveInterfaces replaces the indexes of -list-interfaces by device names, names are kept
+// as is. Devices are only listed when an index is given.
+func resolveInterfaces(names []string) ([]string, error) {
+	var devices []pcap.Interface
+	resolved := make([]string, len(names))
+	for i, name := range names {
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			resolved[i] = name
+			continue
+		}
+
+		if devices == nil {
+			if devices, err = findInterfaces(); err != nil {
+				return nil, err
+			}
+		}
+		if device, ok := deviceNamed(devices, name); ok {
+			// a device named like a number, e.g. on some BSDs
+			resolved[i] = device.Name
+			continue
+		}
+		if index < 1 || index > len(devices) {
+			return nil, fmt.Errorf("no interface %d, see -list-interfaces for the %d interfaces", index, len(devices))
+		}
+		resolved[i] = devices[index-1].Name
+	}
+	return resolved, nil
+}
+
+// deviceNamed returns the device of the given name
+func deviceNamed(devices []pcap.Interface, name string) (pcap.Interface, bool) {
+	for _, device := range devices {
+		if device.Name == name {
+			return device, true
+		}
+	}
+	return pcap.Interface{}, false
+}
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/d-ulyanov/kafka-sniffer/events"
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 	"github.com/d-ulyanov/kafka-sniffer/stream"
 
@@ -20,92 +34,787 @@ import (
 )
 
 const (
-	defaultListenAddr = ":9870"
+	defaultListenAddr = ":2112"
+
+	// unixListenPrefix selects a Unix socket as the metrics server address
+	unixListenPrefix  = "unix:"
 	defaultExpireTime = 5 * time.Minute
+
+	// shutdownTimeout bounds the time spent draining streams and stopping the metrics server
+	shutdownTimeout = 10 * time.Second
+
+	// cleanupInterval is the interval between cleanups of the state of inactive clients
+	cleanupInterval = time.Minute
 )
 
 var (
-	iface      = flag.String("i", "eth0", "Interface to get packets from")
-	dstport    = flag.Uint("p", 9092, "Kafka broker port")
-	snaplen    = flag.Int("s", 16<<10, "SnapLen for pcap packet capture")
-	filter     = fmt.Sprintf("tcp and dst port %d", *dstport)
-	verbose    = flag.Bool("v", false, "Logs every packet in great detail")
-	listenAddr = flag.String("addr", defaultListenAddr, "Address on which sniffer listen the requests")
-	expireTime = flag.Duration("metrics.expire-time", defaultExpireTime, "Expiration time of metric.")
+	configFile      = flag.String("config", "", "JSON file of flag values, keyed by flag name. Flags given on the command line override it")
+	iface           = flag.String("i", "eth0", "Interface to get packets from, by name or by index of -list-interfaces")
+	ifaces          = flag.String("interfaces", "", "Comma-separated interfaces to get packets from, by name or by index of -list-interfaces, overriding -i")
+	listIfaces      = flag.Bool("list-interfaces", false, "List the interfaces packets can be captured from, with their index, description and addresses, and exit")
+	bpf             = flag.String("bpf", "", "BPF filter of captured packets, by default the TCP traffic to the broker ports (both directions with -latency)")
+	dstport         = flag.Uint("p", 9092, "Kafka broker port, added to -broker-ports when set")
+	brokerPorts     = flag.String("broker-ports", "9092,9093", "Comma-separated Kafka broker ports, telling requests from responses. When neither port of a connection is listed, the lower one is assumed to be the broker's")
+	detectPorts     = flag.Int("detect-broker-ports", 0, "Detect up to N broker ports missing from -broker-ports, from connections starting with two valid Kafka requests. All the TCP traffic is then captured, unless -bpf is set. 0 disables the detection")
+	snaplen         = flag.Int("s", 16<<10, "SnapLen for pcap packet capture")
+	vlanID          = flag.Int("vlan", -1, "Only capture the packets of this VLAN ID, the outer 802.1Q tag of QinQ frames. Untagged and tagged packets are captured when -1")
+	verbose         = flag.Bool("v", false, "Logs every packet in great detail")
+	listenAddr      = flag.String("addr", defaultListenAddr, "Deprecated, use -metrics-listen")
+	metricsListen   = flag.String("metrics-listen", defaultListenAddr, "Address of the metrics server, host:port or unix:/path/to/socket")
+	readyPacketAge  = flag.Duration("ready-max-packet-age", time.Minute, "/readyz fails when no packet was captured for this long")
+	expireTime      = flag.Duration("metrics.expire-time", defaultExpireTime, "Expiration time of metric.")
+	relationsExpire = flag.Duration("metrics.expire-time.relations", 0, "Expiration time of topic, group, member assignment and transactional id relation metrics, -metrics.expire-time when 0")
+	connsExpire     = flag.Duration("metrics.expire-time.connections", 0, "Expiration time of active connection metrics, -metrics.expire-time when 0")
+	clientsExpire   = flag.Duration("metrics.expire-time.clients", 0, "Expiration time of client setting metrics (partitions, acks, produce timeouts, fetch settings, software), -metrics.expire-time when 0")
+	udsPath         = flag.String("uds-path", "", "Read framed Kafka requests from a Unix socket, file or pipe instead of capturing packets")
+	appFromClientID = flag.String("app-from-clientid", "", "Regexp deriving the application label of relation metrics from ClientID, e.g. 'app-(\\w+)-.*'")
+	webhookURL      = flag.String("webhook-url", "", "POST high-value events as JSON to this URL")
+	webhookEvents   = flag.String("webhook-events", strings.Join([]string{events.AuthAnomaly, events.AclChange, events.TopicDeletion, events.PlaintextCredentials}, ","),
+		"Comma-separated list of event types sent to the webhook")
+	outputBrokers      = flag.String("output-brokers", "", "Comma-separated brokers to produce events to as JSON records, with -output-topic")
+	outputTopic        = flag.String("output-topic", "", "Topic to produce events to, with -output-brokers")
+	outputEvents       = flag.String("output-events", "", "Comma-separated list of event types produced to -output-topic, all of them when empty")
+	outputSaslMech     = flag.String("output-sasl-mechanism", "", "SASL mechanism (PLAIN, SCRAM-SHA-256, SCRAM-SHA-512) of the output brokers, no SASL when empty")
+	outputSaslUser     = flag.String("output-sasl-username", "", "SASL username of the output brokers")
+	outputSaslPassword = flag.String("output-sasl-password", "", "SASL password of the output brokers")
+	outputBufferSize   = flag.Int("output-buffer-size", 4096, "Number of events buffered in memory for -output-topic while the output brokers are slow or unavailable")
+	outputOverflow     = flag.String("output-buffer-overflow", events.OverflowDropOldest, "What to do when the -output-topic buffer is full: drop-oldest (counted in kafka_sniffer_emit_sink_dropped_total) or block the capture")
+	saslPorts          = flag.String("sasl-ports", "", "Comma-separated broker ports of SASL listeners, data requests on them without authentication are reported")
+	quiet              = flag.Bool("quiet", false, "Only log audit and security events, routine produce/fetch and connection logs are suppressed")
+	pcapFile           = flag.String("pcap", "", "Replay a .pcap/.pcapng capture file instead of capturing live traffic, exit at its end")
+	captureConfigVals  = flag.Bool("capture-config-values", false, "Log the values of configs altered by AlterConfigs requests, they may be secrets and are redacted by default")
+	saslStrict         = flag.Bool("sasl-strict", false, "Only accept usernames parsed from PLAIN and SCRAM messages, never guess them from other authentication data")
+	detectRawSasl      = flag.Bool("detect-raw-sasl", true, "Look for raw SASL/PLAIN tokens sent after a SaslHandshake without a SaslAuthenticate")
+	latency            = flag.Bool("latency", false, "Also capture broker responses and measure request latency by matching correlation ids")
+	topicInclude       = flag.String("topic-include", "", "Comma-separated topic globs or /regexps/, only matching topics are tracked in relation metrics and the summary log")
+	topicExclude       = flag.String("topic-exclude", "", "Comma-separated topic globs or /regexps/ never tracked in relation metrics and the summary log")
+	maxRequestSize     = flag.Int("max-request-size", 100*1024*1024, "Maximum size in bytes of a request, larger ones are rejected. Each connection may buffer a request of up to this size")
+	invalidLengthWarn  = flag.Int("invalid-length-threshold", stream.DefaultInvalidLengthThreshold, "Report a client once it sent this many messages of invalid size, a malformed client or a probe, and again every as many. 0 disables the report")
+	userMap            = flag.String("user-map", "", "CSV file mapping SASL usernames to the names shown in the user metrics, with a header: username,display, then extra labels of auth_user_activity")
+	anonymizeIPs       = flag.Bool("anonymize-ips", false, "Replace client IPs in metrics, logs and events with a keyed hash, the same IP always getting the same hash")
+	anonymizeKey       = flag.String("anonymize-key", "", "Key of the -anonymize-ips hash, also read from the SNIFFER_ANONYMIZE_KEY environment variable. A random key is used when empty, hashes then change on restart")
+	labelIncludePort   = flag.Bool("label-include-port", false, "Label the active connections, connection bytes and request count metrics with the client ip:port instead of the ip, a series per connection. Raises the metrics cardinality")
+	csvExportDir       = flag.String("csv-export-dir", "", "Directory to write CSV snapshots of the client relationships to, every -csv-export-interval. Disabled when empty")
+	csvExportInterval  = flag.Duration("csv-export-interval", 15*time.Minute, "Interval of the CSV snapshots of -csv-export-dir")
+	recentRequestsSize = flag.Int("recent-requests", 0, "Keep the last N decoded requests in memory and serve them as JSON at /recent, disabled when 0")
+	flushInterval      = flag.Duration("assembler-flush-interval", time.Minute, "Interval of the flushes of the TCP assembler, releasing the out-of-order segments of stalled connections. 0 disables the flushes, memory then grows under packet loss")
+	maxPages           = flag.Int("assembler-max-pages", 1000, "Maximum number of out-of-order pages (about 1900 bytes each) buffered by the TCP assembler, connections are flushed as their packets come once it's reached, 0 is unlimited")
+	maxConnPages       = flag.Int("assembler-max-pages-per-connection", 1, "Maximum number of out-of-order pages buffered for a connection, the oldest is pushed past its gap once it's reached. 1 gives up on a lost segment at the next packet, 0 is unlimited")
+	flushMaxAge        = flag.Duration("assembler-max-age", 2*time.Minute, "Age after which out-of-order segments waiting for a missing one are pushed past the gap, and idle connections are closed, by the assembler flushes")
+	streamIdleTimeout  = flag.Duration("stream-idle-timeout", 15*time.Minute, "Stop decoding a connection which sent no data for this long, e.g. a half-open one, releasing its buffer. Keep it above the brokers' connections.max.idle.ms, 0 disables it")
+	streamBufferSize   = flag.Int("stream-buffer-size", stream.DefaultBufferSize, "Read buffer size in bytes of each captured connection, memory use grows with size * concurrent connections")
+	decodeWorkers      = flag.Int("decode-workers", 0, "Maximum number of connections decoding requests at once, capping CPU under connection storms. 0 decodes every connection as its data arrives")
+	decodeQueueBytes   = flag.Int("decode-queue-bytes", stream.DefaultDecodeQueueBytes, "Bytes queued for each connection waiting for a -decode-workers worker, a connection whose queue overflows is no longer decoded")
+	captureHeaders     = flag.String("capture-headers", "", "Comma-separated record header keys logged for produced records, * for all. Header keys are counted when set")
+	logProduceKeys     = flag.Bool("log-produce-keys", false, "Log the keys of produced records to the topics passing the topic filter, never their values. Off by default as keys may be personal data")
+	produceKeyMaxLen   = flag.Int("produce-key-max-length", stream.DefaultProduceKeyMaxLength, "Bytes of each key logged by -log-produce-keys, longer keys are truncated and binary ones hex encoded")
+	summaryLog         = flag.String("summary-log", kafka.DefaultSummaryLogPath, "Summary log file of authentications and topic activity, disabled when empty")
+	summaryOutput      = flag.String("summary-output", "", "Summary log destination overriding -summary-log: file:///path, stdout, syslog://host:514 (UDP), syslog+tcp://host:514 or syslog:// for the local daemon")
+	summaryLogFormat   = flag.String("summary-log-format", "", "Format of the summary log, text or json, -log-format when empty")
+	summaryLogMaxSize  = flag.Int("summary-log-max-size", 0, "Size in MB at which the summary log is rotated, 0 never rotates")
+	summaryLogMaxFiles = flag.Int("summary-log-max-files", 5, "Number of rotated summary log files kept")
+	logSampleRate      = flag.Int("log-sample-rate", 1, "Only log 1 in N routine produce/fetch/request lines, audit and security lines are always logged")
+	logRateLimit       = flag.Int("log-rate-limit", 0, "Maximum routine log lines per second, the suppressed ones are counted in a summary line. 0 is unlimited")
+	logFormat          = flag.String("log-format", logging.FormatText, "Log format, text or json (one object per line)")
 )
 
 func main() {
 	defer util.Run()()
-	log.Printf("starting capture on interface %q", *iface)
+	if *configFile != "" {
+		if err := loadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	// run telemetry
-	go runTelemetry()
+	if err := logging.SetFormat(*logFormat); err != nil {
+		log.Fatal(err)
+	}
+	logging.SetQuiet(*quiet)
+	if *listIfaces {
+		devices, err := findInterfaces()
+		if err != nil {
+			log.Fatal(err)
+		}
+		printInterfaces(os.Stdout, devices)
+		return
+	}
+	logging.SetSampling(*logSampleRate, *logRateLimit)
+	if *recentRequestsSize > 0 {
+		recentRequests = stream.NewRecentRequests(*recentRequestsSize)
+	}
 
-	// Set up pcap packet capture
-	handle, err := pcap.OpenLive(*iface, int32(*snaplen), true, pcap.BlockForever)
-	if err != nil {
-		panic(err)
+	if err := kafka.SetMaxRequestSize(*maxRequestSize); err != nil {
+		log.Fatal(err)
+	}
+	if *flushInterval < 0 || *flushMaxAge <= 0 {
+		log.Fatalf("-assembler-flush-interval must not be negative and -assembler-max-age must be positive, got %s and %s", *flushInterval, *flushMaxAge)
+	}
+	if *vlanID < -1 || *vlanID > 4094 {
+		log.Fatalf("-vlan must be a VLAN ID between 0 and 4094, or -1, got %d", *vlanID)
 	}
+	kafka.StrictSasl = *saslStrict
+	kafka.CaptureConfigValues = *captureConfigVals
+	if err := kafka.ConfigureSummaryLog(kafka.SummaryLogConfig{
+		Path:     *summaryLog,
+		Output:   *summaryOutput,
+		Format:   *summaryLogFormat,
+		MaxSize:  int64(*summaryLogMaxSize) * 1024 * 1024,
+		MaxFiles: *summaryLogMaxFiles,
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop capturing on SIGINT/SIGTERM, letting decoding finish and outputs close cleanly
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	// run telemetry
+	server := runTelemetry()
 
-	if err := handle.SetBPFFilter(filter); err != nil {
-		panic(err)
+	if *udsPath != "" {
+		readUnixSource(*udsPath, signals)
+		closeOutputs(server)
+		return
 	}
 
+	// Set up pcap packet capture, or replay of a capture file
+	handles := openHandles()
+	defer closeHandles(handles)
+
 	// init metrics storage
-	metricsStorage := metrics.NewStorage(prometheus.DefaultRegisterer, *expireTime)
-	// Set the default storage for utility functions
-	metrics.SetDefaultStorage(metricsStorage)
+	metricsStorage := newMetricsStorage()
 
 	// Set up assembly
-	streamPool := tcpassembly.NewStreamPool(stream.NewKafkaStreamFactory(metricsStorage, *verbose))
+	factory := newStreamFactory(metricsStorage)
+	streamPool := tcpassembly.NewStreamPool(factory)
 	assembler := tcpassembly.NewAssembler(streamPool)
 
 	// Auto-flushing connection state to get packets
 	// without waiting SYN
-	assembler.MaxBufferedPagesTotal = 1000
-	assembler.MaxBufferedPagesPerConnection = 1
+	assembler.MaxBufferedPagesTotal = *maxPages
+	assembler.MaxBufferedPagesPerConnection = *maxConnPages
 
 	log.Println("reading in packets")
 
-	// Read in packets, pass to assembler.
-	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	packets := packetSource.Packets()
-	ticker := time.Tick(time.Minute)
+	// Read in packets of all handles, pass to assembler. The assembler isn't safe for
+	// concurrent use, packets are merged and assembled by this goroutine only.
+	sources := make([]stream.PacketSource, 0, len(handles))
+	for _, handle := range handles {
+		sources = append(sources, stream.NewPacketSource(gopacket.NewPacketSource(handle, handle.LinkType())))
+	}
+	packets := mergePackets(sources)
+
+	// A replay is flushed following the capture time of its packets instead of a ticker
+	var ticker <-chan time.Time
+	if *pcapFile == "" && *flushInterval > 0 {
+		ticker = time.Tick(*flushInterval)
+	}
+	var lastFlush time.Time
 
 	for {
 		select {
-		case packet := <-packets:
-			if *verbose {
-				log.Println(packet)
+		case packet, ok := <-packets:
+			if !ok {
+				// End of the capture file: close all connections and let the streams drain
+				drain(assembler, factory)
+				log.Printf("finished replaying %q", *pcapFile)
+				closeOutputs(server)
+				return
 			}
 
-			if packet.NetworkLayer() == nil || packet.TransportLayer() == nil || packet.TransportLayer().LayerType() != layers.LayerTypeTCP {
-				if *verbose {
-					log.Println("Unusable packet")
-				}
+			if !assemblePacket(assembler, packet) {
 				continue
 			}
 
-			tcp := packet.TransportLayer().(*layers.TCP)
+			if *pcapFile != "" && *flushInterval > 0 {
+				captured := packet.Metadata().Timestamp
+				if lastFlush.IsZero() {
+					lastFlush = captured
+				}
+				if captured.Sub(lastFlush) >= *flushInterval {
+					flushAssembler(assembler, captured)
+					lastFlush = captured
+				}
+			}
 
-			assembler.AssembleWithTimestamp(packet.NetworkLayer().NetworkFlow(), tcp, packet.Metadata().Timestamp)
+		case sig := <-signals:
+			log.Printf("received %s, shutting down", sig)
+			atomic.StoreInt32(&shuttingDown, 1)
+			drain(assembler, factory)
+			closeOutputs(server)
+			return
 
 		case <-ticker:
-			// Every minute, flush connections that haven't seen activity in the past 2 minutes.
-			assembler.FlushOlderThan(time.Now().Add(time.Minute * -2))
-			log.Println("---- FLUSHING ----")
+			flushAssembler(assembler, time.Now())
+		}
+	}
+}
+
+// assemblePacket hands a captured packet to the assembler. It returns false for the packets
+// skipped, outside of -vlan or without a TCP layer.
+func assemblePacket(assembler *tcpassembly.Assembler, packet gopacket.Packet) bool {
+	if *verbose {
+		log.Println(packet)
+	}
+
+	if *vlanID >= 0 && !inVLAN(packet, uint16(*vlanID)) {
+		return false
+	}
+
+	if !stream.AssemblePacket(assembler, packet) {
+		if *verbose {
+			logging.Println("Unusable packet")
+		}
+		return false
+	}
+	return true
+}
+
+// flushAssembler pushes the out-of-order segments older than -assembler-max-age past their
+// gap, and closes the connections without data since then
+func flushAssembler(assembler *tcpassembly.Assembler, now time.Time) {
+	flushed, closed := assembler.FlushOlderThan(now.Add(-*flushMaxAge))
+	metrics.AssemblerFlushedTotal.WithLabelValues("flushed").Add(float64(flushed))
+	metrics.AssemblerFlushedTotal.WithLabelValues("closed").Add(float64(closed))
+	logging.Printf("flushed the assembler: %d connections flushed, %d closed", flushed, closed)
+}
+
+// openHandles opens the capture file, or a live capture on each interface, with the
+// BPF filter of -bpf or the one of the broker ports
+func openHandles() []*pcap.Handle {
+	var handles []*pcap.Handle
+	if err := loadPcap(); err != nil {
+		log.Fatal(err)
+	}
+	if *pcapFile != "" {
+		log.Printf("replaying capture file %q", *pcapFile)
+		handle, err := pcap.OpenOffline(*pcapFile)
+		if err != nil {
+			panic(err)
+		}
+		handles = append(handles, handle)
+	} else {
+		for _, name := range captureInterfaces() {
+			log.Printf("starting capture on interface %q", name)
+			handle, err := pcap.OpenLive(name, int32(*snaplen), true, pcap.BlockForever)
+			if err != nil {
+				closeHandles(handles)
+				log.Fatalf("could not capture on interface %q: %v", name, err)
+			}
+			handles = append(handles, handle)
+		}
+	}
+
+	filter := *bpf
+	if filter == "" {
+		filter = bpfFilter()
+	}
+	log.Printf("using BPF filter %q", filter)
+	for _, handle := range handles {
+		if err := handle.SetBPFFilter(filter); err != nil {
+			closeHandles(handles)
+			log.Fatalf("invalid BPF filter %q: %v", filter, err)
+		}
+	}
+	return handles
+}
+
+// captureInterfaces returns the interfaces of -interfaces, or the one of -i, with indexes
+// resolved to names
+func captureInterfaces() []string {
+	var names []string
+	for _, name := range strings.Split(*ifaces, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, *iface)
+	}
+	names, err := resolveInterfaces(names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return names
+}
+
+// mergePackets returns the packets of all sources on a single channel, closed once every
+// source has been read to its end
+func mergePackets(sources []stream.PacketSource) <-chan gopacket.Packet {
+	merged := make(chan gopacket.Packet, len(sources))
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		atomic.AddInt32(&openCaptures, 1)
+		go func(source stream.PacketSource) {
+			defer wg.Done()
+			// the source ends when its handle stops capturing
+			defer atomic.AddInt32(&openCaptures, -1)
+			err := stream.ReadPackets(source, func(packet gopacket.Packet) {
+				atomic.StoreInt64(&lastPacketTime, time.Now().UnixNano())
+				merged <- packet
+			})
+			if err != nil {
+				log.Printf("stopped reading packets: %v", err)
+			}
+		}(source)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// closeHandles stops the capture of all handles
+func closeHandles(handles []*pcap.Handle) {
+	for _, handle := range handles {
+		handle.Close()
+	}
+}
+
+// drain closes all connections of the assembler and waits for their streams to decode
+// what was already captured
+func drain(assembler *tcpassembly.Assembler, factory *stream.KafkaStreamFactory) {
+	assembler.FlushAll()
+
+	done := make(chan struct{})
+	go func() {
+		factory.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Printf("streams still decoding after %s, stopping them", shutdownTimeout)
+		stopStreams()
+	}
+}
+
+// stopStreams cancels the context of the streams of the stream factory
+var stopStreams context.CancelFunc = func() {}
+
+// recentRequests is the buffer of -recent-requests, nil when not configured
+var recentRequests *stream.RecentRequests
+
+// kafkaOutput is the sink of -output-topic, nil when not configured
+var kafkaOutput *events.Kafka
+
+// stopCSVExport writes the last CSV snapshot of -csv-export-dir and stops the export
+var stopCSVExport = func() {}
+
+// closeOutputs closes the summary log, the kafka output and the CSV export, and stops the
+// metrics server
+func closeOutputs(server *http.Server) {
+	stopCSVExport()
+
+	if kafkaOutput != nil {
+		if err := kafkaOutput.Close(); err != nil {
+			log.Printf("could not close kafka output: %v", err)
+		}
+	}
+
+	if err := kafka.GetSummaryLogger().Close(); err != nil {
+		log.Printf("could not close summary log: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("could not stop metrics server: %v", err)
+	}
+}
+
+// setApplicationPattern compiles the -app-from-clientid regexp
+func setApplicationPattern() {
+	if *appFromClientID == "" {
+		return
+	}
+
+	pattern, err := regexp.Compile(*appFromClientID)
+	if err != nil {
+		log.Fatalf("invalid -app-from-clientid regexp: %v", err)
+	}
+	metrics.SetApplicationPattern(pattern)
+}
+
+// brokerPortList returns the ports of -broker-ports, and the one of -p when it is set
+func brokerPortList() []string {
+	var ports []string
+	for _, port := range strings.Split(*brokerPorts, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			ports = append(ports, port)
+		}
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "p" {
+			return
+		}
+		port := fmt.Sprint(*dstport)
+		for _, p := range ports {
+			if p == port {
+				return
+			}
+		}
+		ports = append(ports, port)
+	})
+
+	if len(ports) == 0 {
+		ports = append(ports, fmt.Sprint(*dstport))
+	}
+	return ports
+}
+
+// bpfFilter returns the filter capturing the traffic to the broker ports. Responses are only
+// captured when latency is measured. Broker ports can't be detected in the traffic of the known
+// ones, so that all the TCP traffic is captured with -detect-broker-ports.
+func bpfFilter() string {
+	if *detectPorts > 0 {
+		return vlanFilter("tcp")
+	}
+
+	direction := "dst port"
+	if *latency {
+		direction = "port"
+	}
+
+	var ports []string
+	for _, port := range brokerPortList() {
+		ports = append(ports, direction+" "+port)
+	}
+	return vlanFilter("tcp and (" + strings.Join(ports, " or ") + ")")
+}
+
+// vlanFilter extends a filter to the packets tagged with 802.1Q, including QinQ, or to the
+// ones of -vlan. Each vlan keyword shifts the offsets of the rest of the filter by a tag, so
+// that the filter is repeated after each one.
+func vlanFilter(filter string) string {
+	tagged := fmt.Sprintf("(%s or (vlan and %s))", filter, filter)
+	if *vlanID >= 0 {
+		return fmt.Sprintf("vlan %d and %s", *vlanID, tagged)
+	}
+	return fmt.Sprintf("%s or (vlan and %s)", filter, tagged)
+}
+
+// inVLAN reports whether the outer 802.1Q tag of a packet has the given VLAN ID, filtering
+// the packets of -vlan when -bpf doesn't
+func inVLAN(packet gopacket.Packet, id uint16) bool {
+	dot1q, ok := packet.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q)
+	return ok && dot1q.VLANIdentifier == id
+}
+
+// setUserMap resolves the usernames of the user metrics with the map of -user-map. It must be
+// called before the metrics are registered.
+func setUserMap() {
+	if *userMap == "" {
+		return
+	}
+	users, err := metrics.LoadUserMap(*userMap)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = metrics.SetUsernameResolver(users, users.LabelNames()...); err != nil {
+		log.Fatalf("invalid user map %s: %v", *userMap, err)
+	}
+}
+
+// newMetricsStorage creates the metrics storage and starts the cleanup of the state of
+// inactive clients, which expires along with their relation metrics
+func newMetricsStorage() *metrics.Storage {
+	setApplicationPattern()
+	setUserMap()
+	opts := metrics.StorageOptions{
+		DefaultExpireTime: *expireTime,
+		Relations:         *relationsExpire,
+		Connections:       *connsExpire,
+		Clients:           *clientsExpire,
+	}.WithDefaults()
+	metricsStorage := metrics.NewStorageWithOptions(prometheus.DefaultRegisterer, opts)
+	// Set the default storage for utility functions
+	metrics.SetDefaultStorage(metricsStorage)
+	metricsStorage.StartCleanup(context.Background(), cleanupInterval, opts.Relations)
+	if *csvExportDir != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := metricsStorage.StartCSVExport(ctx, *csvExportDir, *csvExportInterval)
+		stopCSVExport = func() {
+			cancel()
+			<-done
+		}
+	}
+	return metricsStorage
+}
+
+// newStreamFactory creates a stream factory configured from command line flags
+func newStreamFactory(metricsStorage *metrics.Storage) *stream.KafkaStreamFactory {
+	factory := stream.NewKafkaStreamFactory(metricsStorage, *verbose)
+	ctx, cancel := context.WithCancel(context.Background())
+	factory.SetContext(ctx)
+	stopStreams = cancel
+	factory.SetIdleTimeout(*streamIdleTimeout)
+	if *anonymizeIPs {
+		factory.SetAnonymizeKey(anonymizationKey())
+	}
+	factory.SetLabelIncludePort(*labelIncludePort)
+	factory.SetDetectRawSasl(*detectRawSasl)
+	factory.SetInvalidLengthThreshold(*invalidLengthWarn)
+	if err := factory.SetBufferSize(*streamBufferSize); err != nil {
+		log.Fatal(err)
+	}
+	if err := factory.SetDecodeWorkers(*decodeWorkers, *decodeQueueBytes); err != nil {
+		log.Fatal(err)
+	}
+	if *saslPorts != "" {
+		factory.SetSaslPorts(strings.Split(*saslPorts, ","))
+	}
+	factory.SetBrokerPorts(brokerPortList())
+	factory.SetDetectBrokerPorts(*detectPorts)
+	factory.SetLatency(*latency)
+	if recentRequests != nil {
+		factory.RegisterHook(recentRequests.Record)
+	}
+	if *captureHeaders != "" {
+		factory.SetCaptureHeaders(strings.Split(*captureHeaders, ","))
+	}
+	if *logProduceKeys {
+		if *produceKeyMaxLen <= 0 {
+			log.Fatalf("-produce-key-max-length must be positive, got %d", *produceKeyMaxLen)
+		}
+		factory.SetLogProduceKeys(*produceKeyMaxLen)
+	}
+	if *topicInclude != "" || *topicExclude != "" {
+		topicFilter, err := stream.NewTopicFilter(strings.Split(*topicInclude, ","), strings.Split(*topicExclude, ","))
+		if err != nil {
+			log.Fatalf("invalid topic filter: %v", err)
+		}
+		factory.SetTopicFilter(topicFilter)
+	}
+
+	dispatcher := events.NewDispatcher()
+	if *webhookURL != "" {
+		log.Printf("sending %s events to webhook", *webhookEvents)
+		dispatcher.Add(events.NewWebhook(*webhookURL), events.SinkOptions{
+			Name:  "webhook",
+			Types: strings.Split(*webhookEvents, ","),
+		})
+	}
+	if *outputBrokers != "" || *outputTopic != "" {
+		if *outputBufferSize <= 0 {
+			log.Fatalf("-output-buffer-size must be positive, got %d", *outputBufferSize)
 		}
+		if *outputOverflow != events.OverflowDropOldest && *outputOverflow != events.OverflowBlock {
+			log.Fatalf("-output-buffer-overflow must be %s or %s, got %q", events.OverflowDropOldest, events.OverflowBlock, *outputOverflow)
+		}
+
+		sink, err := events.NewKafka(events.KafkaConfig{
+			Brokers:       strings.Split(*outputBrokers, ","),
+			Topic:         *outputTopic,
+			SASLMechanism: *outputSaslMech,
+			SASLUsername:  *outputSaslUser,
+			SASLPassword:  *outputSaslPassword,
+		})
+		if err != nil {
+			log.Fatalf("could not create the kafka output: %v", err)
+		}
+		log.Printf("producing events to topic %s", *outputTopic)
+
+		var types []string
+		if *outputEvents != "" {
+			types = strings.Split(*outputEvents, ",")
+		}
+		dispatcher.Add(sink, events.SinkOptions{
+			Name:      "kafka",
+			Types:     types,
+			QueueSize: *outputBufferSize,
+			Overflow:  *outputOverflow,
+		})
+		kafkaOutput = sink
+	}
+	if dispatcher.Len() > 0 {
+		factory.SetEventSink(dispatcher)
+	}
+
+	return factory
+}
+
+// anonymizationKey returns the key of -anonymize-key or $SNIFFER_ANONYMIZE_KEY, or a random one
+func anonymizationKey() []byte {
+	key := *anonymizeKey
+	if key == "" {
+		key = os.Getenv("SNIFFER_ANONYMIZE_KEY")
+	}
+	if key != "" {
+		return []byte(key)
+	}
+
+	log.Println("no -anonymize-key set, anonymized client addresses change on restart")
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		log.Fatalf("could not generate an anonymization key: %v", err)
+	}
+	return random
+}
+
+// readUnixSource decodes requests from a Unix socket, file or pipe. Sockets are dialed,
+// anything else is opened for reading. TCP reassembly isn't needed as the source already
+// carries the client-to-broker byte stream.
+func readUnixSource(path string, signals <-chan os.Signal) {
+	metricsStorage := newMetricsStorage()
+
+	var src io.ReadCloser
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Fatalf("could not stat %s: %v", path, err)
+	}
+
+	if info.Mode()&os.ModeSocket != 0 {
+		src, err = net.Dial("unix", path)
+	} else {
+		src, err = os.Open(path)
+	}
+	if err != nil {
+		log.Fatalf("could not open %s: %v", path, err)
+	}
+	defer src.Close()
+
+	log.Printf("reading kafka requests from %s", path)
+
+	atomic.AddInt32(&openCaptures, 1)
+	defer atomic.AddInt32(&openCaptures, -1)
+
+	// Closing the source on shutdown ends the stream
+	go func() {
+		sig := <-signals
+		log.Printf("received %s, shutting down", sig)
+		atomic.StoreInt32(&shuttingDown, 1)
+		_ = src.Close()
+	}()
+
+	newStreamFactory(metricsStorage).ReadStream(activityReader{src}, "unix:"+path)
+}
+
+var (
+	// openCaptures counts the capture handles, or the Unix source, still being read
+	openCaptures int32
+
+	// lastPacketTime is the time in Unix nanoseconds at which the last packet was read, it
+	// tells a stalled capture (e.g. of an interface gone down) from a working one
+	lastPacketTime int64
+)
+
+// activityReader updates lastPacketTime on every read of the Unix source
+type activityReader struct {
+	io.Reader
+}
+
+func (r activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		atomic.StoreInt64(&lastPacketTime, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// healthz tells that the process is alive
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz tells whether packets are being captured: a capture is open and its last packet
+// is at most -ready-max-packet-age old
+func readyz(w http.ResponseWriter, _ *http.Request) {
+	if atomic.LoadInt32(&openCaptures) == 0 {
+		http.Error(w, "not ready: no open capture", http.StatusServiceUnavailable)
+		return
 	}
+
+	last := atomic.LoadInt64(&lastPacketTime)
+	if last == 0 {
+		http.Error(w, "not ready: no packet captured yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	age := time.Since(time.Unix(0, last)).Round(time.Millisecond)
+	if age > *readyPacketAge {
+		http.Error(w, fmt.Sprintf("not ready: last packet %s ago", age), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "ok: last packet %s ago\n", age)
 }
 
-func runTelemetry() {
-	fmt.Printf("serving metrics on %s\n", *listenAddr)
-	
+// shuttingDown is set once a shutdown signal is received, the metrics server then answers 503
+// while the streams drain
+var shuttingDown int32
+
+// runTelemetry starts the metrics server on the -metrics-listen address
+func runTelemetry() *http.Server {
+	addr := metricsListenAddr()
+	listener, err := listenMetrics(addr)
+	if err != nil {
+		log.Fatalf("could not listen on %s: %v", addr, err)
+	}
+	fmt.Printf("serving metrics on %s\n", addr)
+
 	// Start goroutine to cleanup expired user-client mappings
 	go metrics.CleanupExpiredUserMappings()
 
-	http.Handle("/metrics", promhttp.Handler())
-	if err := http.ListenAndServe(*listenAddr, nil); err != nil {
-		panic(err)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/relationships", metrics.RelationshipsHandler())
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz)
+	if recentRequests != nil {
+		mux.Handle("/recent", recentRequests)
 	}
+	server := &http.Server{Handler: unlessShuttingDown(mux)}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+	return server
+}
+
+// metricsListenAddr returns the -metrics-listen address, or the one of the deprecated -addr
+// when only it is set
+func metricsListenAddr() string {
+	addr := *metricsListen
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "addr" && *metricsListen == defaultListenAddr {
+			addr = *listenAddr
+		}
+	})
+	return addr
+}
+
+// listenMetrics listens on a TCP address, or on a Unix socket for unix:/path addresses. A
+// socket file left by a previous run is removed.
+func listenMetrics(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixListenPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, unixListenPrefix)
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// unlessShuttingDown answers 503 instead of calling next once shutdown has started, so that
+// scrapes during the drain aren't mistaken for a healthy sniffer
+func unlessShuttingDown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&shuttingDown) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
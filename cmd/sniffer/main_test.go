@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+	"github.com/d-ulyanov/kafka-sniffer/stream"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// metadataRequest is a Metadata v1 request of topic orders, with correlation id 7 and client
+// id "test"
+func metadataRequest() []byte {
+	payload := []byte{0, 3, 0, 1, 0, 0, 0, 7, 0, 4, 't', 'e', 's', 't', 0, 0, 0, 1, 0, 6, 'o', 'r', 'd', 'e', 'r', 's'}
+	frame := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// tcpPacket returns a packet of a TCP segment from 10.0.0.1:50000 to the broker 10.0.0.100:9092
+func tcpPacket(t *testing.T, seq uint32, syn bool, payload []byte) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IPv4(10, 0, 0, 1),
+		DstIP:    net.IPv4(10, 0, 0, 100),
+	}
+	tcp := &layers.TCP{SrcPort: 50000, DstPort: 9092, Seq: seq, SYN: syn, ACK: !syn, PSH: len(payload) > 0, Window: 65535}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().Timestamp = time.Now()
+	packet.Metadata().CaptureLength = len(buf.Bytes())
+	packet.Metadata().Length = len(buf.Bytes())
+	return packet
+}
+
+func TestCaptureMetadataRequest(t *testing.T) {
+	requests := metrics.RequestsCount.WithLabelValues("10.0.0.1", "Metadata", "1")
+	before := testutil.ToFloat64(requests)
+
+	factory := newStreamFactory(metrics.NewStorage(prometheus.NewRegistry(), 0))
+	assembler := tcpassembly.NewAssembler(tcpassembly.NewStreamPool(factory))
+
+	source := stream.NewPacketSlice(
+		tcpPacket(t, 100, true, nil),
+		tcpPacket(t, 101, false, metadataRequest()),
+	)
+	assembled := 0
+	for packet := range mergePackets([]stream.PacketSource{source}) {
+		if assemblePacket(assembler, packet) {
+			assembled++
+		}
+	}
+	drain(assembler, factory)
+
+	if assembled != 2 {
+		t.Errorf("assembled %d packets, want 2", assembled)
+	}
+	if increment := testutil.ToFloat64(requests) - before; increment != 1 {
+		t.Errorf("metadata requests of 10.0.0.1 increased by %v, want 1", increment)
+	}
+}
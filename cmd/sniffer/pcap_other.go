@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// loadPcap does nothing, libpcap is linked in
+func loadPcap() error {
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// loadPcap loads wpcap.dll, installed by Npcap (or the older WinPcap). Without it every
+// capture call would fail.
+func loadPcap() error {
+	if err := pcap.LoadWinPCAP(); err != nil {
+		return fmt.Errorf("%v, is Npcap installed? Get it from https://npcap.com", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"log"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// DefaultQueueSize is the number of events buffered per sink when SinkOptions.QueueSize isn't set
+const DefaultQueueSize = 256
+
+// Overflow policies of a sink queue
+const (
+	// OverflowDropNewest drops the events published while the queue is full
+	OverflowDropNewest = "drop-newest"
+	// OverflowDropOldest drops the oldest queued event to make room for the published one
+	OverflowDropOldest = "drop-oldest"
+	// OverflowBlock holds up the publisher until the sink makes room in the queue
+	OverflowBlock = "block"
+)
+
+// SinkOptions configures how a Dispatcher feeds a sink
+type SinkOptions struct {
+	// Name identifies the sink in metrics and logs
+	Name string
+
+	// Types lists the event types sent to the sink, empty means all of them
+	Types []string
+
+	// QueueSize is the number of events buffered for the sink
+	QueueSize int
+
+	// Overflow is what happens to events published while the queue is full, OverflowDropNewest
+	// when empty. Only OverflowBlock lets a slow or unavailable sink hold up the decoder.
+	Overflow string
+}
+
+// Dispatcher is a Sink fanning each event out to several sinks. Every sink has its own
+// filter, queue and goroutine: a slow, blocked or panicking sink doesn't affect the others.
+type Dispatcher struct {
+	outputs []*output
+}
+
+type output struct {
+	name     string
+	sink     Sink
+	types    map[string]bool
+	queue    chan Event
+	overflow string
+}
+
+// NewDispatcher creates a dispatcher without sinks
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Add registers a sink. The sink's Publish is called from a dedicated goroutine and may block.
+// Sinks must be added before events are published.
+func (d *Dispatcher) Add(sink Sink, opts SinkOptions) {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Overflow == "" {
+		opts.Overflow = OverflowDropNewest
+	}
+
+	o := &output{
+		name:     opts.Name,
+		sink:     sink,
+		types:    make(map[string]bool, len(opts.Types)),
+		queue:    make(chan Event, opts.QueueSize),
+		overflow: opts.Overflow,
+	}
+	for _, t := range opts.Types {
+		o.types[t] = true
+	}
+
+	d.outputs = append(d.outputs, o)
+
+	go o.run()
+}
+
+// Len returns the number of registered sinks
+func (d *Dispatcher) Len() int {
+	return len(d.outputs)
+}
+
+// Publish implements Sink. It only blocks on the full queue of an OverflowBlock sink.
+func (d *Dispatcher) Publish(e Event) {
+	for _, o := range d.outputs {
+		if len(o.types) > 0 && !o.types[e.Type] {
+			continue
+		}
+
+		o.enqueue(e)
+	}
+}
+
+// enqueue queues an event for the sink, applying its overflow policy when the queue is full
+func (o *output) enqueue(e Event) {
+	switch o.overflow {
+	case OverflowBlock:
+		o.queue <- e
+	case OverflowDropOldest:
+		for {
+			select {
+			case o.queue <- e:
+				return
+			default:
+			}
+
+			// The sink may have emptied the queue in between, only count an actual drop
+			select {
+			case <-o.queue:
+				o.dropped()
+			default:
+			}
+		}
+	default:
+		select {
+		case o.queue <- e:
+		default:
+			o.dropped()
+		}
+	}
+}
+
+// dropped counts an event lost to a full queue
+func (o *output) dropped() {
+	metrics.EventsDispatchedTotal.WithLabelValues(o.name, "dropped").Inc()
+	metrics.EmitSinkDroppedTotal.WithLabelValues(o.name).Inc()
+}
+
+// run hands queued events to the sink
+func (o *output) run() {
+	for e := range o.queue {
+		if o.publish(e) {
+			metrics.EventsDispatchedTotal.WithLabelValues(o.name, "sent").Inc()
+		} else {
+			metrics.EventsDispatchedTotal.WithLabelValues(o.name, "failed").Inc()
+		}
+	}
+}
+
+// publish calls the sink, recovering from panics so that one broken sink can't take the sniffer down
+func (o *output) publish(e Event) (ok bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("events: %s sink panicked on %s event: %v", o.name, e.Type, rec)
+			ok = false
+		}
+	}()
+
+	o.sink.Publish(e)
+	return true
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// stalledSink is a sink whose Publish waits for release, like a producer whose brokers are down
+type stalledSink struct {
+	started   chan struct{}
+	release   chan struct{}
+	published chan string
+}
+
+func newStalledSink() *stalledSink {
+	return &stalledSink{
+		started:   make(chan struct{}, 1),
+		release:   make(chan struct{}),
+		published: make(chan string, 16),
+	}
+}
+
+func (s *stalledSink) Publish(e Event) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+	s.published <- e.ClientIP
+}
+
+// received returns the client IPs of the n next published events
+func (s *stalledSink) received(t *testing.T, n int) []string {
+	var ips []string
+	for i := 0; i < n; i++ {
+		select {
+		case ip := <-s.published:
+			ips = append(ips, ip)
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want %d events", ips, n)
+		}
+	}
+	return ips
+}
+
+// publishAll publishes an event per client IP
+func publishAll(d *Dispatcher, ips ...string) {
+	for _, ip := range ips {
+		d.Publish(Event{Type: Authentication, ClientIP: ip})
+	}
+}
+
+func TestDispatcherDropOldest(t *testing.T) {
+	sink := newStalledSink()
+	d := NewDispatcher()
+	d.Add(sink, SinkOptions{Name: "drop-oldest", QueueSize: 2, Overflow: OverflowDropOldest})
+	dropped := metrics.EmitSinkDroppedTotal.WithLabelValues("drop-oldest")
+	before := testutil.ToFloat64(dropped)
+
+	// The sink holds the first event while the next ones fill its queue
+	publishAll(d, "10.0.0.1")
+	<-sink.started
+	publishAll(d, "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5")
+
+	if v := testutil.ToFloat64(dropped) - before; v != 2 {
+		t.Errorf("dropped events are %v, want 2", v)
+	}
+
+	close(sink.release)
+	got := sink.received(t, 3)
+	want := []string{"10.0.0.1", "10.0.0.4", "10.0.0.5"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("published events are %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDispatcherDropNewest(t *testing.T) {
+	sink := newStalledSink()
+	d := NewDispatcher()
+	d.Add(sink, SinkOptions{Name: "drop-newest", QueueSize: 2})
+	dropped := metrics.EmitSinkDroppedTotal.WithLabelValues("drop-newest")
+	before := testutil.ToFloat64(dropped)
+
+	publishAll(d, "10.0.0.1")
+	<-sink.started
+	publishAll(d, "10.0.0.2", "10.0.0.3", "10.0.0.4")
+
+	if v := testutil.ToFloat64(dropped) - before; v != 1 {
+		t.Errorf("dropped events are %v, want 1", v)
+	}
+
+	close(sink.release)
+	got := sink.received(t, 3)
+	if got[2] != "10.0.0.3" {
+		t.Errorf("published events are %v, want the newest one dropped", got)
+	}
+}
+
+func TestDispatcherBlock(t *testing.T) {
+	sink := newStalledSink()
+	d := NewDispatcher()
+	d.Add(sink, SinkOptions{Name: "block", QueueSize: 1, Overflow: OverflowBlock})
+	dropped := metrics.EmitSinkDroppedTotal.WithLabelValues("block")
+	before := testutil.ToFloat64(dropped)
+
+	publishAll(d, "10.0.0.1")
+	<-sink.started
+	publishAll(d, "10.0.0.2")
+
+	done := make(chan struct{})
+	go func() {
+		publishAll(d, "10.0.0.3")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("publishing to the full queue didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(sink.release)
+	<-done
+	if got := sink.received(t, 3); got[2] != "10.0.0.3" {
+		t.Errorf("published events are %v, want all of them", got)
+	}
+	if v := testutil.ToFloat64(dropped) - before; v != 0 {
+		t.Errorf("dropped events are %v, want 0", v)
+	}
+}
@@ -0,0 +1,46 @@
+package events
+
+import "time"
+
+// Types of events published by the sniffer
+const (
+	// AuthAnomaly is published for SASL flows that look suspicious, e.g. a handshake never followed by a username
+	AuthAnomaly = "auth_anomaly"
+	// AclChange is published when a client creates or deletes ACLs
+	AclChange = "acl_change"
+	// ConfigChange is published when a client alters the configs of a resource
+	ConfigChange = "config_change"
+	// TopicDeletion is published when a client deletes a topic
+	TopicDeletion = "topic_deletion"
+	// PlaintextCredentials is published when SASL credentials are seen in clear text on the wire
+	PlaintextCredentials = "plaintext_credentials"
+	// Authentication is published when the username of a connection is learnt from its SASL exchange
+	Authentication = "authentication"
+	// ProduceRelation is published the first time a connection produces to a topic
+	ProduceRelation = "produce_relation"
+	// ConsumeRelation is published the first time a connection consumes from a topic
+	ConsumeRelation = "consume_relation"
+)
+
+// Event is a decoded, high-level fact about Kafka traffic
+type Event struct {
+	Type      string            `json:"type"`
+	Time      time.Time         `json:"time"`
+	ClientIP  string            `json:"client_ip"`
+	Username  string            `json:"username,omitempty"`
+	Mechanism string            `json:"mechanism,omitempty"`
+	Topic     string            `json:"topic,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Sink receives published events. Sinks given to the stream factory must never block the caller,
+// sinks which may block (network outputs, files) are fed through a Dispatcher.
+type Sink interface {
+	Publish(e Event)
+}
+
+// NopSink drops every event
+type NopSink struct{}
+
+// Publish implements Sink
+func (NopSink) Publish(Event) {}
@@ -0,0 +1,192 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+const (
+	// DefaultKafkaBatchSize is the number of events sent together when KafkaConfig.BatchSize isn't set
+	DefaultKafkaBatchSize = 100
+	// DefaultKafkaFlushInterval bounds the time an event waits for its batch to fill
+	DefaultKafkaFlushInterval = time.Second
+)
+
+// KafkaConfig configures a Kafka sink
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, SASL is off when empty
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Kafka is a Sink producing events as JSON records to a topic, keyed by client IP. Events
+// are sent in batches: Publish blocks while a full batch is sent, so the sink is meant to be
+// fed by a Dispatcher, which queues events for it and drops them when the queue is full.
+type Kafka struct {
+	producer      sarama.SyncProducer
+	topic         string
+	batchSize     int
+	flushInterval time.Duration
+
+	mu    sync.Mutex
+	batch []*sarama.ProducerMessage
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewKafka connects a Kafka sink to its brokers
+func NewKafka(cfg KafkaConfig) (*Kafka, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka sink needs brokers and a topic")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultKafkaBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultKafkaFlushInterval
+	}
+
+	config := sarama.NewConfig()
+	config.ClientID = "kafka-sniffer"
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	if err := ConfigureSASL(config, cfg.SASLMechanism, cfg.SASLUsername, cfg.SASLPassword); err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not start kafka producer: %w", err)
+	}
+
+	k := &Kafka{
+		producer:      producer,
+		topic:         cfg.Topic,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		done:          make(chan struct{}),
+	}
+
+	k.wg.Add(1)
+	go k.flushPeriodically()
+
+	return k, nil
+}
+
+// ConfigureSASL enables SASL with the given mechanism (PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512)
+// on a sarama config. An empty mechanism leaves SASL off.
+func ConfigureSASL(config *sarama.Config, mechanism, username, password string) error {
+	if mechanism == "" {
+		return nil
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = username
+	config.Net.SASL.Password = password
+
+	switch mechanism {
+	case "PLAIN":
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case "SCRAM-SHA-256":
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = scramClientGenerator(scramSHA256)
+	case "SCRAM-SHA-512":
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = scramClientGenerator(scramSHA512)
+	default:
+		return fmt.Errorf("unsupported SASL mechanism: %s", mechanism)
+	}
+	return nil
+}
+
+// Publish implements Sink
+func (k *Kafka) Publish(e Event) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("kafka sink: could not encode %s event: %v", e.Type, err)
+		metrics.KafkaOutputRecordsTotal.WithLabelValues("failed").Inc()
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.batch = append(k.batch, &sarama.ProducerMessage{
+		Topic: k.topic,
+		Key:   sarama.StringEncoder(e.ClientIP),
+		Value: sarama.ByteEncoder(value),
+	})
+	if len(k.batch) >= k.batchSize {
+		k.flush()
+	}
+}
+
+// flushPeriodically sends incomplete batches every flush interval until the sink is closed
+func (k *Kafka) flushPeriodically() {
+	defer k.wg.Done()
+
+	ticker := time.NewTicker(k.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			k.mu.Lock()
+			k.flush()
+			k.mu.Unlock()
+		case <-k.done:
+			return
+		}
+	}
+}
+
+// flush sends the current batch. Called with the lock held.
+func (k *Kafka) flush() {
+	if len(k.batch) == 0 {
+		return
+	}
+
+	batch := k.batch
+	k.batch = nil
+
+	err := k.producer.SendMessages(batch)
+	if err == nil {
+		metrics.KafkaOutputRecordsTotal.WithLabelValues("sent").Add(float64(len(batch)))
+		return
+	}
+
+	failed := len(batch)
+	if errs, ok := err.(sarama.ProducerErrors); ok {
+		failed = len(errs)
+	}
+	metrics.KafkaOutputRecordsTotal.WithLabelValues("sent").Add(float64(len(batch) - failed))
+	metrics.KafkaOutputRecordsTotal.WithLabelValues("failed").Add(float64(failed))
+	log.Printf("kafka sink: could not send %d of %d events: %v", failed, len(batch), err)
+}
+
+// Close sends the pending events and closes the producer
+func (k *Kafka) Close() error {
+	close(k.done)
+	k.wg.Wait()
+
+	k.mu.Lock()
+	k.flush()
+	k.mu.Unlock()
+
+	return k.producer.Close()
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg/scram"
+)
+
+func TestConfigureSASL(t *testing.T) {
+	for _, mechanism := range []string{"", "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"} {
+		config := sarama.NewConfig()
+		if err := ConfigureSASL(config, mechanism, "sniffer", "secret"); err != nil {
+			t.Errorf("configuring %q: %v", mechanism, err)
+			continue
+		}
+		if err := config.Validate(); err != nil {
+			t.Errorf("config of %q is invalid: %v", mechanism, err)
+		}
+	}
+
+	if err := ConfigureSASL(sarama.NewConfig(), "GSSAPI", "sniffer", "secret"); err == nil {
+		t.Error("configuring GSSAPI returned no error")
+	}
+}
+
+func TestScramConversation(t *testing.T) {
+	tests := []struct {
+		mechanism string
+		hash      scram.HashGeneratorFcn
+	}{
+		{"SCRAM-SHA-256", scramSHA256},
+		{"SCRAM-SHA-512", scramSHA512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mechanism, func(t *testing.T) {
+			config := sarama.NewConfig()
+			if err := ConfigureSASL(config, tt.mechanism, "sniffer", "secret"); err != nil {
+				t.Fatal(err)
+			}
+
+			// the broker side, knowing the credentials of the user
+			user, err := tt.hash.NewClient("sniffer", "secret", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			credentials := user.GetStoredCredentials(scram.KeyFactors{Salt: "salt", Iters: 4096})
+			server, err := tt.hash.NewServer(func(string) (scram.StoredCredentials, error) {
+				return credentials, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			broker := server.NewConversation()
+
+			client := config.Net.SASL.SCRAMClientGeneratorFunc()
+			if err := client.Begin("sniffer", "secret", ""); err != nil {
+				t.Fatal(err)
+			}
+			challenge := ""
+			for !client.Done() {
+				response, err := client.Step(challenge)
+				if err != nil {
+					t.Fatalf("client step: %v", err)
+				}
+				if client.Done() {
+					break
+				}
+				if challenge, err = broker.Step(response); err != nil {
+					t.Fatalf("broker step: %v", err)
+				}
+			}
+			if !broker.Valid() {
+				t.Error("the broker didn't authenticate the client")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg/scram"
+)
+
+var (
+	// scramSHA256 and scramSHA512 are the hashes of the SCRAM-SHA-256 and SCRAM-SHA-512 mechanisms
+	scramSHA256 scram.HashGeneratorFcn = sha256.New
+	scramSHA512 scram.HashGeneratorFcn = sha512.New
+)
+
+// scramClient is the sarama.SCRAMClient of a SCRAM mechanism, sarama leaves its
+// implementation to the application
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+// scramClientGenerator returns the SCRAMClientGeneratorFunc of sarama for a hash
+func scramClientGenerator(hashGenerator scram.HashGeneratorFcn) func() sarama.SCRAMClient {
+	return func() sarama.SCRAMClient {
+		return &scramClient{hashGenerator: hashGenerator}
+	}
+}
+
+// Begin starts a conversation of the user
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+// Step returns the response to a challenge of the broker, the client-first message for an
+// empty one
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+// Done tells whether the conversation is over
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
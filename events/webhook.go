@@ -0,0 +1,93 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+const (
+	webhookMaxAttempts = 4
+	webhookBackoff     = 500 * time.Millisecond
+)
+
+// Webhook is a Sink that POSTs events as JSON to an HTTP endpoint (Slack, PagerDuty, ...).
+// Failed deliveries are retried with exponential backoff, so Publish blocks: the webhook
+// is meant to be fed by a Dispatcher, which queues and filters events for it.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook creates a webhook sink
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Publish implements Sink
+func (w *Webhook) Publish(e Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("webhook: could not encode %s event: %v", e.Type, err)
+		metrics.WebhookDeliveryTotal.WithLabelValues("failed").Inc()
+		return
+	}
+
+	if err := w.deliver(payload); err != nil {
+		log.Printf("webhook: giving up on %s event: %v", e.Type, err)
+		metrics.WebhookDeliveryTotal.WithLabelValues("failed").Inc()
+		return
+	}
+
+	metrics.WebhookDeliveryTotal.WithLabelValues("success").Inc()
+}
+
+// deliver sends a payload, retrying with exponential backoff on errors and 5xx responses
+func (w *Webhook) deliver(payload []byte) (err error) {
+	backoff := webhookBackoff
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if err = w.post(payload); err == nil {
+			return nil
+		}
+		if _, permanent := err.(permanentError); permanent {
+			return err
+		}
+
+		if attempt < webhookMaxAttempts {
+			metrics.WebhookDeliveryTotal.WithLabelValues("retry").Inc()
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+func (w *Webhook) post(payload []byte) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	case resp.StatusCode >= 300:
+		// retrying won't fix a rejected request
+		return permanentError{fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+	return nil
+}
+
+// permanentError is a delivery error which must not be retried
+type permanentError struct {
+	error
+}
@@ -0,0 +1,119 @@
+package kafka
+
+import "fmt"
+
+// AclBinding is an ACL, or the filter of the ACLs deleted by a DeleteAcls request. The enums
+// are kept as their protocol names, e.g. "TOPIC", "WRITE" and "ALLOW".
+type AclBinding struct {
+	ResourceType   string
+	ResourceName   string
+	PatternType    string // v1+, "LITERAL" before
+	Principal      string
+	Host           string
+	Operation      string
+	PermissionType string
+}
+
+var (
+	aclResourceTypes   = []string{"UNKNOWN", "ANY", "TOPIC", "GROUP", "CLUSTER", "TRANSACTIONAL_ID", "DELEGATION_TOKEN", "USER"}
+	aclPatternTypes    = []string{"UNKNOWN", "ANY", "MATCH", "LITERAL", "PREFIXED"}
+	aclOperations      = []string{"UNKNOWN", "ANY", "ALL", "READ", "WRITE", "CREATE", "DELETE", "ALTER", "DESCRIBE", "CLUSTER_ACTION", "DESCRIBE_CONFIGS", "ALTER_CONFIGS", "IDEMPOTENT_WRITE", "CREATE_TOKENS", "DESCRIBE_TOKENS"}
+	aclPermissionTypes = []string{"UNKNOWN", "ANY", "DENY", "ALLOW"}
+)
+
+// enumName returns the protocol name of an enum value, e.g. of an ACL operation
+func enumName(names []string, value int8) string {
+	if value >= 0 && int(value) < len(names) {
+		return names[value]
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", value)
+}
+
+// decodeAclBinding decodes an ACL creation, or a deletion filter whose strings are nullable.
+// A null filter string matches anything and is returned as "".
+func decodeAclBinding(pd PacketDecoder, version int16, flexible, filter bool) (b AclBinding, err error) {
+	decode := decodeString
+	if filter {
+		decode = decodeNullableString
+	}
+
+	resourceType, err := pd.getInt8()
+	if err != nil {
+		return b, fieldError("resource type", err)
+	}
+	b.ResourceType = enumName(aclResourceTypes, resourceType)
+
+	if b.ResourceName, err = decode(pd, flexible); err != nil {
+		return b, fieldError("resource name", err)
+	}
+	b.ResourceName = BoundString("resource_name", b.ResourceName)
+
+	b.PatternType = "LITERAL"
+	if version >= 1 {
+		patternType, err := pd.getInt8()
+		if err != nil {
+			return b, fieldError("pattern type", err)
+		}
+		b.PatternType = enumName(aclPatternTypes, patternType)
+	}
+
+	if b.Principal, err = decode(pd, flexible); err != nil {
+		return b, fieldError("principal", err)
+	}
+	b.Principal = BoundString("principal", b.Principal)
+
+	if b.Host, err = decode(pd, flexible); err != nil {
+		return b, fieldError("host", err)
+	}
+	b.Host = BoundString("host", b.Host)
+
+	operation, err := pd.getInt8()
+	if err != nil {
+		return b, fieldError("operation", err)
+	}
+	b.Operation = enumName(aclOperations, operation)
+
+	permissionType, err := pd.getInt8()
+	if err != nil {
+		return b, fieldError("permission type", err)
+	}
+	b.PermissionType = enumName(aclPermissionTypes, permissionType)
+
+	if flexible {
+		err = pd.getTaggedFields()
+	}
+	return b, err
+}
+
+// decodeAclBindings decodes the array of creations or deletion filters of a request
+func decodeAclBindings(pd PacketDecoder, version int16, flexible, filter bool) ([]AclBinding, error) {
+	count, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return nil, fieldError("acl array", err)
+	}
+
+	var bindings []AclBinding
+	if count > 0 {
+		bindings = make([]AclBinding, count)
+	}
+	for i := range bindings {
+		if bindings[i], err = decodeAclBinding(pd, version, flexible, filter); err != nil {
+			return nil, err
+		}
+	}
+	return bindings, nil
+}
+
+// aclRequiredVersion returns the minimum Kafka version of CreateAcls and DeleteAcls versions
+func aclRequiredVersion(version int16) Version {
+	switch version {
+	case 0:
+		return V0_11_0_0
+	case 1:
+		return V2_0_0_0
+	case 2:
+		return V2_4_0_0
+	default:
+		return V2_7_0_0
+	}
+}
@@ -0,0 +1,135 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+)
+
+// writeTopicAcl is the ACL allowing alice to write to topic orders from any host
+var writeTopicAcl = AclBinding{
+	ResourceType:   "TOPIC",
+	ResourceName:   "orders",
+	PatternType:    "LITERAL",
+	Principal:      "User:alice",
+	Host:           "*",
+	Operation:      "WRITE",
+	PermissionType: "ALLOW",
+}
+
+func TestDecodeAcls(t *testing.T) {
+	createAcls := func(raw []byte, version int16) ([]AclBinding, error) {
+		var r CreateAclsRequest
+		err := r.Decode(NewPacketDecoder(raw), version)
+		return r.Creations, err
+	}
+	deleteAcls := func(raw []byte, version int16) ([]AclBinding, error) {
+		var r DeleteAclsRequest
+		err := r.Decode(NewPacketDecoder(raw), version)
+		return r.Filters, err
+	}
+
+	tests := []struct {
+		name    string
+		decode  func(raw []byte, version int16) ([]AclBinding, error)
+		version int16
+		raw     []byte
+		want    []AclBinding
+	}{
+		{
+			name:    "create v0",
+			decode:  createAcls,
+			version: 0,
+			raw:     cat(int32s(1), []byte{2}, str("orders"), str("User:alice"), str("*"), []byte{4, 3}),
+			want:    []AclBinding{writeTopicAcl},
+		},
+		{
+			name:    "create v1 prefixed",
+			decode:  createAcls,
+			version: 1,
+			raw:     cat(int32s(1), []byte{3}, str("app-"), []byte{4}, str("User:bob"), str("10.0.0.1"), []byte{3, 2}),
+			want: []AclBinding{{
+				ResourceType: "GROUP", ResourceName: "app-", PatternType: "PREFIXED",
+				Principal: "User:bob", Host: "10.0.0.1", Operation: "READ", PermissionType: "DENY",
+			}},
+		},
+		{
+			name:    "create v2 flexible",
+			decode:  createAcls,
+			version: 2,
+			raw:     cat([]byte{2, 2}, compactStr("orders"), []byte{3}, compactStr("User:alice"), compactStr("*"), []byte{4, 3, 0}, []byte{0}),
+			want:    []AclBinding{writeTopicAcl},
+		},
+		{
+			name:    "create unknown enums",
+			decode:  createAcls,
+			version: 1,
+			raw:     cat(int32s(1), []byte{42}, str("x"), []byte{9}, str("User:x"), str("*"), []byte{0x7f, 0xff}),
+			want: []AclBinding{{
+				ResourceType: "UNKNOWN(42)", ResourceName: "x", PatternType: "UNKNOWN(9)",
+				Principal: "User:x", Host: "*", Operation: "UNKNOWN(127)", PermissionType: "UNKNOWN(-1)",
+			}},
+		},
+		{
+			name:    "delete v1 null filters",
+			decode:  deleteAcls,
+			version: 1,
+			raw:     cat(int32s(1), []byte{2}, str("orders"), []byte{1}, int16s(-1), int16s(-1), []byte{1, 1}),
+			want: []AclBinding{{
+				ResourceType: "TOPIC", ResourceName: "orders", PatternType: "ANY",
+				Operation: "ANY", PermissionType: "ANY",
+			}},
+		},
+		{
+			name:    "delete v2 flexible",
+			decode:  deleteAcls,
+			version: 2,
+			raw:     cat([]byte{3, 1}, []byte{0}, []byte{2}, compactStr("User:alice"), []byte{0}, []byte{4, 3, 0}, []byte{1}, compactStr("orders"), []byte{3}, []byte{0, 0}, []byte{2, 2, 0}, []byte{0}),
+			want: []AclBinding{
+				{ResourceType: "ANY", PatternType: "MATCH", Principal: "User:alice", Operation: "WRITE", PermissionType: "ALLOW"},
+				{ResourceType: "ANY", ResourceName: "orders", PatternType: "LITERAL", Operation: "ALL", PermissionType: "DENY"},
+			},
+		},
+		{
+			name:    "delete no filters",
+			decode:  deleteAcls,
+			version: 0,
+			raw:     int32s(0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.decode(tt.raw, tt.version)
+			if err != nil {
+				t.Fatalf("decoding % x: %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAclsTruncated(t *testing.T) {
+	raw := cat(int32s(1), []byte{2}, str("orders"), []byte{3}, str("User:alice"), str("*"), []byte{4, 3})
+	for n := 0; n < len(raw); n++ {
+		var create CreateAclsRequest
+		if err := create.Decode(NewPacketDecoder(raw[:n]), 1); err == nil {
+			t.Errorf("create acls of % x decoded without error", raw[:n])
+		}
+		var del DeleteAclsRequest
+		if err := del.Decode(NewPacketDecoder(raw[:n]), 1); err == nil {
+			t.Errorf("delete acls of % x decoded without error", raw[:n])
+		}
+	}
+}
+
+func TestAclTopics(t *testing.T) {
+	r := CreateAclsRequest{Creations: []AclBinding{
+		writeTopicAcl,
+		{ResourceType: "GROUP", ResourceName: "app"},
+		{ResourceType: "TOPIC", ResourceName: ""},
+	}}
+	if topics := r.ExtractTopics(); !reflect.DeepEqual(topics, []string{"orders"}) {
+		t.Errorf("topics are %v, want [orders]", topics)
+	}
+}
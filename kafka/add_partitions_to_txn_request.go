@@ -0,0 +1,161 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// AddPartitionsToTxnRequest is sent by transactional producers before they first produce to a
+// partition in a transaction. Up to v3 it carries a single transaction, v4+ is sent by
+// brokers and batches several transactions.
+type AddPartitionsToTxnRequest struct {
+	Version      int16
+	Transactions []AddPartitionsToTxnTransaction
+}
+
+// AddPartitionsToTxnTransaction contains the partitions added to a transaction
+type AddPartitionsToTxnTransaction struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	VerifyOnly      bool // v4+
+	Topics          []AddPartitionsToTxnTopic
+}
+
+// AddPartitionsToTxnTopic contains the partitions of a topic
+type AddPartitionsToTxnTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+// key returns the Kafka API key for AddPartitionsToTxn
+func (r *AddPartitionsToTxnRequest) key() int16 {
+	return 24
+}
+
+// version returns the Kafka request version
+func (r *AddPartitionsToTxnRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *AddPartitionsToTxnRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_11_0_0
+	case 1:
+		return V2_0_0_0
+	case 2:
+		return V2_7_0_0
+	default:
+		return V3_0_0_0
+	}
+}
+
+// Decode deserializes an AddPartitionsToTxn request from the given PacketDecoder
+func (r *AddPartitionsToTxnRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if version >= 4 {
+		txnCount, err := decodeArrayLength(pd, flexible)
+		if err != nil {
+			return fieldError("transaction array", err)
+		}
+		if txnCount > 0 {
+			r.Transactions = make([]AddPartitionsToTxnTransaction, txnCount)
+		}
+		for i := range r.Transactions {
+			if err = r.Transactions[i].decode(pd, version, flexible); err != nil {
+				return err
+			}
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	} else {
+		r.Transactions = make([]AddPartitionsToTxnTransaction, 1)
+		if err = r.Transactions[0].decode(pd, version, flexible); err != nil {
+			return err
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (t *AddPartitionsToTxnTransaction) decode(pd PacketDecoder, version int16, flexible bool) (err error) {
+	if t.TransactionalID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("transactional id", err)
+	}
+	t.TransactionalID = BoundString("transactional_id", t.TransactionalID)
+
+	if t.ProducerID, err = pd.getInt64(); err != nil {
+		return fieldError("producer id", err)
+	}
+
+	if t.ProducerEpoch, err = pd.getInt16(); err != nil {
+		return fieldError("producer epoch", err)
+	}
+
+	if version >= 4 {
+		if t.VerifyOnly, err = pd.getBool(); err != nil {
+			return fieldError("verify only", err)
+		}
+	}
+
+	topicCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		t.Topics = make([]AddPartitionsToTxnTopic, topicCount)
+	}
+	for i := range t.Topics {
+		topic := &t.Topics[i]
+
+		if topic.Topic, err = decodeString(pd, flexible); err != nil {
+			return fieldError("topic name", err)
+		}
+
+		if flexible {
+			topic.Partitions, err = pd.getCompactInt32Array()
+		} else {
+			topic.Partitions, err = pd.getInt32Array()
+		}
+		if err != nil {
+			return fieldError("partition array", err)
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExtractTopics returns the topics added to the transactions
+func (r *AddPartitionsToTxnRequest) ExtractTopics() []string {
+	seen := make(map[string]bool)
+	topics := []string{}
+	for _, txn := range r.Transactions {
+		for _, topic := range txn.Topics {
+			if !seen[topic.Topic] {
+				seen[topic.Topic] = true
+				topics = append(topics, topic.Topic)
+			}
+		}
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *AddPartitionsToTxnRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	for _, txn := range r.Transactions {
+		storage.AddTransactionalProducerInfo(clientIP, txn.TransactionalID)
+	}
+}
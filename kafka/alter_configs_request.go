@@ -0,0 +1,192 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// RedactedConfigValue replaces the values of altered configs unless CaptureConfigValues is set
+const RedactedConfigValue = "<redacted>"
+
+// CaptureConfigValues keeps the values of configs altered by AlterConfigs and
+// IncrementalAlterConfigs requests. They may be secrets (e.g. SSL or SASL JAAS passwords),
+// so they are redacted by default.
+var CaptureConfigValues bool
+
+// Operations of IncrementalAlterConfigs entries
+const (
+	ConfigOpSet      int8 = 0
+	ConfigOpDelete   int8 = 1
+	ConfigOpAppend   int8 = 2
+	ConfigOpSubtract int8 = 3
+)
+
+// configOpNames are the names of IncrementalAlterConfigs operations
+var configOpNames = []string{"SET", "DELETE", "APPEND", "SUBTRACT"}
+
+// AlterConfigsRequest replaces the configs of resources
+type AlterConfigsRequest struct {
+	Version      int16
+	Resources    []AlterConfigsResource
+	ValidateOnly bool
+}
+
+// AlterConfigsResource contains the altered configs of a resource
+type AlterConfigsResource struct {
+	ResourceType int8 // one of the ConfigResource types
+	ResourceName string
+	Configs      []AlterConfigsEntry
+}
+
+// AlterConfigsEntry is an altered config
+type AlterConfigsEntry struct {
+	Name string
+	// Operation is SET for AlterConfigs, which sets every config of the resource
+	Operation string
+	// Value is RedactedConfigValue unless CaptureConfigValues is set, empty for a null value
+	Value string
+}
+
+// key returns the Kafka API key for AlterConfigs
+func (r *AlterConfigsRequest) key() int16 {
+	return 33
+}
+
+// version returns the Kafka request version
+func (r *AlterConfigsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *AlterConfigsRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_11_0_0
+	case 1:
+		return V2_0_0_0
+	default:
+		return V2_4_0_0
+	}
+}
+
+// Decode deserializes an AlterConfigs request from the given PacketDecoder
+func (r *AlterConfigsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.Resources, err = decodeAlterConfigsResources(pd, flexible, false); err != nil {
+		return err
+	}
+
+	if r.ValidateOnly, err = pd.getBool(); err != nil {
+		return fieldError("validate only", err)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// decodeAlterConfigsResources decodes the resources of AlterConfigs, or of
+// IncrementalAlterConfigs whose entries have an operation
+func decodeAlterConfigsResources(pd PacketDecoder, flexible, incremental bool) ([]AlterConfigsResource, error) {
+	resourceCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return nil, fieldError("resource array", err)
+	}
+
+	var resources []AlterConfigsResource
+	if resourceCount > 0 {
+		resources = make([]AlterConfigsResource, resourceCount)
+	}
+	for i := range resources {
+		resource := &resources[i]
+
+		if resource.ResourceType, err = pd.getInt8(); err != nil {
+			return nil, fieldError("resource type", err)
+		}
+
+		if resource.ResourceName, err = decodeString(pd, flexible); err != nil {
+			return nil, fieldError("resource name", err)
+		}
+		resource.ResourceName = BoundString("resource_name", resource.ResourceName)
+
+		configCount, err := decodeArrayLength(pd, flexible)
+		if err != nil {
+			return nil, fieldError("config array", err)
+		}
+		if configCount > 0 {
+			resource.Configs = make([]AlterConfigsEntry, configCount)
+		}
+		for j := range resource.Configs {
+			if resource.Configs[j], err = decodeAlterConfigsEntry(pd, flexible, incremental); err != nil {
+				return nil, err
+			}
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+func decodeAlterConfigsEntry(pd PacketDecoder, flexible, incremental bool) (e AlterConfigsEntry, err error) {
+	if e.Name, err = decodeString(pd, flexible); err != nil {
+		return e, fieldError("config name", err)
+	}
+	e.Name = BoundString("config_name", e.Name)
+
+	e.Operation = configOpNames[ConfigOpSet]
+	if incremental {
+		op, err := pd.getInt8()
+		if err != nil {
+			return e, fieldError("config operation", err)
+		}
+		e.Operation = enumName(configOpNames, op)
+	}
+
+	if e.Value, err = decodeNullableString(pd, flexible); err != nil {
+		return e, fieldError("config value", err)
+	}
+	if CaptureConfigValues {
+		e.Value = BoundString("config_value", e.Value)
+	} else if e.Value != "" {
+		e.Value = RedactedConfigValue
+	}
+
+	if flexible {
+		err = pd.getTaggedFields()
+	}
+	return e, err
+}
+
+// ExtractTopics returns the topics whose configs are altered
+func (r *AlterConfigsRequest) ExtractTopics() []string {
+	return alteredConfigTopics(r.Resources)
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *AlterConfigsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	countAlteredConfigs(clientIP, r.Resources)
+}
+
+// alteredConfigTopics returns the topic resources of AlterConfigs and IncrementalAlterConfigs requests
+func alteredConfigTopics(resources []AlterConfigsResource) []string {
+	topics := []string{}
+	for _, resource := range resources {
+		if resource.ResourceType == ConfigResourceTopic {
+			topics = append(topics, resource.ResourceName)
+		}
+	}
+	return topics
+}
+
+// countAlteredConfigs counts the resources of AlterConfigs and IncrementalAlterConfigs requests
+func countAlteredConfigs(clientIP string, resources []AlterConfigsResource) {
+	for _, resource := range resources {
+		metrics.AlterConfigsTotal.WithLabelValues(clientIP, ConfigResourceTypeName(resource.ResourceType)).Inc()
+	}
+}
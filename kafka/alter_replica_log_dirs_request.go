@@ -0,0 +1,98 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// AlterReplicaLogDirsRequest is used to move replicas between log directories of a broker
+type AlterReplicaLogDirsRequest struct {
+	Version int16
+	Dirs    []AlterReplicaLogDir
+}
+
+// AlterReplicaLogDir contains the destination path and the partitions moved to it
+type AlterReplicaLogDir struct {
+	Path   string
+	Topics []LogDirTopic
+}
+
+// key returns the Kafka API key for AlterReplicaLogDirs
+func (r *AlterReplicaLogDirsRequest) key() int16 {
+	return 34
+}
+
+// version returns the Kafka request version
+func (r *AlterReplicaLogDirsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *AlterReplicaLogDirsRequest) requiredVersion() Version {
+	return V1_0_0_0
+}
+
+// Decode deserializes an AlterReplicaLogDirs request from the given PacketDecoder
+func (r *AlterReplicaLogDirsRequest) Decode(pd PacketDecoder, version int16) error {
+	r.Version = version
+	flexible := version >= 2
+
+	dirCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("log dir array", err)
+	}
+
+	if dirCount > 0 {
+		r.Dirs = make([]AlterReplicaLogDir, dirCount)
+	}
+	for i := range r.Dirs {
+		if err := r.Dirs[i].decode(pd, flexible); err != nil {
+			return err
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (d *AlterReplicaLogDir) decode(pd PacketDecoder, flexible bool) (err error) {
+	if d.Path, err = decodeString(pd, flexible); err != nil {
+		return fieldError("log dir path", err)
+	}
+
+	topicCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		d.Topics = make([]LogDirTopic, topicCount)
+	}
+	for i := range d.Topics {
+		if err = d.Topics[i].decode(pd, flexible); err != nil {
+			return err
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *AlterReplicaLogDirsRequest) ExtractTopics() []string {
+	var topics []string
+	for _, dir := range r.Dirs {
+		for _, topic := range dir.Topics {
+			topics = append(topics, topic.Topic)
+		}
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *AlterReplicaLogDirsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.LogDirOpTotal.WithLabelValues(clientIP, "alter").Inc()
+}
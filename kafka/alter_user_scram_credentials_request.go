@@ -0,0 +1,113 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// AlterUserScramCredentialsRequest is used to create, update or delete SCRAM credentials of users
+type AlterUserScramCredentialsRequest struct {
+	Version    int16
+	Deletions  []ScramCredentialAlteration
+	Upsertions []ScramCredentialAlteration
+}
+
+// ScramCredentialAlteration is a credential change of a user. The salt and salted password
+// of upsertions are skipped on purpose, they are never kept in memory.
+type ScramCredentialAlteration struct {
+	User      string
+	Mechanism string
+	// Iterations is only set for upsertions
+	Iterations int32
+}
+
+// scramMechanisms maps the mechanism ids of the SCRAM credential APIs to their names
+var scramMechanisms = map[int8]string{
+	1: "SCRAM-SHA-256",
+	2: "SCRAM-SHA-512",
+}
+
+// key returns the Kafka API key for AlterUserScramCredentials
+func (r *AlterUserScramCredentialsRequest) key() int16 {
+	return 51
+}
+
+// version returns the Kafka request version
+func (r *AlterUserScramCredentialsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *AlterUserScramCredentialsRequest) requiredVersion() Version {
+	return V2_7_0_0
+}
+
+// Decode deserializes an AlterUserScramCredentials request from the given PacketDecoder.
+// Every version of the request is flexible.
+func (r *AlterUserScramCredentialsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+
+	if r.Deletions, err = decodeScramAlterations(pd, false); err != nil {
+		return fieldError("deletion array", err)
+	}
+
+	if r.Upsertions, err = decodeScramAlterations(pd, true); err != nil {
+		return fieldError("upsertion array", err)
+	}
+
+	return pd.getTaggedFields()
+}
+
+func decodeScramAlterations(pd PacketDecoder, upsertion bool) ([]ScramCredentialAlteration, error) {
+	count, err := pd.getCompactArrayLength()
+	if err != nil || count <= 0 {
+		return nil, err
+	}
+
+	alterations := make([]ScramCredentialAlteration, count)
+	for i := range alterations {
+		a := &alterations[i]
+
+		user, err := pd.getCompactString()
+		if err != nil {
+			return nil, err
+		}
+		a.User = BoundString("scram_user", user)
+
+		mechanism, err := pd.getInt8()
+		if err != nil {
+			return nil, err
+		}
+		a.Mechanism = scramMechanismName(mechanism)
+
+		if upsertion {
+			if a.Iterations, err = pd.getInt32(); err != nil {
+				return nil, err
+			}
+			// salt and salted password
+			if _, err = pd.getCompactBytes(); err != nil {
+				return nil, err
+			}
+			if _, err = pd.getCompactBytes(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = pd.getTaggedFields(); err != nil {
+			return nil, err
+		}
+	}
+
+	return alterations, nil
+}
+
+// scramMechanismName returns the name of a SCRAM mechanism id
+func scramMechanismName(mechanism int8) string {
+	if name, ok := scramMechanisms[mechanism]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *AlterUserScramCredentialsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.ScramCredentialOpTotal.WithLabelValues("delete").Add(float64(len(r.Deletions)))
+	metrics.ScramCredentialOpTotal.WithLabelValues("upsert").Add(float64(len(r.Upsertions)))
+}
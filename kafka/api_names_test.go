@@ -0,0 +1,35 @@
+package kafka
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApiNamesMatchDecoders(t *testing.T) {
+	for key := int16(0); key <= 75; key++ {
+		name := ApiName(key)
+		if strings.HasPrefix(name, "Unknown") {
+			t.Errorf("key %d has no name", key)
+		}
+
+		for version := int16(0); version <= 16; version++ {
+			body := allocateBody(key, version)
+			if body == nil {
+				continue
+			}
+			if body.key() != key {
+				t.Errorf("key %d (%s) v%d is decoded as the body of key %d (%s)",
+					key, name, version, body.key(), ApiName(body.key()))
+			}
+		}
+	}
+}
+
+func TestApiNameOfUnknownKey(t *testing.T) {
+	if name := ApiName(-1); name != "Unknown(-1)" {
+		t.Errorf("ApiName(-1) = %q, want Unknown(-1)", name)
+	}
+	if KnownApiKey(999) {
+		t.Error("key 999 is known")
+	}
+}
@@ -1,7 +1,6 @@
 package kafka
 
 import (
-	"fmt"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
@@ -29,58 +28,42 @@ func (r *ApiVersionsRequest) requiredVersion() Version {
 }
 
 // Decode deserializes an ApiVersions request from the given PacketDecoder
-func (r *ApiVersionsRequest) Decode(pd PacketDecoder, version int16) error {
+func (r *ApiVersionsRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	// Store version for metrics
 	r.Version = version
 
-	// Safety check to prevent panic
-	if pd == nil {
+	if !isFlexible(r.key(), version) {
+		// v0-v2 have an empty body
 		return nil
 	}
 
-	// Version 3 added client software name and version - attempt to decode but don't fail on errors
-	if version >= 3 && pd.remaining() > 0 {
-		// Use recover to handle any panics during parsing
-		func() {
-			defer func() {
-				recover() // Catch any panics
-			}()
-			
-			clientSoftwareName, err := pd.getNullableString()
-			if err == nil && clientSoftwareName != nil {
-				r.ClientSoftwareName = *clientSoftwareName
-			}
-
-			clientSoftwareVersion, err := pd.getNullableString()
-			if err == nil && clientSoftwareVersion != nil {
-				r.ClientSoftwareVersion = *clientSoftwareVersion
-			}
-		}()
+	clientSoftwareName, err := pd.getCompactString()
+	if err != nil {
+		return fieldError("client software name", err)
 	}
+	r.ClientSoftwareName = BoundString("client_software_name", clientSoftwareName)
 
-	// Skip any remaining bytes to be forward compatible
-	if pd.remaining() > 0 {
-		_, err := pd.getRawBytes(pd.remaining())
-		if err != nil {
-			return err
-		}
+	clientSoftwareVersion, err := pd.getCompactString()
+	if err != nil {
+		return fieldError("client software version", err)
 	}
+	r.ClientSoftwareVersion = BoundString("client_software_version", clientSoftwareVersion)
 
-	return nil
+	return pd.getTaggedFields()
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *ApiVersionsRequest) CollectClientMetrics(clientIP string) {
-	// Include API version in metrics
-	versionStr := fmt.Sprintf("%d", r.Version)
-	metrics.RequestsCount.WithLabelValues(clientIP, "api_versions", versionStr).Inc()
-	
+func (r *ApiVersionsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	// RequestsCount is already counted with the request header
+
 	// If we have client software information, track it in the metrics
 	if r.ClientSoftwareName != "" {
 		metricsClientName := r.ClientSoftwareName
 		metricsClientVersion := r.ClientSoftwareVersion
-		
-		// Track client software info in metrics
+
+		// Track client software info in metrics, the counter of requests and the expiring
+		// gauge of the software currently in use
 		metrics.ClientSoftwareInfo.WithLabelValues(clientIP, metricsClientName, metricsClientVersion).Inc()
+		storage.SetClientSoftware(clientIP, metricsClientName, metricsClientVersion)
 	}
 }
\ No newline at end of file
@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -15,105 +16,98 @@ type AuthSession struct {
 	Timestamp  time.Time
 }
 
-var (
-	// Global auth session tracker
-	authSessions     = make(map[string]*AuthSession)
+// AuthTracker correlates SASL handshakes and authentications with client addresses, so that
+// the username of a client is known on its other connections
+type AuthTracker struct {
+	mu       sync.RWMutex
+	sessions map[string]*AuthSession
 	// Track usernames by base IP (without port)
-	ipToUsername     = make(map[string]string)
-	authSessionsLock sync.RWMutex
-)
+	ipToUsername map[string]string
+}
+
+// NewAuthTracker returns an empty tracker
+func NewAuthTracker() *AuthTracker {
+	return &AuthTracker{
+		sessions:     make(map[string]*AuthSession),
+		ipToUsername: make(map[string]string),
+	}
+}
 
-// extractBaseIP extracts the base IP address from a "ip:port" string
+// defaultAuthTracker backs the package-level functions
+var defaultAuthTracker = NewAuthTracker()
+
+// DefaultAuthTracker returns the tracker used by the package-level functions
+func DefaultAuthTracker() *AuthTracker {
+	return defaultAuthTracker
+}
+
+// extractBaseIP returns the IP address of a client address without its port, so that
+// "10.0.0.1:9092", "[2001:db8::1]:9092" and "2001:db8::1" map to the same key as the bare
+// address. IP addresses are normalized, e.g. "2001:0db8::0001" becomes "2001:db8::1".
 func extractBaseIP(addr string) string {
-	parts := strings.Split(addr, ":")
-	if len(parts) > 0 {
-		// If IPv6 address, handle differently
-		if strings.Count(addr, ":") > 1 && (strings.HasPrefix(addr, "[") || !strings.Contains(addr, ".")) {
-			// For IPv6, find the last colon if not surrounded by brackets
-			if strings.HasPrefix(addr, "[") && strings.Contains(addr, "]") {
-				parts := strings.Split(addr, "]")
-				if len(parts) > 0 {
-					return strings.TrimPrefix(parts[0], "[")
-				}
-			}
-			// Just return the raw IPv6 address for now
-			return addr
-		}
-		return parts[0] // Return just the IP part for IPv4
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		// no port: a bare IPv4 or IPv6 address, possibly in brackets
+		host = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
 	}
-	return addr
+	return host
 }
 
-// StoreAuthHandshake records a SASL handshake for later correlation with authentication data
-func StoreAuthHandshake(clientAddr, mechanism string) {
-	authSessionsLock.Lock()
-	defer authSessionsLock.Unlock()
-	
+// StoreHandshake records a SASL handshake for later correlation with authentication data
+func (t *AuthTracker) StoreHandshake(clientAddr, mechanism string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	// Create a new auth session
-	authSessions[clientAddr] = &AuthSession{
+	t.sessions[clientAddr] = &AuthSession{
 		ClientAddr: clientAddr,
 		Mechanism:  mechanism,
 		Timestamp:  time.Now(),
 	}
-	
-	// Debug output is now removed
-		
+
 	// Clean up old sessions - keep map from growing unbounded
-	cleanupOldSessions()
+	t.cleanupOldSessions()
 }
 
-// UpdateAuthSession adds username information to an existing session
-func UpdateAuthSession(clientAddr, username string) bool {
-	authSessionsLock.Lock()
-	defer authSessionsLock.Unlock()
-	
-	// Updating auth session with username
-	
-	session, exists := authSessions[clientAddr]
+// UpdateSession adds username information to an existing session
+func (t *AuthTracker) UpdateSession(clientAddr, username string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Even if there's no session, still map the base IP to username
+	t.ipToUsername[extractBaseIP(clientAddr)] = username
+
+	session, exists := t.sessions[clientAddr]
 	if !exists {
-		// Even if there's no session, still map the base IP to username
-		baseIP := extractBaseIP(clientAddr)
-		ipToUsername[baseIP] = username
-		// No session found but still mapped base IP to username
 		return true
 	}
-	
+
 	// Update with username
 	session.Username = username
-	
-	// Also store by base IP for easier lookup
-	baseIP := extractBaseIP(clientAddr)
-	ipToUsername[baseIP] = username
-	
+
 	// Log the complete authentication
 	fmt.Printf("[AUTHENTICATION COMPLETE] Client %s authenticated as '%s' using mechanism '%s'\n",
 		clientAddr, username, session.Mechanism)
-	// Mapped base IP to username
-	
-	// Debug log the current state of ipToUsername map
-	// Auth tracker username mappings initialized
-		
+
 	return true
 }
 
-// GetAuthSession retrieves auth session information for a client
-func GetAuthSession(clientAddr string) (*AuthSession, bool) {
-	authSessionsLock.RLock()
-	defer authSessionsLock.RUnlock()
-	
+// GetSession retrieves auth session information for a client
+func (t *AuthTracker) GetSession(clientAddr string) (*AuthSession, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
 	// First try exact match
-	session, exists := authSessions[clientAddr]
-	if exists {
-		// Found exact session match
+	if session, exists := t.sessions[clientAddr]; exists {
 		return session, true
 	}
-	
+
 	// If not found, try matching by base IP
-	baseIP := extractBaseIP(clientAddr)
-	username, exists := ipToUsername[baseIP]
-	if exists {
-		// Found username for base IP
-		
+	if username, exists := t.ipToUsername[extractBaseIP(clientAddr)]; exists {
 		// Create a synthetic session with the username
 		return &AuthSession{
 			ClientAddr: clientAddr,
@@ -121,39 +115,45 @@ func GetAuthSession(clientAddr string) (*AuthSession, bool) {
 			Timestamp:  time.Now(),
 		}, true
 	}
-	
-	// No session found
+
 	return nil, false
 }
 
 // GetUsernameByIP gets a username using just the IP part of the address
-func GetUsernameByIP(clientAddr string) string {
-	authSessionsLock.RLock()
-	defer authSessionsLock.RUnlock()
-	
-	// Extract base IP (no port)
-	baseIP := extractBaseIP(clientAddr)
-	
-	// Debug log the current ipToUsername map
-	// Looking up username by IP address
-	
-	// Try to find username by base IP
-	if username, exists := ipToUsername[baseIP]; exists {
-		// Found username for IP
-		return username
-	}
-	
-	// No username found for IP
-	return ""
+func (t *AuthTracker) GetUsernameByIP(clientAddr string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.ipToUsername[extractBaseIP(clientAddr)]
 }
 
-// cleanupOldSessions removes sessions older than 5 minutes
-func cleanupOldSessions() {
+// cleanupOldSessions removes sessions older than 5 minutes, the caller holds the lock
+func (t *AuthTracker) cleanupOldSessions() {
 	now := time.Now()
-	for addr, session := range authSessions {
+	for addr, session := range t.sessions {
 		if now.Sub(session.Timestamp) > 5*time.Minute {
-			delete(authSessions, addr)
+			delete(t.sessions, addr)
 			// Don't clean up ipToUsername map - we want to keep these mappings longer
 		}
 	}
 }
+
+// StoreAuthHandshake records a SASL handshake in the default tracker
+func StoreAuthHandshake(clientAddr, mechanism string) {
+	defaultAuthTracker.StoreHandshake(clientAddr, mechanism)
+}
+
+// UpdateAuthSession adds username information to a session of the default tracker
+func UpdateAuthSession(clientAddr, username string) bool {
+	return defaultAuthTracker.UpdateSession(clientAddr, username)
+}
+
+// GetAuthSession retrieves auth session information for a client from the default tracker
+func GetAuthSession(clientAddr string) (*AuthSession, bool) {
+	return defaultAuthTracker.GetSession(clientAddr)
+}
+
+// GetUsernameByIP gets a username from the default tracker using just the IP part of the address
+func GetUsernameByIP(clientAddr string) string {
+	return defaultAuthTracker.GetUsernameByIP(clientAddr)
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import "testing"
+
+func TestExtractBaseIP(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.0.0.1:9092", "10.0.0.1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"[2001:db8::1]:9092", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"2001:0db8::0001", "2001:db8::1"},
+		{"::1", "::1"},
+		{"[::1]:50000", "::1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"broker.example.com:9092", "broker.example.com"},
+		{"anon-0123456789abcdef", "anon-0123456789abcdef"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := extractBaseIP(tt.addr); got != tt.want {
+			t.Errorf("extractBaseIP(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestUsernameByIPAcrossAddressForms(t *testing.T) {
+	tracker := NewAuthTracker()
+	tracker.StoreHandshake("[2001:db8::1]:50000", "PLAIN")
+	tracker.UpdateSession("[2001:db8::1]:50000", "alice")
+
+	for _, addr := range []string{"2001:db8::1", "[2001:db8::1]:50001", "2001:0db8::0001"} {
+		if username := tracker.GetUsernameByIP(addr); username != "alice" {
+			t.Errorf("username of %s is %q, want alice", addr, username)
+		}
+	}
+}
+
+func TestIndependentTrackers(t *testing.T) {
+	first, second := NewAuthTracker(), NewAuthTracker()
+
+	first.StoreHandshake("10.0.0.1:50000", "PLAIN")
+	first.UpdateSession("10.0.0.1:50000", "alice")
+	second.UpdateSession("10.0.0.2:50000", "bob")
+
+	if username := first.GetUsernameByIP("10.0.0.1"); username != "alice" {
+		t.Errorf("username of the first tracker is %q, want alice", username)
+	}
+	if username := second.GetUsernameByIP("10.0.0.1"); username != "" {
+		t.Errorf("second tracker has username %q of the first one", username)
+	}
+	if _, found := second.GetSession("10.0.0.1:50000"); found {
+		t.Error("second tracker has the session of the first one")
+	}
+	if username := first.GetUsernameByIP("10.0.0.2"); username != "" {
+		t.Errorf("first tracker has username %q of the second one", username)
+	}
+	if username := GetUsernameByIP("10.0.0.1"); username != "" {
+		t.Errorf("default tracker has username %q of an injected one", username)
+	}
+}
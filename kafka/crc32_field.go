@@ -58,7 +58,7 @@ func (c *crc32Field) check(curOffset int, buf []byte) error {
 
 	expected := binary.BigEndian.Uint32(buf[c.startOffset:])
 	if crc != expected {
-		return PacketDecodingError{fmt.Sprintf("CRC didn't match expected %#x got %#x", expected, crc)}
+		return PacketDecodingError{Info: fmt.Sprintf("CRC didn't match expected %#x got %#x", expected, crc)}
 	}
 
 	return nil
@@ -71,7 +71,7 @@ func (c *crc32Field) crc(curOffset int, buf []byte) (uint32, error) {
 	case crcCastagnoli:
 		tab = castagnoliTable
 	default:
-		return 0, PacketDecodingError{"invalid CRC type"}
+		return 0, PacketDecodingError{Info: "invalid CRC type"}
 	}
 	return crc32.Checksum(buf[c.startOffset+4:curOffset], tab), nil
 }
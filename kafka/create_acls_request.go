@@ -0,0 +1,63 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// CreateAclsRequest creates ACLs
+type CreateAclsRequest struct {
+	Version   int16
+	Creations []AclBinding
+}
+
+// key returns the Kafka API key for CreateAcls
+func (r *CreateAclsRequest) key() int16 {
+	return 30
+}
+
+// version returns the Kafka request version
+func (r *CreateAclsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *CreateAclsRequest) requiredVersion() Version {
+	return aclRequiredVersion(r.Version)
+}
+
+// Decode deserializes a CreateAcls request from the given PacketDecoder
+func (r *CreateAclsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.Creations, err = decodeAclBindings(pd, version, flexible, false); err != nil {
+		return err
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns the topics of the created ACLs
+func (r *CreateAclsRequest) ExtractTopics() []string {
+	return aclTopics(r.Creations)
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *CreateAclsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	for _, acl := range r.Creations {
+		metrics.AclChangesTotal.WithLabelValues(clientIP, "create", acl.ResourceType).Inc()
+	}
+}
+
+// aclTopics returns the topic resource names of ACLs
+func aclTopics(acls []AclBinding) []string {
+	topics := []string{}
+	for _, acl := range acls {
+		if acl.ResourceType == "TOPIC" && acl.ResourceName != "" {
+			topics = append(topics, acl.ResourceName)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,144 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// CreatePartitionsRequest is used to increase the partition count of topics
+type CreatePartitionsRequest struct {
+	Version      int16
+	Topics       []CreatePartitionsTopic
+	Timeout      int32
+	ValidateOnly bool
+}
+
+// CreatePartitionsTopic contains the new partition count of a topic
+type CreatePartitionsTopic struct {
+	Topic string
+	Count int32
+	// Assignments holds the broker ids of each new partition, nil if left to the broker
+	Assignments [][]int32
+}
+
+// key returns the Kafka API key for CreatePartitions
+func (r *CreatePartitionsRequest) key() int16 {
+	return 37
+}
+
+// version returns the Kafka request version
+func (r *CreatePartitionsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *CreatePartitionsRequest) requiredVersion() Version {
+	return V1_0_0_0
+}
+
+// Decode deserializes a CreatePartitions request from the given PacketDecoder
+func (r *CreatePartitionsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := version >= 2
+
+	var topicCount int
+	if flexible {
+		topicCount, err = pd.getCompactArrayLength()
+	} else {
+		topicCount, err = pd.getArrayLength()
+	}
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		r.Topics = make([]CreatePartitionsTopic, topicCount)
+	}
+	for i := range r.Topics {
+		if err = r.Topics[i].decode(pd, flexible); err != nil {
+			return err
+		}
+	}
+
+	if r.Timeout, err = pd.getInt32(); err != nil {
+		return fieldError("timeout", err)
+	}
+
+	if r.ValidateOnly, err = pd.getBool(); err != nil {
+		return fieldError("validate only", err)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (t *CreatePartitionsTopic) decode(pd PacketDecoder, flexible bool) (err error) {
+	var assignmentCount int
+	if flexible {
+		if t.Topic, err = pd.getCompactString(); err != nil {
+			return err
+		}
+	} else {
+		if t.Topic, err = pd.getString(); err != nil {
+			return err
+		}
+	}
+
+	if t.Count, err = pd.getInt32(); err != nil {
+		return err
+	}
+
+	if flexible {
+		assignmentCount, err = pd.getCompactArrayLength()
+	} else {
+		assignmentCount, err = pd.getArrayLength()
+	}
+	if err != nil {
+		return fieldError("assignment array", err)
+	}
+
+	if assignmentCount > 0 {
+		t.Assignments = make([][]int32, assignmentCount)
+	}
+	for i := range t.Assignments {
+		if flexible {
+			if t.Assignments[i], err = pd.getCompactInt32Array(); err != nil {
+				return err
+			}
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		} else {
+			if t.Assignments[i], err = pd.getInt32Array(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *CreatePartitionsRequest) ExtractTopics() []string {
+	topics := make([]string, len(r.Topics))
+	for i, topic := range r.Topics {
+		topics[i] = topic.Topic
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *CreatePartitionsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	// Validation requests don't change anything
+	if r.ValidateOnly {
+		return
+	}
+
+	for _, topic := range r.Topics {
+		metrics.SetCreatePartitionsInfo(topic.Topic, topic.Count)
+	}
+}
@@ -1,21 +1,30 @@
 package kafka
 
-import "github.com/d-ulyanov/kafka-sniffer/metrics"
+import (
+	"strconv"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
 
 // CreateTopicsRequest is used to create topics in Kafka
 type CreateTopicsRequest struct {
-	Topics                 []CreateTopicRequest
-	Timeout                int32
-	ValidateOnly           bool
+	Version      int16
+	Topics       []CreateTopicRequest
+	Timeout      int32
+	ValidateOnly bool // v1+
 }
 
 // CreateTopicRequest contains details for a single topic creation
 type CreateTopicRequest struct {
-	Topic             string
+	Topic string
+	// NumPartitions and ReplicationFactor are -1 with a replica assignment, or for the broker
+	// defaults (v4+)
 	NumPartitions     int32
 	ReplicationFactor int16
+	// ReplicaAssignment are the brokers of each partition, when set by the client
 	ReplicaAssignment map[int32][]int32
-	ConfigEntries     map[string]string
+	// ConfigEntries are the configs of the topic, a value may be empty when null
+	ConfigEntries map[string]string
 }
 
 // key returns the Kafka API key for CreateTopics
@@ -25,96 +34,136 @@ func (r *CreateTopicsRequest) key() int16 {
 
 // version returns the Kafka request version
 func (r *CreateTopicsRequest) version() int16 {
-	return 0
+	return r.Version
 }
 
 // requiredVersion states what the minimum required version is
 func (r *CreateTopicsRequest) requiredVersion() Version {
-	return V0_10_0_0
+	switch r.Version {
+	case 0:
+		return V0_10_1_0
+	case 1:
+		return V0_10_2_0
+	case 2:
+		return V0_11_0_0
+	case 3:
+		return V2_0_0_0
+	case 4, 5:
+		return V2_4_0_0
+	default:
+		return V2_7_0_0
+	}
 }
 
 // Decode deserializes a CreateTopics request from the given PacketDecoder
-func (r *CreateTopicsRequest) Decode(pd PacketDecoder, version int16) error {
-	topicCount, err := pd.getArrayLength()
+func (r *CreateTopicsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	topicCount, err := decodeArrayLength(pd, flexible)
 	if err != nil {
-		return err
+		return fieldError("topic array", err)
 	}
 
-	r.Topics = make([]CreateTopicRequest, topicCount)
+	if topicCount > 0 {
+		r.Topics = make([]CreateTopicRequest, topicCount)
+	}
 	for i := range r.Topics {
-		topic, err := pd.getString()
-		if err != nil {
+		if err = r.Topics[i].decode(pd, flexible); err != nil {
 			return err
 		}
-		r.Topics[i].Topic = topic
+	}
 
-		numPartitions, err := pd.getInt32()
-		if err != nil {
-			return err
-		}
-		r.Topics[i].NumPartitions = numPartitions
+	if r.Timeout, err = pd.getInt32(); err != nil {
+		return fieldError("timeout", err)
+	}
 
-		replicationFactor, err := pd.getInt16()
-		if err != nil {
-			return err
+	if version >= 1 {
+		if r.ValidateOnly, err = pd.getBool(); err != nil {
+			return fieldError("validate only", err)
 		}
-		r.Topics[i].ReplicationFactor = replicationFactor
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
 
-		// Skip replica assignment and config entries for simplicity
-		// In a full implementation, we would decode these fields as well
+	return nil
+}
+
+func (t *CreateTopicRequest) decode(pd PacketDecoder, flexible bool) (err error) {
+	if t.Topic, err = decodeString(pd, flexible); err != nil {
+		return fieldError("topic name", err)
+	}
+	t.Topic = BoundString("topic", t.Topic)
 
-		// Skip replica assignment
-		replicaCount, err := pd.getArrayLength()
+	if t.NumPartitions, err = pd.getInt32(); err != nil {
+		return fieldError("partition count", err)
+	}
+
+	if t.ReplicationFactor, err = pd.getInt16(); err != nil {
+		return fieldError("replication factor", err)
+	}
+
+	assignmentCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("assignment array", err)
+	}
+	if assignmentCount > 0 {
+		t.ReplicaAssignment = make(map[int32][]int32, assignmentCount)
+	}
+	for i := 0; i < assignmentCount; i++ {
+		partition, err := pd.getInt32()
 		if err != nil {
-			return err
-		}
-		for j := 0; j < replicaCount; j++ {
-			// Skip partition
-			if _, err := pd.getInt32(); err != nil {
-				return err
-			}
-			// Skip replicas array
-			replicasCount, err := pd.getArrayLength()
-			if err != nil {
-				return err
-			}
-			for k := 0; k < replicasCount; k++ {
-				if _, err := pd.getInt32(); err != nil {
-					return err
-				}
-			}
+			return fieldError("assignment partition", err)
 		}
 
-		// Skip config entries
-		configCount, err := pd.getArrayLength()
+		var brokers []int32
+		if flexible {
+			brokers, err = pd.getCompactInt32Array()
+		} else {
+			brokers, err = pd.getInt32Array()
+		}
 		if err != nil {
-			return err
+			return fieldError("assignment brokers", err)
 		}
-		for j := 0; j < configCount; j++ {
-			// Skip config name
-			if _, err := pd.getString(); err != nil {
-				return err
-			}
-			// Skip config value
-			if _, err := pd.getString(); err != nil {
+		t.ReplicaAssignment[partition] = brokers
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
 				return err
 			}
 		}
 	}
 
-	timeout, err := pd.getInt32()
+	configCount, err := decodeArrayLength(pd, flexible)
 	if err != nil {
-		return err
+		return fieldError("config array", err)
 	}
-	r.Timeout = timeout
+	if configCount > 0 {
+		t.ConfigEntries = make(map[string]string, configCount)
+	}
+	for i := 0; i < configCount; i++ {
+		name, err := decodeString(pd, flexible)
+		if err != nil {
+			return fieldError("config name", err)
+		}
 
-	// ValidateOnly is only available in version 1+
-	if version >= 1 {
-		validateOnly, err := pd.getBool()
+		value, err := decodeNullableString(pd, flexible)
 		if err != nil {
-			return err
+			return fieldError("config value", err)
 		}
-		r.ValidateOnly = validateOnly
+		t.ConfigEntries[BoundString("config_name", name)] = BoundString("config_value", value)
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
 	}
 
 	return nil
@@ -130,9 +179,14 @@ func (r *CreateTopicsRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *CreateTopicsRequest) CollectClientMetrics(clientIP string) {
-	// A client creating topics is likely to be a producer
+func (r *CreateTopicsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	validateOnly := strconv.FormatBool(r.ValidateOnly)
 	for _, topic := range r.Topics {
-		metrics.AddProducerTopicRelationInfo(clientIP, topic.Topic)
+		metrics.TopicCreateTotal.WithLabelValues(clientIP, topic.Topic, validateOnly).Inc()
+
+		// A client creating topics is likely to be a producer, unless it only validates them
+		if !r.ValidateOnly {
+			storage.AddProducerTopicRelationInfo(clientIP, topic.Topic)
+		}
 	}
 }
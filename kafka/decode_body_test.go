@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func int64s(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// fetchPartition is the block of a partition of a fetch request before v5
+func fetchPartition(partition int32, offset int64) []byte {
+	return cat(int32s(partition), int64s(offset), int32s(1<<20))
+}
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     int16
+		version int16
+		payload []byte
+		check   func(t *testing.T, body ProtocolBody)
+	}{
+		{
+			name:    "fetch v0",
+			key:     1,
+			version: 0,
+			payload: cat(int32s(-1), int32s(500), int32s(1), int32s(1), str("orders"), int32s(2), fetchPartition(0, 10), fetchPartition(1, 20)),
+			check: func(t *testing.T, body ProtocolBody) {
+				r := body.(*FetchRequest)
+				if r.FetcherType() != FetcherConsumer || r.MaxWaitTime != 500 || r.MinBytes != 1 {
+					t.Errorf("decoded %+v, want a consumer fetch waiting 500ms for 1 byte", r)
+				}
+				if topics := r.ExtractTopics(); !reflect.DeepEqual(topics, []string{"orders"}) || r.PartitionCount("orders") != 2 {
+					t.Errorf("fetched topics %v with %d partitions, want 2 partitions of orders", topics, r.PartitionCount("orders"))
+				}
+			},
+		},
+		{
+			name:    "fetch v4 of a follower",
+			key:     1,
+			version: 4,
+			payload: cat(int32s(2), int32s(500), int32s(1), int32s(1<<20), []byte{1}, int32s(2), str("orders"), int32s(1), fetchPartition(0, 10), str("payments"), int32s(1), fetchPartition(3, 0)),
+			check: func(t *testing.T, body ProtocolBody) {
+				r := body.(*FetchRequest)
+				if r.FetcherType() != FetcherFollower || r.ReplicaID != 2 || r.Isolation != 1 || r.MaxBytes != 1<<20 {
+					t.Errorf("decoded %+v, want a read committed fetch of broker 2", r)
+				}
+				topics := r.ExtractTopics()
+				sort.Strings(topics)
+				if !reflect.DeepEqual(topics, []string{"orders", "payments"}) || r.GetRequestedBlocksCount() != 2 {
+					t.Errorf("fetched topics %v with %d blocks, want a partition of orders and payments", topics, r.GetRequestedBlocksCount())
+				}
+			},
+		},
+		{
+			name:    "fetch without topics",
+			key:     1,
+			version: 3,
+			payload: cat(int32s(-1), int32s(500), int32s(1), int32s(1<<20), int32s(0)),
+			check: func(t *testing.T, body ProtocolBody) {
+				if topics := body.(*FetchRequest).ExtractTopics(); len(topics) != 0 {
+					t.Errorf("fetched topics %v, want none", topics)
+				}
+			},
+		},
+		{
+			name:    "list offsets v1",
+			key:     2,
+			version: 1,
+			payload: cat(int32s(-1), int32s(1), str("orders"), int32s(2), int32s(0), int64s(-1), int32s(1), int64s(-2)),
+			check: func(t *testing.T, body ProtocolBody) {
+				r := body.(*ListOffsetsRequest)
+				want := []ListOffsetsTopic{{Topic: "orders", Partitions: []ListOffsetsPartition{{0, -1}, {1, -2}}}}
+				if r.ReplicaID != -1 || !reflect.DeepEqual(r.Topics, want) {
+					t.Errorf("decoded %+v, want the latest and earliest offsets of orders", r)
+				}
+			},
+		},
+		{
+			name:    "list offsets of several topics",
+			key:     2,
+			version: 1,
+			payload: cat(int32s(-1), int32s(2), str("orders"), int32s(0), str("payments"), int32s(1), int32s(4), int64s(1600000000000)),
+			check: func(t *testing.T, body ProtocolBody) {
+				r := body.(*ListOffsetsRequest)
+				if topics := r.ExtractTopics(); !reflect.DeepEqual(topics, []string{"orders", "payments"}) {
+					t.Errorf("topics are %v, want [orders payments]", topics)
+				}
+				if p := r.Topics[1].Partitions; len(p) != 1 || p[0].Partition != 4 || p[0].Time != 1600000000000 {
+					t.Errorf("partitions of payments are %+v, want partition 4 by timestamp", p)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := DecodeBody(tt.key, tt.version, tt.payload)
+			if err != nil {
+				t.Fatalf("decoding % x: %v", tt.payload, err)
+			}
+			if body.key() != tt.key {
+				t.Fatalf("decoded a body of api key %d, want %d", body.key(), tt.key)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestDecodeBodyError(t *testing.T) {
+	// a fetch v0 whose partition block is cut
+	payload := cat(int32s(-1), int32s(500), int32s(1), int32s(1), str("orders"), int32s(1), int32s(0), int64s(10))
+	body, err := DecodeBody(1, 0, payload)
+	if _, ok := body.(*FetchRequest); !ok {
+		t.Errorf("decoded a %T, want the partly decoded *FetchRequest", body)
+	}
+	e, ok := err.(PacketDecodingError)
+	if !ok {
+		t.Fatalf("decoding returned %v, want a PacketDecodingError", err)
+	}
+	if !e.HasRequest || e.ApiKey != 1 || e.Version != 0 {
+		t.Errorf("error %+v doesn't name fetch v0", e)
+	}
+}
@@ -11,10 +11,49 @@ import (
 // This can be a bad CRC or length field, or any other invalid value.
 type PacketDecodingError struct {
 	Info string
+
+	// Field is the field being decoded when the error occurred, e.g. "topic array"
+	Field string
+
+	// Offset is the position of the invalid value, counted from the correlation id of the request
+	// (or from the start of the record batch for errors in records)
+	Offset int
+
+	// ApiKey and Version are the api key and version of the request, only set when HasRequest is true
+	ApiKey     int16
+	Version    int16
+	HasRequest bool
+
+	// InvalidLength is set when the size in front of the message is negative, too small or
+	// over MaxRequestSize, nothing of the message was decoded
+	InvalidLength bool
 }
 
 func (err PacketDecodingError) Error() string {
-	return fmt.Sprintf("kafka: error decoding packet: %s", err.Info)
+	var context string
+	if err.HasRequest {
+		context += fmt.Sprintf(" api key %d v%d", err.ApiKey, err.Version)
+	}
+	if err.Field != "" {
+		context += " " + err.Field
+	}
+	if err.Offset > 0 {
+		context += fmt.Sprintf(" at offset %d", err.Offset)
+	}
+
+	if context == "" {
+		return fmt.Sprintf("kafka: error decoding packet: %s", err.Info)
+	}
+	return fmt.Sprintf("kafka: error decoding packet: failed decoding%s: %s", context, err.Info)
+}
+
+// fieldError names the field being decoded in a PacketDecodingError, other errors are returned as is
+func fieldError(field string, err error) error {
+	if e, ok := err.(PacketDecodingError); ok && e.Field == "" {
+		e.Field = field
+		return e
+	}
+	return err
 }
 
 // ErrInsufficientData is returned when decoding and the packet is truncated. This can be expected
@@ -22,11 +61,11 @@ func (err PacketDecodingError) Error() string {
 // of the message set.
 var ErrInsufficientData = errors.New("kafka: insufficient data to decode packet, more bytes expected")
 
-var errInvalidArrayLength = PacketDecodingError{"invalid array length"}
-var errInvalidByteSliceLength = PacketDecodingError{"invalid byteslice length"}
-var errInvalidStringLength = PacketDecodingError{"invalid string length"}
-var errVarintOverflow = PacketDecodingError{"varint overflow"}
-var errInvalidBool = PacketDecodingError{"invalid bool"}
+var errInvalidArrayLength = PacketDecodingError{Info: "invalid array length"}
+var errInvalidByteSliceLength = PacketDecodingError{Info: "invalid byteslice length"}
+var errInvalidStringLength = PacketDecodingError{Info: "invalid string length"}
+var errVarintOverflow = PacketDecodingError{Info: "varint overflow"}
+var errInvalidBool = PacketDecodingError{Info: "invalid bool"}
 
 // PacketDecoder is the interface providing helpers for reading with Kafka's encoding rules.
 // Types implementing Decoder only need to worry about calling methods like GetString,
@@ -51,6 +90,14 @@ type PacketDecoder interface {
 	getInt64Array() ([]int64, error)
 	getStringArray() ([]string, error)
 
+	// Flexible versions (KIP-482)
+	getUVarint() (uint64, error)
+	getCompactArrayLength() (int, error)
+	getCompactString() (string, error)
+	getCompactBytes() ([]byte, error)
+	getCompactInt32Array() ([]int32, error)
+	getTaggedFields() error
+
 	// Subsets
 	remaining() int
 	getSubset(length int) (PacketDecoder, error)
@@ -120,7 +167,7 @@ func Decode(buf []byte, in decoder) error {
 	
 	// Offset should be at most the buffer length
 	if helper.off > len(buf) {
-		return PacketDecodingError{fmt.Sprintf("invalid length, read beyond buffer: expected at most %d, got: %d", len(buf), helper.off)}
+		return PacketDecodingError{Info: fmt.Sprintf("invalid length, read beyond buffer: expected at most %d, got: %d", len(buf), helper.off), Offset: helper.off}
 	}
 	
 	// Small discrepancies (less than 20 bytes) are ok for monitoring purposes
@@ -128,19 +175,69 @@ func Decode(buf []byte, in decoder) error {
 	// additional fields our decoder doesn't handle yet
 	diff := len(buf) - helper.off
 	if diff > 20 {
-		return PacketDecodingError{fmt.Sprintf("significant length mismatch: unconsumed bytes %d", diff)}
+		return PacketDecodingError{Info: fmt.Sprintf("significant length mismatch: unconsumed bytes %d", diff), Offset: helper.off}
 	}
 	
 	return nil
 }
 
-// RealDecoder implements PacketDecoder
+// decodeArrayLength reads an array length, compact when the request version is flexible
+func decodeArrayLength(pd PacketDecoder, flexible bool) (int, error) {
+	if flexible {
+		return pd.getCompactArrayLength()
+	}
+	return pd.getArrayLength()
+}
+
+// decodeString reads a string, compact when the request version is flexible
+func decodeString(pd PacketDecoder, flexible bool) (string, error) {
+	if flexible {
+		return pd.getCompactString()
+	}
+	return pd.getString()
+}
+
+// decodeNullableString reads a nullable string, compact when the request version is flexible.
+// A null string is returned as an empty one.
+func decodeNullableString(pd PacketDecoder, flexible bool) (string, error) {
+	if flexible {
+		return pd.getCompactString()
+	}
+	str, err := pd.getNullableString()
+	if err != nil || str == nil {
+		return "", err
+	}
+	return *str, nil
+}
+
+// decodeBytes reads a byte array, compact when the request version is flexible
+func decodeBytes(pd PacketDecoder, flexible bool) ([]byte, error) {
+	if flexible {
+		return pd.getCompactBytes()
+	}
+	return pd.getBytes()
+}
+
+// RealDecoder implements PacketDecoder. Reads are bounds checked, a truncated buffer returns
+// ErrInsufficientData and an invalid length a PacketDecodingError, never a panic.
 type RealDecoder struct {
 	raw   []byte
 	off   int
 	stack []PushDecoder
 }
 
+// NewPacketDecoder returns a PacketDecoder reading buf, e.g. to decode a request body with
+// its Decode method without the framing of DecodeRequest
+func NewPacketDecoder(buf []byte) PacketDecoder {
+	return &RealDecoder{raw: buf}
+}
+
+// errorAt sets the offset of a decoding error
+func (rd *RealDecoder) errorAt(off int, err PacketDecodingError) PacketDecodingError {
+	err.Offset = off
+	return err
+}
+
 // primitives
 
 func (rd *RealDecoder) getInt8() (int8, error) {
@@ -184,6 +281,7 @@ func (rd *RealDecoder) getInt64() (int64, error) {
 }
 
 func (rd *RealDecoder) getVarint() (int64, error) {
+	start := rd.off
 	tmp, n := binary.Varint(rd.raw[rd.off:])
 	if n == 0 {
 		rd.off = len(rd.raw)
@@ -191,7 +289,7 @@ func (rd *RealDecoder) getVarint() (int64, error) {
 	}
 	if n < 0 {
 		rd.off -= n
-		return -1, errVarintOverflow
+		return -1, rd.errorAt(start, errVarintOverflow)
 	}
 	rd.off += n
 	return tmp, nil
@@ -204,11 +302,14 @@ func (rd *RealDecoder) getArrayLength() (int, error) {
 	}
 	tmp := int(int32(binary.BigEndian.Uint32(rd.raw[rd.off:])))
 	rd.off += 4
-	if tmp > rd.remaining() {
+	// -1 is a null array, other negative lengths are invalid
+	if tmp < -1 {
+		return -1, rd.errorAt(rd.off-4, errInvalidArrayLength)
+	} else if tmp > rd.remaining() {
 		rd.off = len(rd.raw)
 		return -1, ErrInsufficientData
 	} else if tmp > 2*math.MaxUint16 {
-		return -1, errInvalidArrayLength
+		return -1, rd.errorAt(rd.off-4, errInvalidArrayLength)
 	}
 	return tmp, nil
 }
@@ -219,7 +320,7 @@ func (rd *RealDecoder) getBool() (bool, error) {
 		return false, err
 	}
 	if b != 1 {
-		return false, errInvalidBool
+		return false, rd.errorAt(rd.off-1, errInvalidBool)
 	}
 	return true, nil
 }
@@ -260,7 +361,7 @@ func (rd *RealDecoder) getStringLength() (int, error) {
 
 	switch {
 	case n < -1:
-		return 0, errInvalidStringLength
+		return 0, rd.errorAt(rd.off-2, errInvalidStringLength)
 	case n > rd.remaining():
 		rd.off = len(rd.raw)
 		return 0, ErrInsufficientData
@@ -296,20 +397,21 @@ func (rd *RealDecoder) getInt32Array() ([]int32, error) {
 		rd.off = len(rd.raw)
 		return nil, ErrInsufficientData
 	}
-	n := int(binary.BigEndian.Uint32(rd.raw[rd.off:]))
+	n := int(int32(binary.BigEndian.Uint32(rd.raw[rd.off:])))
 	rd.off += 4
 
-	if rd.remaining() < 4*n {
-		rd.off = len(rd.raw)
-		return nil, ErrInsufficientData
-	}
-
-	if n == 0 {
+	// -1 is a null array
+	if n == 0 || n == -1 {
 		return nil, nil
 	}
 
 	if n < 0 {
-		return nil, errInvalidArrayLength
+		return nil, rd.errorAt(rd.off-4, errInvalidArrayLength)
+	}
+
+	if rd.remaining() < 4*n {
+		rd.off = len(rd.raw)
+		return nil, ErrInsufficientData
 	}
 
 	ret := make([]int32, n)
@@ -325,20 +427,21 @@ func (rd *RealDecoder) getInt64Array() ([]int64, error) {
 		rd.off = len(rd.raw)
 		return nil, ErrInsufficientData
 	}
-	n := int(binary.BigEndian.Uint32(rd.raw[rd.off:]))
+	n := int(int32(binary.BigEndian.Uint32(rd.raw[rd.off:])))
 	rd.off += 4
 
-	if rd.remaining() < 8*n {
-		rd.off = len(rd.raw)
-		return nil, ErrInsufficientData
-	}
-
-	if n == 0 {
+	// -1 is a null array
+	if n == 0 || n == -1 {
 		return nil, nil
 	}
 
 	if n < 0 {
-		return nil, errInvalidArrayLength
+		return nil, rd.errorAt(rd.off-4, errInvalidArrayLength)
+	}
+
+	if rd.remaining() < 8*n {
+		rd.off = len(rd.raw)
+		return nil, ErrInsufficientData
 	}
 
 	ret := make([]int64, n)
@@ -354,15 +457,21 @@ func (rd *RealDecoder) getStringArray() ([]string, error) {
 		rd.off = len(rd.raw)
 		return nil, ErrInsufficientData
 	}
-	n := int(binary.BigEndian.Uint32(rd.raw[rd.off:]))
+	n := int(int32(binary.BigEndian.Uint32(rd.raw[rd.off:])))
 	rd.off += 4
 
-	if n == 0 {
+	if n == 0 || n == -1 {
 		return nil, nil
 	}
 
 	if n < 0 {
-		return nil, errInvalidArrayLength
+		return nil, rd.errorAt(rd.off-4, errInvalidArrayLength)
+	}
+
+	// each string takes at least its 2 bytes length
+	if rd.remaining() < 2*n {
+		rd.off = len(rd.raw)
+		return nil, ErrInsufficientData
 	}
 
 	ret := make([]string, n)
@@ -377,6 +486,122 @@ func (rd *RealDecoder) getStringArray() ([]string, error) {
 	return ret, nil
 }
 
+// flexible versions
+
+func (rd *RealDecoder) getUVarint() (uint64, error) {
+	start := rd.off
+	tmp, n := binary.Uvarint(rd.raw[rd.off:])
+	if n == 0 {
+		rd.off = len(rd.raw)
+		return 0, ErrInsufficientData
+	}
+	if n < 0 {
+		rd.off -= n
+		return 0, rd.errorAt(start, errVarintOverflow)
+	}
+	rd.off += n
+	return tmp, nil
+}
+
+// getCompactArrayLength returns -1 for a null array. Compact arrays store length+1 as unsigned varint.
+func (rd *RealDecoder) getCompactArrayLength() (int, error) {
+	start := rd.off
+	n, err := rd.getUVarint()
+	if err != nil {
+		return -1, err
+	}
+	if n == 0 {
+		return -1, nil
+	}
+
+	// compared unsigned, a huge length would overflow int
+	if n-1 > uint64(rd.remaining()) {
+		rd.off = len(rd.raw)
+		return -1, ErrInsufficientData
+	}
+	length := int(n - 1)
+	if length > 2*math.MaxUint16 {
+		return -1, rd.errorAt(start, errInvalidArrayLength)
+	}
+	return length, nil
+}
+
+func (rd *RealDecoder) getCompactString() (string, error) {
+	n, err := rd.getUVarint()
+	if err != nil || n == 0 {
+		return "", err
+	}
+
+	if n-1 > uint64(rd.remaining()) {
+		rd.off = len(rd.raw)
+		return "", ErrInsufficientData
+	}
+	length := int(n - 1)
+
+	tmpStr := string(rd.raw[rd.off : rd.off+length])
+	rd.off += length
+	return tmpStr, nil
+}
+
+// getCompactBytes returns nil for null bytes. Compact bytes store length+1 as unsigned varint.
+func (rd *RealDecoder) getCompactBytes() ([]byte, error) {
+	n, err := rd.getUVarint()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	if n-1 > uint64(rd.remaining()) {
+		rd.off = len(rd.raw)
+		return nil, ErrInsufficientData
+	}
+	return rd.getRawBytes(int(n - 1))
+}
+
+func (rd *RealDecoder) getCompactInt32Array() ([]int32, error) {
+	n, err := rd.getCompactArrayLength()
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+
+	if rd.remaining() < 4*n {
+		rd.off = len(rd.raw)
+		return nil, ErrInsufficientData
+	}
+
+	ret := make([]int32, n)
+	for i := range ret {
+		ret[i] = int32(binary.BigEndian.Uint32(rd.raw[rd.off:]))
+		rd.off += 4
+	}
+	return ret, nil
+}
+
+// getTaggedFields skips a tagged fields section, we don't use any tagged field yet
+func (rd *RealDecoder) getTaggedFields() error {
+	count, err := rd.getUVarint()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < count; i++ {
+		if _, err := rd.getUVarint(); err != nil { // tag
+			return err
+		}
+		size, err := rd.getUVarint()
+		if err != nil {
+			return err
+		}
+		if size > uint64(rd.remaining()) {
+			rd.off = len(rd.raw)
+			return ErrInsufficientData
+		}
+		if _, err := rd.getRawBytes(int(size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // subsets
 
 func (rd *RealDecoder) remaining() int {
@@ -393,7 +618,7 @@ func (rd *RealDecoder) getSubset(length int) (PacketDecoder, error) {
 
 func (rd *RealDecoder) getRawBytes(length int) ([]byte, error) {
 	if length < 0 {
-		return nil, errInvalidByteSliceLength
+		return nil, rd.errorAt(rd.off, errInvalidByteSliceLength)
 	} else if length > rd.remaining() {
 		rd.off = len(rd.raw)
 		return nil, ErrInsufficientData
@@ -405,6 +630,9 @@ func (rd *RealDecoder) getRawBytes(length int) ([]byte, error) {
 }
 
 func (rd *RealDecoder) peek(offset, length int) (PacketDecoder, error) {
+	if offset < 0 || length < 0 {
+		return nil, rd.errorAt(rd.off, errInvalidByteSliceLength)
+	}
 	if rd.remaining() < offset+length {
 		return nil, ErrInsufficientData
 	}
@@ -414,7 +642,7 @@ func (rd *RealDecoder) peek(offset, length int) (PacketDecoder, error) {
 
 func (rd *RealDecoder) peekInt8(offset int) (int8, error) {
 	const byteLen = 1
-	if rd.remaining() < offset+byteLen {
+	if offset < 0 || rd.remaining() < offset+byteLen {
 		return -1, ErrInsufficientData
 	}
 	return int8(rd.raw[rd.off+offset]), nil
@@ -446,6 +674,9 @@ func (rd *RealDecoder) push(in PushDecoder) error {
 }
 
 func (rd *RealDecoder) pop() error {
+	if len(rd.stack) == 0 {
+		return PacketDecodingError{Info: "pop without push", Offset: rd.off}
+	}
 	// this is go's ugly pop pattern (the inverse of append)
 	in := rd.stack[len(rd.stack)-1]
 	rd.stack = rd.stack[:len(rd.stack)-1]
@@ -453,6 +684,14 @@ func (rd *RealDecoder) pop() error {
 	return in.check(rd.off, rd.raw)
 }
 
+// discard skips length bytes, at most up to the end of the buffer so that later reads see
+// insufficient data rather than read out of bounds
 func (rd *RealDecoder) discard(length int) {
+	if length < 0 {
+		return
+	}
+	if length > rd.remaining() {
+		length = rd.remaining()
+	}
 	rd.off += length
 }
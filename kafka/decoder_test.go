@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"fmt"
+	"testing"
+)
+
+// getter reads a value of one type from a PacketDecoder
+type getter struct {
+	name  string
+	get   func(pd PacketDecoder) error
+	valid []byte
+}
+
+func ignore(_ interface{}, err error) error {
+	return err
+}
+
+var getters = []getter{
+	{"int8", func(pd PacketDecoder) error { return ignore(pd.getInt8()) }, []byte{1}},
+	{"int16", func(pd PacketDecoder) error { return ignore(pd.getInt16()) }, []byte{0, 1}},
+	{"int32", func(pd PacketDecoder) error { return ignore(pd.getInt32()) }, []byte{0, 0, 0, 1}},
+	{"int64", func(pd PacketDecoder) error { return ignore(pd.getInt64()) }, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+	{"varint", func(pd PacketDecoder) error { return ignore(pd.getVarint()) }, []byte{0x80, 0x01}},
+	{"array length", func(pd PacketDecoder) error { return ignore(pd.getArrayLength()) }, []byte{0, 0, 0, 0}},
+	{"bool", func(pd PacketDecoder) error { return ignore(pd.getBool()) }, []byte{1}},
+	{"bytes", func(pd PacketDecoder) error { return ignore(pd.getBytes()) }, []byte{0, 0, 0, 2, 'a', 'b'}},
+	{"varint bytes", func(pd PacketDecoder) error { return ignore(pd.getVarintBytes()) }, []byte{4, 'a', 'b'}},
+	{"raw bytes", func(pd PacketDecoder) error { return ignore(pd.getRawBytes(2)) }, []byte{'a', 'b'}},
+	{"string", func(pd PacketDecoder) error { return ignore(pd.getString()) }, []byte{0, 2, 'a', 'b'}},
+	{"nullable string", func(pd PacketDecoder) error { return ignore(pd.getNullableString()) }, []byte{0, 2, 'a', 'b'}},
+	{"int32 array", func(pd PacketDecoder) error { return ignore(pd.getInt32Array()) }, []byte{0, 0, 0, 1, 0, 0, 0, 5}},
+	{"int64 array", func(pd PacketDecoder) error { return ignore(pd.getInt64Array()) }, []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 5}},
+	{"string array", func(pd PacketDecoder) error { return ignore(pd.getStringArray()) }, []byte{0, 0, 0, 1, 0, 1, 'a'}},
+	{"uvarint", func(pd PacketDecoder) error { return ignore(pd.getUVarint()) }, []byte{0x80, 0x01}},
+	{"compact array length", func(pd PacketDecoder) error { return ignore(pd.getCompactArrayLength()) }, []byte{0x81, 0x00}},
+	{"compact string", func(pd PacketDecoder) error { return ignore(pd.getCompactString()) }, []byte{3, 'a', 'b'}},
+	{"compact bytes", func(pd PacketDecoder) error { return ignore(pd.getCompactBytes()) }, []byte{3, 'a', 'b'}},
+	{"compact int32 array", func(pd PacketDecoder) error { return ignore(pd.getCompactInt32Array()) }, []byte{2, 0, 0, 0, 5}},
+	{"tagged fields", func(pd PacketDecoder) error { return pd.getTaggedFields() }, []byte{1, 0, 2, 'a', 'b'}},
+	{"subset", func(pd PacketDecoder) error { return ignore(pd.getSubset(2)) }, []byte{'a', 'b'}},
+	{"peek", func(pd PacketDecoder) error { return ignore(pd.peek(1, 1)) }, []byte{'a', 'b'}},
+	{"peek int8", func(pd PacketDecoder) error { return ignore(pd.peekInt8(1)) }, []byte{'a', 'b'}},
+}
+
+// decodeSafely runs get, turning a panic into an error
+func decodeSafely(get func(pd PacketDecoder) error, buf []byte) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return get(NewPacketDecoder(buf))
+}
+
+func TestDecoderGetters(t *testing.T) {
+	for _, g := range getters {
+		t.Run(g.name, func(t *testing.T) {
+			if err := decodeSafely(g.get, g.valid); err != nil {
+				t.Fatalf("decoding % x: %v", g.valid, err)
+			}
+		})
+	}
+}
+
+func TestDecoderGettersTruncated(t *testing.T) {
+	for _, g := range getters {
+		t.Run(g.name, func(t *testing.T) {
+			for n := 0; n < len(g.valid); n++ {
+				truncated := g.valid[:n]
+				err := decodeSafely(g.get, truncated)
+				if err == nil {
+					t.Errorf("decoding % x returned no error", truncated)
+				} else if _, ok := err.(PacketDecodingError); !ok && err != ErrInsufficientData {
+					t.Errorf("decoding % x: %v", truncated, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderInvalidLengths(t *testing.T) {
+	tests := []struct {
+		name string
+		get  func(pd PacketDecoder) error
+		buf  []byte
+	}{
+		{"negative array length", func(pd PacketDecoder) error { return ignore(pd.getArrayLength()) }, []byte{0xff, 0xff, 0xff, 0xfe}},
+		{"negative bytes length", func(pd PacketDecoder) error { return ignore(pd.getBytes()) }, []byte{0xff, 0xff, 0xff, 0xfb}},
+		{"negative string length", func(pd PacketDecoder) error { return ignore(pd.getString()) }, []byte{0xff, 0xfb}},
+		{"huge int32 array", func(pd PacketDecoder) error { return ignore(pd.getInt32Array()) }, []byte{0x7f, 0xff, 0xff, 0xff}},
+		{"huge int64 array", func(pd PacketDecoder) error { return ignore(pd.getInt64Array()) }, []byte{0x7f, 0xff, 0xff, 0xff}},
+		{"huge string array", func(pd PacketDecoder) error { return ignore(pd.getStringArray()) }, []byte{0x7f, 0xff, 0xff, 0xff}},
+		{"huge compact array", func(pd PacketDecoder) error { return ignore(pd.getCompactInt32Array()) }, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{"huge tagged field", func(pd PacketDecoder) error { return pd.getTaggedFields() }, []byte{1, 0, 0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{"negative raw bytes", func(pd PacketDecoder) error { return ignore(pd.getRawBytes(-1)) }, []byte{'a'}},
+		{"negative peek", func(pd PacketDecoder) error { return ignore(pd.peek(-1, 1)) }, []byte{'a'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := decodeSafely(tt.get, tt.buf); err == nil {
+				t.Errorf("decoding % x returned no error", tt.buf)
+			} else if _, ok := err.(PacketDecodingError); !ok && err != ErrInsufficientData {
+				t.Errorf("decoding % x: %v", tt.buf, err)
+			}
+		})
+	}
+}
+
+func TestPopEmptyStack(t *testing.T) {
+	if err := decodeSafely(func(pd PacketDecoder) error { return pd.pop() }, nil); err == nil {
+		t.Error("pop of an empty stack returned no error")
+	}
+}
@@ -58,6 +58,6 @@ func decompress(cc CompressionCodec, data []byte) ([]byte, error) {
 	case CompressionZSTD:
 		return zstdDecompress(nil, data)
 	default:
-		return nil, PacketDecodingError{fmt.Sprintf("invalid compression specified (%d)", cc)}
+		return nil, PacketDecodingError{Info: fmt.Sprintf("invalid compression specified (%d)", cc)}
 	}
 }
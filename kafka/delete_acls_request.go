@@ -0,0 +1,53 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// DeleteAclsRequest deletes the ACLs matching its filters
+type DeleteAclsRequest struct {
+	Version int16
+	// Filters match the deleted ACLs, an empty string matches anything
+	Filters []AclBinding
+}
+
+// key returns the Kafka API key for DeleteAcls
+func (r *DeleteAclsRequest) key() int16 {
+	return 31
+}
+
+// version returns the Kafka request version
+func (r *DeleteAclsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *DeleteAclsRequest) requiredVersion() Version {
+	return aclRequiredVersion(r.Version)
+}
+
+// Decode deserializes a DeleteAcls request from the given PacketDecoder
+func (r *DeleteAclsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.Filters, err = decodeAclBindings(pd, version, flexible, true); err != nil {
+		return err
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns the topics named by the deletion filters
+func (r *DeleteAclsRequest) ExtractTopics() []string {
+	return aclTopics(r.Filters)
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *DeleteAclsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	for _, filter := range r.Filters {
+		metrics.AclChangesTotal.WithLabelValues(clientIP, "delete", filter.ResourceType).Inc()
+	}
+}
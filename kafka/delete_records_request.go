@@ -0,0 +1,124 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// DeleteRecordsRequest deletes the records of partitions before the given offsets
+type DeleteRecordsRequest struct {
+	Version   int16
+	Topics    []DeleteRecordsTopic
+	TimeoutMs int32
+}
+
+// DeleteRecordsTopic contains the partitions whose records are deleted
+type DeleteRecordsTopic struct {
+	Topic      string
+	Partitions []DeleteRecordsPartition
+}
+
+// DeleteRecordsPartition is a partition whose records before Offset are deleted, an offset
+// of -1 deletes up to the high watermark
+type DeleteRecordsPartition struct {
+	Partition int32
+	Offset    int64
+}
+
+// key returns the Kafka API key for DeleteRecords
+func (r *DeleteRecordsRequest) key() int16 {
+	return 21
+}
+
+// version returns the Kafka request version
+func (r *DeleteRecordsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *DeleteRecordsRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_11_0_0
+	case 1:
+		return V2_0_0_0
+	default:
+		return V2_4_0_0
+	}
+}
+
+// Decode deserializes a DeleteRecords request from the given PacketDecoder
+func (r *DeleteRecordsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	topicCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		r.Topics = make([]DeleteRecordsTopic, topicCount)
+	}
+	for i := range r.Topics {
+		t := &r.Topics[i]
+
+		if t.Topic, err = decodeString(pd, flexible); err != nil {
+			return fieldError("topic name", err)
+		}
+
+		partitionCount, err := decodeArrayLength(pd, flexible)
+		if err != nil {
+			return fieldError("partition array", err)
+		}
+
+		if partitionCount > 0 {
+			t.Partitions = make([]DeleteRecordsPartition, partitionCount)
+		}
+		for j := range t.Partitions {
+			p := &t.Partitions[j]
+
+			if p.Partition, err = pd.getInt32(); err != nil {
+				return fieldError("partition", err)
+			}
+			if p.Offset, err = pd.getInt64(); err != nil {
+				return fieldError("offset", err)
+			}
+
+			if flexible {
+				if err = pd.getTaggedFields(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.TimeoutMs, err = pd.getInt32(); err != nil {
+		return fieldError("timeout", err)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *DeleteRecordsRequest) ExtractTopics() []string {
+	topics := make([]string, 0, len(r.Topics))
+	for _, topic := range r.Topics {
+		topics = append(topics, topic.Topic)
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *DeleteRecordsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	for _, topic := range r.Topics {
+		metrics.DeleteRecordsTotal.WithLabelValues(clientIP, topic.Topic).Inc()
+	}
+}
@@ -30,7 +30,7 @@ func (r *DeleteTopicsRequest) Decode(pd PacketDecoder, version int16) error {
 		return err
 	}
 
-	if topicCount == 0 {
+	if topicCount <= 0 {
 		return nil
 	}
 
@@ -58,9 +58,9 @@ func (r *DeleteTopicsRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *DeleteTopicsRequest) CollectClientMetrics(clientIP string) {
+func (r *DeleteTopicsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
 	// A client deleting topics is likely to be an admin
 	for _, topic := range r.Topics {
-		metrics.AddActiveTopicInfo(clientIP, topic)
+		storage.AddActiveTopicInfo(clientIP, topic)
 	}
 }
@@ -2,21 +2,54 @@ package kafka
 
 import (
 	"fmt"
+
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
+// Config resource types of DescribeConfigs and AlterConfigs requests
+const (
+	ConfigResourceUnknown       int8 = 0
+	ConfigResourceTopic         int8 = 2
+	ConfigResourceBroker        int8 = 4
+	ConfigResourceBrokerLogger  int8 = 8
+	ConfigResourceClientMetrics int8 = 16
+	ConfigResourceGroup         int8 = 32
+)
+
+// ConfigResourceTypeName returns the name of a config resource type, e.g. "BROKER"
+func ConfigResourceTypeName(resourceType int8) string {
+	switch resourceType {
+	case ConfigResourceUnknown:
+		return "UNKNOWN"
+	case ConfigResourceTopic:
+		return "TOPIC"
+	case ConfigResourceBroker:
+		return "BROKER"
+	case ConfigResourceBrokerLogger:
+		return "BROKER_LOGGER"
+	case ConfigResourceClientMetrics:
+		return "CLIENT_METRICS"
+	case ConfigResourceGroup:
+		return "GROUP"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", resourceType)
+	}
+}
+
 // DescribeConfigsRequest is used to get the configuration for resources
 type DescribeConfigsRequest struct {
-	Version        int16
-	Resources    []DescribeConfigsResource
-	IncludeSynonyms bool
+	Version              int16
+	Resources            []DescribeConfigsResource
+	IncludeSynonyms      bool // v1+
+	IncludeDocumentation bool // v3+
 }
 
 // DescribeConfigsResource identifies a resource to describe configs for
 type DescribeConfigsResource struct {
-	ResourceType int8 // 0 = Unknown, 1 = Topic, 2 = Broker, 3 = Broker Logger
+	ResourceType int8 // one of the ConfigResource types
 	ResourceName string
-	ConfigNames  []string
+	// ConfigNames are the described configs, all of them when empty
+	ConfigNames []string
 }
 
 // key returns the Kafka API key for DescribeConfigs
@@ -31,61 +64,80 @@ func (r *DescribeConfigsRequest) version() int16 {
 
 // requiredVersion states what the minimum required version is
 func (r *DescribeConfigsRequest) requiredVersion() Version {
-	return V0_11_0_0
+	switch r.Version {
+	case 0:
+		return V0_11_0_0
+	case 1:
+		return V1_1_0_0
+	case 2:
+		return V2_0_0_0
+	case 3:
+		return V2_5_0_0
+	default:
+		return V2_7_0_0
+	}
 }
 
 // Decode deserializes a DescribeConfigs request from the given PacketDecoder
-func (r *DescribeConfigsRequest) Decode(pd PacketDecoder, version int16) error {
+func (r *DescribeConfigsRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	r.Version = version
-	resourceCount, err := pd.getArrayLength()
+	flexible := isFlexible(r.key(), version)
+
+	resourceCount, err := decodeArrayLength(pd, flexible)
 	if err != nil {
-		return err
+		return fieldError("resource array", err)
 	}
 
-	r.Resources = make([]DescribeConfigsResource, resourceCount)
+	if resourceCount > 0 {
+		r.Resources = make([]DescribeConfigsResource, resourceCount)
+	}
 	for i := range r.Resources {
-		resourceType, err := pd.getInt8()
-		if err != nil {
-			return err
+		resource := &r.Resources[i]
+
+		if resource.ResourceType, err = pd.getInt8(); err != nil {
+			return fieldError("resource type", err)
 		}
-		r.Resources[i].ResourceType = resourceType
 
-		resourceName, err := pd.getString()
-		if err != nil {
-			return err
+		if resource.ResourceName, err = decodeString(pd, flexible); err != nil {
+			return fieldError("resource name", err)
 		}
-		r.Resources[i].ResourceName = resourceName
+		resource.ResourceName = BoundString("resource_name", resource.ResourceName)
 
-		configNamesCount, err := pd.getArrayLength()
+		// a null array describes all configs
+		configNamesCount, err := decodeArrayLength(pd, flexible)
 		if err != nil {
-			return err
+			return fieldError("config name array", err)
 		}
-
-		// Skip if there are no config names or if count is invalid
-		if configNamesCount <= 0 || configNamesCount > 10000 {
-			// Set a reasonable upper limit to prevent allocating huge slices
-			if configNamesCount > 10000 {
-				return PacketDecodingError{"invalid configNames array length"}
+		if configNamesCount > 0 {
+			resource.ConfigNames = make([]string, configNamesCount)
+		}
+		for j := range resource.ConfigNames {
+			if resource.ConfigNames[j], err = decodeString(pd, flexible); err != nil {
+				return fieldError("config name", err)
 			}
-			continue
 		}
 
-		r.Resources[i].ConfigNames = make([]string, configNamesCount)
-		for j := 0; j < configNamesCount; j++ {
-			configName, err := pd.getString()
-			if err != nil {
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
 				return err
 			}
-			r.Resources[i].ConfigNames[j] = configName
 		}
 	}
 
 	if version >= 1 {
-		includeSynonyms, err := pd.getBool()
-		if err != nil {
-			return err
+		if r.IncludeSynonyms, err = pd.getBool(); err != nil {
+			return fieldError("include synonyms", err)
 		}
-		r.IncludeSynonyms = includeSynonyms
+	}
+
+	if version >= 3 {
+		if r.IncludeDocumentation, err = pd.getBool(); err != nil {
+			return fieldError("include documentation", err)
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
 	}
 
 	return nil
@@ -95,8 +147,7 @@ func (r *DescribeConfigsRequest) Decode(pd PacketDecoder, version int16) error {
 func (r *DescribeConfigsRequest) ExtractTopics() []string {
 	var topics []string
 	for _, resource := range r.Resources {
-		// ResourceType 1 = Topic
-		if resource.ResourceType == 1 {
+		if resource.ResourceType == ConfigResourceTopic {
 			topics = append(topics, resource.ResourceName)
 		}
 	}
@@ -104,16 +155,13 @@ func (r *DescribeConfigsRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *DescribeConfigsRequest) CollectClientMetrics(clientIP string) {
-	// Include version information in metrics
-	versionStr := fmt.Sprintf("%d", r.Version)
-	metrics.RequestsCount.WithLabelValues(clientIP, "DescribeConfigs", versionStr).Inc()
-	
-	// For topic config requests, record interest in these topics
+func (r *DescribeConfigsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
 	for _, resource := range r.Resources {
-		// ResourceType 1 = Topic
-		if resource.ResourceType == 1 {
-			metrics.AddActiveTopicInfo(clientIP, resource.ResourceName)
+		metrics.DescribeConfigsTotal.WithLabelValues(clientIP, ConfigResourceTypeName(resource.ResourceType)).Inc()
+
+		// For topic config requests, record interest in these topics
+		if resource.ResourceType == ConfigResourceTopic {
+			storage.AddActiveTopicInfo(clientIP, resource.ResourceName)
 		}
 	}
-}
\ No newline at end of file
+}
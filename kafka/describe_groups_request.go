@@ -1,5 +1,6 @@
 package kafka
 
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
 
 // DescribeGroupsRequest is used to describe consumer groups
 type DescribeGroupsRequest struct {
@@ -8,7 +9,7 @@ type DescribeGroupsRequest struct {
 
 // key returns the Kafka API key for DescribeGroups
 func (r *DescribeGroupsRequest) key() int16 {
-	return 8
+	return 15
 }
 
 // version returns the Kafka request version
@@ -23,18 +24,20 @@ func (r *DescribeGroupsRequest) requiredVersion() Version {
 
 // Decode deserializes a DescribeGroups request from the given PacketDecoder
 func (r *DescribeGroupsRequest) Decode(pd PacketDecoder, version int16) error {
-	groupsLen, err := pd.getArrayLength()
+	flexible := version >= 5
+
+	groupsLen, err := decodeArrayLength(pd, flexible)
 	if err != nil {
 		return err
 	}
 
-	if groupsLen == 0 {
+	if groupsLen <= 0 {
 		return nil
 	}
 
 	r.Groups = make([]string, groupsLen)
 	for i := 0; i < groupsLen; i++ {
-		group, err := pd.getString()
+		group, err := decodeString(pd, flexible)
 		if err != nil {
 			return err
 		}
@@ -50,6 +53,6 @@ func (r *DescribeGroupsRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *DescribeGroupsRequest) CollectClientMetrics(clientIP string) {
+func (r *DescribeGroupsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
 	// No specific topic metrics for describe groups operations
 }
@@ -0,0 +1,98 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// DescribeLogDirsRequest is used to query the log directories of a broker (JBOD management)
+type DescribeLogDirsRequest struct {
+	Version int16
+	// Topics is nil when the client asked for all topics
+	Topics []LogDirTopic
+}
+
+// LogDirTopic contains a topic name and the partitions referenced by a log-dir operation
+type LogDirTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+// key returns the Kafka API key for DescribeLogDirs
+func (r *DescribeLogDirsRequest) key() int16 {
+	return 35
+}
+
+// version returns the Kafka request version
+func (r *DescribeLogDirsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *DescribeLogDirsRequest) requiredVersion() Version {
+	return V1_0_0_0
+}
+
+// Decode deserializes a DescribeLogDirs request from the given PacketDecoder
+func (r *DescribeLogDirsRequest) Decode(pd PacketDecoder, version int16) error {
+	r.Version = version
+	flexible := version >= 2
+
+	topicCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	// A null array means "all topics"
+	if topicCount >= 0 {
+		r.Topics = make([]LogDirTopic, topicCount)
+	}
+	for i := range r.Topics {
+		if err := r.Topics[i].decode(pd, flexible); err != nil {
+			return err
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (t *LogDirTopic) decode(pd PacketDecoder, flexible bool) (err error) {
+	if t.Topic, err = decodeString(pd, flexible); err != nil {
+		return fieldError("topic name", err)
+	}
+
+	if flexible {
+		t.Partitions, err = pd.getCompactInt32Array()
+	} else {
+		t.Partitions, err = pd.getInt32Array()
+	}
+	if err != nil {
+		return fieldError("partition array", err)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// AllTopics reports whether the request targets every topic on the broker
+func (r *DescribeLogDirsRequest) AllTopics() bool {
+	return r.Topics == nil
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *DescribeLogDirsRequest) ExtractTopics() []string {
+	topics := make([]string, len(r.Topics))
+	for i, topic := range r.Topics {
+		topics[i] = topic.Topic
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *DescribeLogDirsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.LogDirOpTotal.WithLabelValues(clientIP, "describe").Inc()
+}
@@ -0,0 +1,78 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// DescribeProducersRequest is used by admin clients to list the active producers of
+// partitions, e.g. to find the transaction holding back a consumer
+type DescribeProducersRequest struct {
+	Version int16
+	Topics  []DescribeProducersTopic
+}
+
+// DescribeProducersTopic contains the partitions whose producers are described
+type DescribeProducersTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+// key returns the Kafka API key for DescribeProducers
+func (r *DescribeProducersRequest) key() int16 {
+	return 61
+}
+
+// version returns the Kafka request version
+func (r *DescribeProducersRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *DescribeProducersRequest) requiredVersion() Version {
+	return V3_0_0_0
+}
+
+// Decode deserializes a DescribeProducers request from the given PacketDecoder.
+// Every version of the request is flexible.
+func (r *DescribeProducersRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+
+	topicCount, err := pd.getCompactArrayLength()
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		r.Topics = make([]DescribeProducersTopic, topicCount)
+	}
+	for i := range r.Topics {
+		t := &r.Topics[i]
+
+		if t.Topic, err = pd.getCompactString(); err != nil {
+			return fieldError("topic name", err)
+		}
+		t.Topic = BoundString("topic", t.Topic)
+		if t.Partitions, err = pd.getCompactInt32Array(); err != nil {
+			return fieldError("partition array", err)
+		}
+		if err = pd.getTaggedFields(); err != nil {
+			return err
+		}
+	}
+
+	return pd.getTaggedFields()
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *DescribeProducersRequest) ExtractTopics() []string {
+	topics := make([]string, 0, len(r.Topics))
+	for _, topic := range r.Topics {
+		topics = append(topics, topic.Topic)
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *DescribeProducersRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	for _, topic := range r.Topics {
+		metrics.DescribeProducersTotal.WithLabelValues(clientIP, topic.Topic).Inc()
+	}
+}
@@ -0,0 +1,62 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// DescribeUserScramCredentialsRequest is used to list the SCRAM credentials of users
+type DescribeUserScramCredentialsRequest struct {
+	Version int16
+	// Users is nil when the credentials of all users are described
+	Users []string
+}
+
+// key returns the Kafka API key for DescribeUserScramCredentials
+func (r *DescribeUserScramCredentialsRequest) key() int16 {
+	return 50
+}
+
+// version returns the Kafka request version
+func (r *DescribeUserScramCredentialsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *DescribeUserScramCredentialsRequest) requiredVersion() Version {
+	return V2_7_0_0
+}
+
+// Decode deserializes a DescribeUserScramCredentials request from the given PacketDecoder.
+// Every version of the request is flexible.
+func (r *DescribeUserScramCredentialsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+
+	userCount, err := pd.getCompactArrayLength()
+	if err != nil {
+		return fieldError("user array", err)
+	}
+
+	// A null array means "all users"
+	if userCount >= 0 {
+		r.Users = make([]string, userCount)
+	}
+	for i := range r.Users {
+		if r.Users[i], err = pd.getCompactString(); err != nil {
+			return fieldError("user name", err)
+		}
+		r.Users[i] = BoundString("scram_user", r.Users[i])
+		if err = pd.getTaggedFields(); err != nil {
+			return err
+		}
+	}
+
+	return pd.getTaggedFields()
+}
+
+// AllUsers reports whether the request targets every user
+func (r *DescribeUserScramCredentialsRequest) AllUsers() bool {
+	return r.Users == nil
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *DescribeUserScramCredentialsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.ScramCredentialOpTotal.WithLabelValues("describe").Inc()
+}
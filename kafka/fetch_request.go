@@ -38,6 +38,8 @@ func (b *fetchRequestBlock) decode(pd PacketDecoder, version int16) (err error)
 // https://issues.apache.org/jira/browse/KAFKA-2063 for a discussion of the issues leading up to that.  The KIP is at
 // https://cwiki.apache.org/confluence/display/KAFKA/KIP-74%3A+Add+Fetch+Response+Size+Limit+in+Bytes
 type FetchRequest struct {
+	// ReplicaID is the broker id of a follower replicating partitions, -1 for consumers
+	ReplicaID    int32
 	MaxWaitTime  int32
 	MinBytes     int32
 	MaxBytes     int32
@@ -50,6 +52,25 @@ type FetchRequest struct {
 	RackID       string
 }
 
+// Fetcher types of fetch requests
+const (
+	FetcherConsumer = "consumer"
+	FetcherFollower = "follower"
+)
+
+// FromFollower reports whether the request was sent by a broker replicating partitions
+func (r *FetchRequest) FromFollower() bool {
+	return r.ReplicaID >= 0
+}
+
+// FetcherType returns FetcherFollower for the fetches of brokers, FetcherConsumer otherwise
+func (r *FetchRequest) FetcherType() string {
+	if r.FromFollower() {
+		return FetcherFollower
+	}
+	return FetcherConsumer
+}
+
 // IsolationLevel is a setting for reliability
 type IsolationLevel int8
 
@@ -75,41 +96,45 @@ func (r *FetchRequest) GetRequestedBlocksCount() (blocksCount int) {
 func (r *FetchRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	r.Version = version
 
-	if _, err = pd.getInt32(); err != nil {
-		return err
+	// v15+ moved the replica id to the replica state tagged field, only followers send it
+	r.ReplicaID = -1
+	if r.Version < 15 {
+		if r.ReplicaID, err = pd.getInt32(); err != nil {
+			return fieldError("replica id", err)
+		}
 	}
 	if r.MaxWaitTime, err = pd.getInt32(); err != nil {
-		return err
+		return fieldError("max wait time", err)
 	}
 	if r.MinBytes, err = pd.getInt32(); err != nil {
-		return err
+		return fieldError("min bytes", err)
 	}
 	if r.Version >= 3 {
 		if r.MaxBytes, err = pd.getInt32(); err != nil {
-			return err
+			return fieldError("max bytes", err)
 		}
 	}
 	if r.Version >= 4 {
 		var isolation int8
 		isolation, err = pd.getInt8()
 		if err != nil {
-			return err
+			return fieldError("isolation level", err)
 		}
 		r.Isolation = IsolationLevel(isolation)
 	}
 	if r.Version >= 7 {
 		r.SessionID, err = pd.getInt32()
 		if err != nil {
-			return err
+			return fieldError("session id", err)
 		}
 		r.SessionEpoch, err = pd.getInt32()
 		if err != nil {
-			return err
+			return fieldError("session epoch", err)
 		}
 	}
 	topicCount, err := pd.getArrayLength()
 	if err != nil {
-		return err
+		return fieldError("topic array", err)
 	}
 	if topicCount == 0 {
 		return nil
@@ -119,23 +144,23 @@ func (r *FetchRequest) Decode(pd PacketDecoder, version int16) (err error) {
 		var topic string
 		topic, err = pd.getString()
 		if err != nil {
-			return err
+			return fieldError("topic name", err)
 		}
 		var partitionCount int
 		partitionCount, err = pd.getArrayLength()
 		if err != nil {
-			return err
+			return fieldError("partition array", err)
 		}
 		r.blocks[topic] = make(map[int32]*fetchRequestBlock)
 		for j := 0; j < partitionCount; j++ {
 			var partition int32
 			partition, err = pd.getInt32()
 			if err != nil {
-				return err
+				return fieldError("partition", err)
 			}
 			fetchBlock := &fetchRequestBlock{}
 			if err = fetchBlock.decode(pd, r.Version); err != nil {
-				return err
+				return fieldError("partition block", err)
 			}
 			r.blocks[topic][partition] = fetchBlock
 		}
@@ -145,19 +170,19 @@ func (r *FetchRequest) Decode(pd PacketDecoder, version int16) (err error) {
 		var forgottenCount int
 		forgottenCount, err = pd.getArrayLength()
 		if err != nil {
-			return err
+			return fieldError("forgotten topic array", err)
 		}
 		r.forgotten = make(map[string][]int32)
 		for i := 0; i < forgottenCount; i++ {
 			var topic string
 			topic, err = pd.getString()
 			if err != nil {
-				return err
+				return fieldError("forgotten topic name", err)
 			}
 			var partitionCount int
 			partitionCount, err = pd.getArrayLength()
 			if err != nil {
-				return err
+				return fieldError("forgotten partition array", err)
 			}
 			r.forgotten[topic] = make([]int32, partitionCount)
 
@@ -165,7 +190,7 @@ func (r *FetchRequest) Decode(pd PacketDecoder, version int16) (err error) {
 				var partition int32
 				partition, err = pd.getInt32()
 				if err != nil {
-					return err
+					return fieldError("forgotten partition", err)
 				}
 				r.forgotten[topic][j] = partition
 			}
@@ -175,15 +200,20 @@ func (r *FetchRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	if r.Version >= 11 {
 		r.RackID, err = pd.getString()
 		if err != nil {
-			return err
+			return fieldError("rack id", err)
 		}
 	}
 
 	return nil
 }
 
+// PartitionCount returns the number of partitions fetched from a topic
+func (r *FetchRequest) PartitionCount(topic string) int {
+	return len(r.blocks[topic])
+}
+
 // CollectClientMetrics collects metrics associated with client
-func (r *FetchRequest) CollectClientMetrics(srcHost string) {
+func (r *FetchRequest) CollectClientMetrics(storage *metrics.Storage, srcHost string) {
 	// Include API version in metrics
 	versionStr := fmt.Sprintf("%d", r.Version)
 	metrics.RequestsCount.WithLabelValues(srcHost, "fetch", versionStr).Inc()
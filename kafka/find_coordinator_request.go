@@ -1,15 +1,40 @@
 package kafka
 
 import (
-	"fmt"
+	"strconv"
+
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
-// FindCoordinatorRequest is used to find the coordinator for a group or transaction
+// Coordinator types of FindCoordinator requests
+const (
+	CoordinatorTypeGroup       int8 = 0
+	CoordinatorTypeTransaction int8 = 1
+	CoordinatorTypeShare       int8 = 2
+)
+
+var coordinatorTypeNames = map[int8]string{
+	CoordinatorTypeGroup:       "group",
+	CoordinatorTypeTransaction: "transaction",
+	CoordinatorTypeShare:       "share",
+}
+
+// CoordinatorTypeName returns the name of a coordinator type, or its number when unknown
+func CoordinatorTypeName(coordinatorType int8) string {
+	if name, ok := coordinatorTypeNames[coordinatorType]; ok {
+		return name
+	}
+	return strconv.Itoa(int(coordinatorType))
+}
+
+// FindCoordinatorRequest is used to find the coordinator for a group or transaction. Up to v3
+// it looks up a single key, v4+ batches several keys of the same type.
 type FindCoordinatorRequest struct {
-	Version        int16
-	CoordinatorKey string
-	CoordinatorType byte // 0 = consumer group, 1 = transaction
+	Version int16
+	// CoordinatorKeys are the group ids, or the transactional ids, looked up
+	CoordinatorKeys []string
+	// CoordinatorType is the type of the keys, always CoordinatorTypeGroup in v0
+	CoordinatorType int8
 }
 
 // key returns the Kafka API key for FindCoordinator
@@ -24,28 +49,58 @@ func (r *FindCoordinatorRequest) version() int16 {
 
 // requiredVersion states what the minimum required version is
 func (r *FindCoordinatorRequest) requiredVersion() Version {
-	return V0_9_0_0
+	switch r.Version {
+	case 0:
+		return V0_9_0_0
+	case 1:
+		return V0_11_0_0
+	case 2:
+		return V2_0_0_0
+	case 3:
+		return V2_4_0_0
+	default:
+		return V3_0_0_0
+	}
 }
 
 // Decode deserializes a FindCoordinator request from the given PacketDecoder
-func (r *FindCoordinatorRequest) Decode(pd PacketDecoder, version int16) error {
+func (r *FindCoordinatorRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	r.Version = version
-	key, err := pd.getString()
-	if err != nil {
-		return err
+	flexible := isFlexible(r.key(), version)
+
+	if version < 4 {
+		key, err := decodeString(pd, flexible)
+		if err != nil {
+			return fieldError("coordinator key", err)
+		}
+		r.CoordinatorKeys = []string{BoundString("coordinator_key", key)}
 	}
-	r.CoordinatorKey = key
 
-	// In version 1+, there's a coordinator type field
 	if version >= 1 {
-		coordinatorType, err := pd.getInt8()
+		if r.CoordinatorType, err = pd.getInt8(); err != nil {
+			return fieldError("coordinator type", err)
+		}
+	}
+
+	if version >= 4 {
+		keyCount, err := decodeArrayLength(pd, flexible)
 		if err != nil {
-			return err
+			return fieldError("coordinator key array", err)
 		}
-		r.CoordinatorType = byte(coordinatorType)
-	} else {
-		// In version 0, it was always for a consumer group
-		r.CoordinatorType = 0
+		if keyCount > 0 {
+			r.CoordinatorKeys = make([]string, keyCount)
+		}
+		for i := range r.CoordinatorKeys {
+			key, err := decodeString(pd, flexible)
+			if err != nil {
+				return fieldError("coordinator key", err)
+			}
+			r.CoordinatorKeys[i] = BoundString("coordinator_key", key)
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
 	}
 
 	return nil
@@ -57,8 +112,20 @@ func (r *FindCoordinatorRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *FindCoordinatorRequest) CollectClientMetrics(clientIP string) {
-	// Add version information to metrics
-	versionStr := fmt.Sprintf("%d", r.Version)
-	metrics.RequestsCount.WithLabelValues(clientIP, "FindCoordinator", versionStr).Inc()
-}
\ No newline at end of file
+func (r *FindCoordinatorRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.FindCoordinatorTotal.WithLabelValues(clientIP, CoordinatorTypeName(r.CoordinatorType)).Inc()
+
+	// A client looks up the coordinator of the groups and transactions it's about to use,
+	// before any JoinGroup or InitProducerId
+	for _, key := range r.CoordinatorKeys {
+		if key == "" {
+			continue
+		}
+		switch r.CoordinatorType {
+		case CoordinatorTypeGroup:
+			storage.AddClientGroup(clientIP, key)
+		case CoordinatorTypeTransaction:
+			storage.AddTransactionalProducerInfo(clientIP, key)
+		}
+	}
+}
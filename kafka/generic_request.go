@@ -1,10 +1,16 @@
 package kafka
 
 import (
-	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
+// unknownApiKeysLogged are the unknown api keys already logged, each is only logged once
+var unknownApiKeysLogged sync.Map
+
 // GenericRequest implements the ProtocolBody interface for Kafka APIs that don't have
 // full decoder implementations. It captures the key API details for reporting.
 type GenericRequest struct {
@@ -34,11 +40,26 @@ func (r *GenericRequest) requiredVersion() Version {
 	return MinVersion
 }
 
-// CollectClientMetrics implements the ProtocolBody interface for metrics collection
-func (r *GenericRequest) CollectClientMetrics(clientAddr string) {
-	// Track this as a generic API call with version information
-	versionStr := fmt.Sprintf("%d", r.Version)
-	metrics.RequestsCount.WithLabelValues(clientAddr, r.ApiName, versionStr).Inc()
+// CollectClientMetrics implements the ProtocolBody interface for metrics collection. Unknown
+// api keys are counted, and logged the first time they're seen: they're sent by clients of a
+// newer Kafka version than the sniffer knows.
+func (r *GenericRequest) CollectClientMetrics(storage *metrics.Storage, clientAddr string) {
+	// RequestsCount is already counted with the request header
+	if KnownApiKey(r.ApiKey) {
+		return
+	}
+
+	apiKey := strconv.Itoa(int(r.ApiKey))
+	metrics.UnknownApiKeyTotal.WithLabelValues(clientAddr, apiKey).Inc()
+
+	if _, logged := unknownApiKeysLogged.LoadOrStore(r.ApiKey, true); !logged {
+		logging.Audit("unknown_api_key", logging.Fields{
+			"client_ip":   clientAddr,
+			"api_key":     r.ApiKey,
+			"api_version": r.Version,
+		}, "[INFO] Client: %s sent unknown api key %d v%d, the sniffer may need an upgrade to decode it",
+			clientAddr, r.ApiKey, r.Version)
+	}
 }
 
 // Decode implements the ProtocolBody interface, allowing the sniffer to capture API
@@ -0,0 +1,231 @@
+package kafka
+
+import (
+	"encoding/asn1"
+	"strings"
+)
+
+var (
+	// kerberosOID is the Kerberos V5 GSS-API mechanism (RFC 4121)
+	kerberosOID = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	// spnegoOID is the SPNEGO pseudo mechanism (RFC 4178), which wraps a Kerberos token
+	spnegoOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+)
+
+// GssapiInitialToken is what can be read from the initial context token of a GSSAPI (Kerberos)
+// exchange, e.g. "kafka/broker1.example.com@EXAMPLE.COM". The token is a Kerberos AP-REQ whose
+// client principal is encrypted with the session key, only the ticket's service principal and
+// realm are readable on the wire.
+type GssapiInitialToken struct {
+	// Spnego is set when the Kerberos token was wrapped in a SPNEGO NegTokenInit
+	Spnego bool
+	// Realm is the realm of the ticket, usually the realm of the client too
+	Realm string
+	// ServicePrincipal is the principal the ticket was issued for, without its realm
+	ServicePrincipal string
+}
+
+// ParseGssapiInitialToken parses the initial context token of a GSSAPI exchange, plain
+// Kerberos or wrapped in SPNEGO. It returns false for anything else, including the later
+// tokens of the exchange.
+func ParseGssapiInitialToken(msg []byte) (GssapiInitialToken, bool) {
+	var token GssapiInitialToken
+
+	mech, inner, ok := parseGssapiFraming(msg)
+	if !ok {
+		return token, false
+	}
+
+	if mech.Equal(spnegoOID) {
+		token.Spnego = true
+		if msg, ok = spnegoMechToken(inner); !ok {
+			return token, false
+		}
+		if mech, inner, ok = parseGssapiFraming(msg); !ok {
+			return token, false
+		}
+	}
+
+	// the Kerberos inner token is a two-byte token id, 01 00 for an AP-REQ, and the AP-REQ
+	if !mech.Equal(kerberosOID) || len(inner) < 2 || inner[0] != 0x01 || inner[1] != 0x00 {
+		return token, false
+	}
+
+	if token.Realm, token.ServicePrincipal, ok = parseApReqTicket(inner[2:]); !ok {
+		return token, false
+	}
+	token.Realm = BoundString("realm", token.Realm)
+	token.ServicePrincipal = BoundString("service_principal", token.ServicePrincipal)
+
+	return token, true
+}
+
+// String returns the service principal with its realm
+func (t GssapiInitialToken) String() string {
+	if t.Realm == "" {
+		return t.ServicePrincipal
+	}
+	return t.ServicePrincipal + "@" + t.Realm
+}
+
+// parseGssapiFraming parses the framing of an initial context token (RFC 2743 3.1):
+// [APPLICATION 0] IMPLICIT SEQUENCE { thisMech OID, innerContextToken ANY }
+func parseGssapiFraming(msg []byte) (asn1.ObjectIdentifier, []byte, bool) {
+	var framing asn1.RawValue
+	if rest, err := asn1.Unmarshal(msg, &framing); err != nil || len(rest) > 0 ||
+		framing.Class != asn1.ClassApplication || framing.Tag != 0 {
+		return nil, nil, false
+	}
+
+	var mech asn1.ObjectIdentifier
+	inner, err := asn1.Unmarshal(framing.Bytes, &mech)
+	if err != nil {
+		return nil, nil, false
+	}
+	return mech, inner, true
+}
+
+// spnegoMechToken returns the mechToken of a NegTokenInit:
+// [0] SEQUENCE { mechTypes [0], reqFlags [1], mechToken [2] OCTET STRING, mechListMIC [3] }
+func spnegoMechToken(inner []byte) ([]byte, bool) {
+	negTokenInit, ok := explicitField(inner, 0)
+	if !ok {
+		return nil, false
+	}
+	fields, ok := sequenceBytes(negTokenInit)
+	if !ok {
+		return nil, false
+	}
+
+	mechTokenField, ok := contextField(fields, 2)
+	if !ok {
+		return nil, false
+	}
+
+	var mechToken []byte
+	if _, err := asn1.Unmarshal(mechTokenField, &mechToken); err != nil {
+		return nil, false
+	}
+	return mechToken, true
+}
+
+// parseApReqTicket returns the realm and the service principal of the ticket of an AP-REQ
+// (RFC 4120 5.5.1): [APPLICATION 14] SEQUENCE { pvno [0], msg-type [1], ap-options [2],
+// ticket [3] Ticket, authenticator [4] }, where Ticket is [APPLICATION 1] SEQUENCE {
+// tkt-vno [0], realm [1] Realm, sname [2] PrincipalName, enc-part [3] }
+func parseApReqTicket(apReq []byte) (string, string, bool) {
+	var app asn1.RawValue
+	if _, err := asn1.Unmarshal(apReq, &app); err != nil || app.Class != asn1.ClassApplication || app.Tag != 14 {
+		return "", "", false
+	}
+	fields, ok := sequenceBytes(app.Bytes)
+	if !ok {
+		return "", "", false
+	}
+
+	ticketField, ok := contextField(fields, 3)
+	if !ok {
+		return "", "", false
+	}
+	var ticket asn1.RawValue
+	if _, err := asn1.Unmarshal(ticketField, &ticket); err != nil || ticket.Class != asn1.ClassApplication || ticket.Tag != 1 {
+		return "", "", false
+	}
+	if fields, ok = sequenceBytes(ticket.Bytes); !ok {
+		return "", "", false
+	}
+
+	realmField, ok := contextField(fields, 1)
+	if !ok {
+		return "", "", false
+	}
+	realm, ok := kerberosString(realmField)
+	if !ok {
+		return "", "", false
+	}
+
+	snameField, ok := contextField(fields, 2)
+	if !ok {
+		return "", "", false
+	}
+	sname, ok := principalName(snameField)
+	if !ok {
+		return "", "", false
+	}
+
+	return realm, sname, true
+}
+
+// principalName returns the components of a PrincipalName joined by slashes:
+// SEQUENCE { name-type [0] Int32, name-string [1] SEQUENCE OF KerberosString }
+func principalName(b []byte) (string, bool) {
+	fields, ok := sequenceBytes(b)
+	if !ok {
+		return "", false
+	}
+	nameField, ok := contextField(fields, 1)
+	if !ok {
+		return "", false
+	}
+	names, ok := sequenceBytes(nameField)
+	if !ok {
+		return "", false
+	}
+
+	var components []string
+	for len(names) > 0 {
+		var name asn1.RawValue
+		var err error
+		if names, err = asn1.Unmarshal(names, &name); err != nil {
+			return "", false
+		}
+		components = append(components, string(name.Bytes))
+	}
+	if len(components) == 0 {
+		return "", false
+	}
+	return strings.Join(components, "/"), true
+}
+
+// kerberosString returns the value of a KerberosString, a GeneralString (tag 27) that
+// encoding/asn1 doesn't unmarshal into a string
+func kerberosString(b []byte) (string, bool) {
+	var s asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &s); err != nil || s.Class != asn1.ClassUniversal || s.Tag != 27 {
+		return "", false
+	}
+	return string(s.Bytes), true
+}
+
+// sequenceBytes returns the contents of a DER SEQUENCE
+func sequenceBytes(b []byte) ([]byte, bool) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &seq); err != nil || seq.Class != asn1.ClassUniversal || seq.Tag != asn1.TagSequence {
+		return nil, false
+	}
+	return seq.Bytes, true
+}
+
+// explicitField returns the contents of the explicitly tagged [tag] value at the start of b
+func explicitField(b []byte, tag int) ([]byte, bool) {
+	var field asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &field); err != nil || field.Class != asn1.ClassContextSpecific || field.Tag != tag {
+		return nil, false
+	}
+	return field.Bytes, true
+}
+
+// contextField returns the contents of the explicitly tagged [tag] field of the contents of a SEQUENCE
+func contextField(fields []byte, tag int) ([]byte, bool) {
+	for len(fields) > 0 {
+		var field asn1.RawValue
+		var err error
+		if fields, err = asn1.Unmarshal(fields, &field); err != nil {
+			return nil, false
+		}
+		if field.Class == asn1.ClassContextSpecific && field.Tag == tag {
+			return field.Bytes, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"testing"
+)
+
+// der encodes a DER value of the given class and tag around contents
+func der(class, tag int, compound bool, contents ...[]byte) []byte {
+	b, err := asn1.Marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: compound, Bytes: cat(contents...)})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func explicit(tag int, contents ...[]byte) []byte {
+	return der(asn1.ClassContextSpecific, tag, true, contents...)
+}
+
+func sequence(contents ...[]byte) []byte {
+	return der(asn1.ClassUniversal, asn1.TagSequence, true, contents...)
+}
+
+func generalString(s string) []byte {
+	return der(asn1.ClassUniversal, 27, false, []byte(s))
+}
+
+func derValue(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// kerberosToken is the initial context token of a Kerberos exchange for a ticket of
+// kafka/broker1.example.com@EXAMPLE.COM, as sent by a Java client but with dummy encrypted parts
+func kerberosToken() []byte {
+	ticket := der(asn1.ClassApplication, 1, true, sequence(
+		explicit(0, derValue(5)),
+		explicit(1, generalString("EXAMPLE.COM")),
+		explicit(2, sequence(
+			explicit(0, derValue(2)), // NT-SRV-INST
+			explicit(1, sequence(generalString("kafka"), generalString("broker1.example.com"))),
+		)),
+		explicit(3, sequence(explicit(0, derValue(18)), explicit(2, derValue([]byte{0xde, 0xad, 0xbe, 0xef})))),
+	))
+	apReq := der(asn1.ClassApplication, 14, true, sequence(
+		explicit(0, derValue(5)),
+		explicit(1, derValue(14)),
+		explicit(2, derValue(asn1.BitString{Bytes: []byte{0x20, 0, 0, 0}, BitLength: 32})),
+		explicit(3, ticket),
+		explicit(4, sequence(explicit(0, derValue(18)), explicit(2, derValue([]byte{0xca, 0xfe})))),
+	))
+	return der(asn1.ClassApplication, 0, true, derValue(kerberosOID), []byte{0x01, 0x00}, apReq)
+}
+
+// spnegoToken wraps a Kerberos token in a SPNEGO NegTokenInit
+func spnegoToken(mechToken []byte) []byte {
+	negTokenInit := explicit(0, sequence(
+		explicit(0, sequence(derValue(kerberosOID))),
+		explicit(2, derValue(mechToken)),
+	))
+	return der(asn1.ClassApplication, 0, true, derValue(spnegoOID), negTokenInit)
+}
+
+func TestParseGssapiInitialToken(t *testing.T) {
+	want := GssapiInitialToken{Realm: "EXAMPLE.COM", ServicePrincipal: "kafka/broker1.example.com"}
+
+	token, ok := ParseGssapiInitialToken(kerberosToken())
+	if !ok || token != want {
+		t.Errorf("parsed Kerberos token as %+v, %v, want %+v", token, ok, want)
+	}
+	if s := token.String(); s != "kafka/broker1.example.com@EXAMPLE.COM" {
+		t.Errorf("token is %q, want kafka/broker1.example.com@EXAMPLE.COM", s)
+	}
+
+	want.Spnego = true
+	if token, ok = ParseGssapiInitialToken(spnegoToken(kerberosToken())); !ok || token != want {
+		t.Errorf("parsed SPNEGO token as %+v, %v, want %+v", token, ok, want)
+	}
+}
+
+func TestParseGssapiInitialTokenRejects(t *testing.T) {
+	krb := kerberosToken()
+	apRep := append([]byte{}, krb...)
+	// the token id follows the mechanism oid, 02 00 is an AP-REP
+	apRep[bytes.Index(apRep, derValue(kerberosOID))+len(derValue(kerberosOID))] = 0x02
+
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"scram", []byte("n,,n=user,r=abc")},
+		{"plain", []byte("\x00alice\x00secret")},
+		{"ap-rep", apRep},
+		{"trailing bytes", append(append([]byte{}, krb...), 0)},
+		{"other mechanism", der(asn1.ClassApplication, 0, true, derValue(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 14}), []byte{0x01, 0x00})},
+		{"spnego without mech token", der(asn1.ClassApplication, 0, true, derValue(spnegoOID), explicit(0, sequence()))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if token, ok := ParseGssapiInitialToken(tt.msg); ok {
+				t.Errorf("% x parsed as %+v", tt.msg, token)
+			}
+		})
+	}
+}
+
+func TestParseGssapiInitialTokenTruncated(t *testing.T) {
+	for _, msg := range [][]byte{kerberosToken(), spnegoToken(kerberosToken())} {
+		for n := 0; n < len(msg); n++ {
+			if token, ok := ParseGssapiInitialToken(msg[:n]); ok {
+				t.Errorf("% x parsed as %+v", msg[:n], token)
+			}
+		}
+	}
+}
+
+func TestSaslAuthenticateGssapi(t *testing.T) {
+	token := kerberosToken()
+	var req SaslAuthenticateRequest
+	if err := req.Decode(NewPacketDecoder(cat(int32s(int32(len(token))), token)), 1); err != nil {
+		t.Fatalf("decoding the token: %v", err)
+	}
+	if req.Mechanism != "GSSAPI" || req.Gssapi == nil || req.Gssapi.ServicePrincipal != "kafka/broker1.example.com" {
+		t.Errorf("decoded mechanism %q, token %v, want the GSSAPI token of kafka/broker1.example.com", req.Mechanism, req.Gssapi)
+	}
+}
@@ -0,0 +1,82 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// HeartbeatRequest is sent periodically by group members to keep their membership alive
+type HeartbeatRequest struct {
+	Version         int16
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string // v3+, static membership
+}
+
+// key returns the Kafka API key for Heartbeat
+func (r *HeartbeatRequest) key() int16 {
+	return 12
+}
+
+// version returns the Kafka request version
+func (r *HeartbeatRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *HeartbeatRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_9_0_0
+	case 1:
+		return V0_11_0_0
+	case 2:
+		return V2_0_0_0
+	case 3:
+		return V2_3_0_0
+	default:
+		return V2_4_0_0
+	}
+}
+
+// Decode deserializes a Heartbeat request from the given PacketDecoder
+func (r *HeartbeatRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.GroupID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("group id", err)
+	}
+	r.GroupID = BoundString("group_id", r.GroupID)
+
+	if r.GenerationID, err = pd.getInt32(); err != nil {
+		return fieldError("generation id", err)
+	}
+
+	if r.MemberID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("member id", err)
+	}
+	r.MemberID = BoundString("member_id", r.MemberID)
+
+	if version >= 3 {
+		if r.GroupInstanceID, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("group instance id", err)
+		}
+		r.GroupInstanceID = BoundString("group_instance_id", r.GroupInstanceID)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns an empty list, heartbeats don't carry topics
+func (r *HeartbeatRequest) ExtractTopics() []string {
+	return []string{}
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *HeartbeatRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.GroupHeartbeatTotal.WithLabelValues(clientIP, r.GroupID).Inc()
+	storage.AddConsumerGroupMemberInfo(clientIP, r.GroupID, r.MemberID)
+}
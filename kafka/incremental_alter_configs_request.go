@@ -0,0 +1,61 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// IncrementalAlterConfigsRequest sets, deletes, appends to or subtracts from configs of
+// resources, leaving their other configs unchanged
+type IncrementalAlterConfigsRequest struct {
+	Version      int16
+	Resources    []AlterConfigsResource
+	ValidateOnly bool
+}
+
+// key returns the Kafka API key for IncrementalAlterConfigs
+func (r *IncrementalAlterConfigsRequest) key() int16 {
+	return 44
+}
+
+// version returns the Kafka request version
+func (r *IncrementalAlterConfigsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *IncrementalAlterConfigsRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V2_3_0_0
+	default:
+		return V2_4_0_0
+	}
+}
+
+// Decode deserializes an IncrementalAlterConfigs request from the given PacketDecoder
+func (r *IncrementalAlterConfigsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.Resources, err = decodeAlterConfigsResources(pd, flexible, true); err != nil {
+		return err
+	}
+
+	if r.ValidateOnly, err = pd.getBool(); err != nil {
+		return fieldError("validate only", err)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns the topics whose configs are altered
+func (r *IncrementalAlterConfigsRequest) ExtractTopics() []string {
+	return alteredConfigTopics(r.Resources)
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *IncrementalAlterConfigsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	countAlteredConfigs(clientIP, r.Resources)
+}
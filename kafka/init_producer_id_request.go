@@ -0,0 +1,87 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// InitProducerIdRequest is sent by idempotent and transactional producers to get their
+// producer id and epoch
+type InitProducerIdRequest struct {
+	Version int16
+	// TransactionalID is empty for idempotent producers that aren't transactional
+	TransactionalID      string
+	TransactionTimeoutMs int32
+	ProducerID           int64 // v3+, -1 unless an existing producer bumps its epoch
+	ProducerEpoch        int16 // v3+
+}
+
+// key returns the Kafka API key for InitProducerId
+func (r *InitProducerIdRequest) key() int16 {
+	return 22
+}
+
+// version returns the Kafka request version
+func (r *InitProducerIdRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *InitProducerIdRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_11_0_0
+	case 1:
+		return V2_0_0_0
+	case 2:
+		return V2_4_0_0
+	case 3:
+		return V2_5_0_0
+	case 4:
+		return V2_7_0_0
+	default:
+		return V3_0_0_0
+	}
+}
+
+// Decode deserializes an InitProducerId request from the given PacketDecoder
+func (r *InitProducerIdRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.TransactionalID, err = decodeNullableString(pd, flexible); err != nil {
+		return fieldError("transactional id", err)
+	}
+	r.TransactionalID = BoundString("transactional_id", r.TransactionalID)
+
+	if r.TransactionTimeoutMs, err = pd.getInt32(); err != nil {
+		return fieldError("transaction timeout", err)
+	}
+
+	r.ProducerID, r.ProducerEpoch = -1, -1
+	if version >= 3 {
+		if r.ProducerID, err = pd.getInt64(); err != nil {
+			return fieldError("producer id", err)
+		}
+		if r.ProducerEpoch, err = pd.getInt16(); err != nil {
+			return fieldError("producer epoch", err)
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns an empty list, InitProducerId requests don't name topics
+func (r *InitProducerIdRequest) ExtractTopics() []string {
+	return []string{}
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *InitProducerIdRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	if r.TransactionalID == "" {
+		return
+	}
+	metrics.TxnInitTotal.WithLabelValues(clientIP, r.TransactionalID).Inc()
+	storage.AddTransactionalProducerInfo(clientIP, r.TransactionalID)
+}
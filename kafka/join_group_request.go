@@ -0,0 +1,138 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// JoinGroupRequest is sent by group members to join a group, starting a rebalance
+type JoinGroupRequest struct {
+	Version            int16
+	GroupID            string
+	SessionTimeout     int32
+	RebalanceTimeout   int32  // v1+
+	MemberID           string // empty on the first join
+	GroupInstanceID    string // v5+, static membership
+	ProtocolType       string // "consumer" for consumer groups
+	GroupProtocolNames []string
+	Reason             string // v8+
+}
+
+// key returns the Kafka API key for JoinGroup
+func (r *JoinGroupRequest) key() int16 {
+	return 11
+}
+
+// version returns the Kafka request version
+func (r *JoinGroupRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *JoinGroupRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_9_0_0
+	case 1:
+		return V0_10_1_0
+	case 2:
+		return V0_11_0_0
+	case 3:
+		return V2_0_0_0
+	case 4:
+		return V2_2_0_0
+	case 5:
+		return V2_3_0_0
+	case 6:
+		return V2_4_0_0
+	case 7:
+		return V2_5_0_0
+	default:
+		return V3_0_0_0
+	}
+}
+
+// Decode deserializes a JoinGroup request from the given PacketDecoder
+func (r *JoinGroupRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.GroupID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("group id", err)
+	}
+	r.GroupID = BoundString("group_id", r.GroupID)
+
+	if r.SessionTimeout, err = pd.getInt32(); err != nil {
+		return fieldError("session timeout", err)
+	}
+
+	r.RebalanceTimeout = r.SessionTimeout
+	if version >= 1 {
+		if r.RebalanceTimeout, err = pd.getInt32(); err != nil {
+			return fieldError("rebalance timeout", err)
+		}
+	}
+
+	if r.MemberID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("member id", err)
+	}
+	r.MemberID = BoundString("member_id", r.MemberID)
+
+	if version >= 5 {
+		if r.GroupInstanceID, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("group instance id", err)
+		}
+		r.GroupInstanceID = BoundString("group_instance_id", r.GroupInstanceID)
+	}
+
+	if r.ProtocolType, err = decodeString(pd, flexible); err != nil {
+		return fieldError("protocol type", err)
+	}
+	r.ProtocolType = BoundString("protocol_type", r.ProtocolType)
+
+	protocolCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("protocol array", err)
+	}
+
+	if protocolCount > 0 {
+		r.GroupProtocolNames = make([]string, protocolCount)
+	}
+	for i := range r.GroupProtocolNames {
+		if r.GroupProtocolNames[i], err = decodeString(pd, flexible); err != nil {
+			return fieldError("protocol name", err)
+		}
+		// protocol metadata, e.g. the subscription of a consumer
+		if _, err = decodeBytes(pd, flexible); err != nil {
+			return fieldError("protocol metadata", err)
+		}
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if version >= 8 {
+		if r.Reason, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("reason", err)
+		}
+		r.Reason = BoundString("join_reason", r.Reason)
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// ExtractTopics returns an empty list, the subscribed topics are in the opaque protocol metadata
+func (r *JoinGroupRequest) ExtractTopics() []string {
+	return []string{}
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *JoinGroupRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	// The first join of a member has no member id yet, the broker assigns one
+	if r.MemberID != "" {
+		storage.AddConsumerGroupMemberInfo(clientIP, r.GroupID, r.MemberID)
+	}
+}
@@ -0,0 +1,126 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// LeaveGroupRequest is sent by group members leaving a group, starting a rebalance.
+// Up to v2 a member leaves by itself, v3+ batches several members.
+type LeaveGroupRequest struct {
+	Version int16
+	GroupID string
+	Members []LeaveGroupMember
+}
+
+// LeaveGroupMember is a member leaving the group
+type LeaveGroupMember struct {
+	MemberID        string
+	GroupInstanceID string // v3+, static membership
+	Reason          string // v5+
+}
+
+// key returns the Kafka API key for LeaveGroup
+func (r *LeaveGroupRequest) key() int16 {
+	return 13
+}
+
+// version returns the Kafka request version
+func (r *LeaveGroupRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *LeaveGroupRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_9_0_0
+	case 1:
+		return V0_11_0_0
+	case 2:
+		return V2_0_0_0
+	case 3:
+		return V2_3_0_0
+	case 4:
+		return V2_4_0_0
+	default:
+		return V3_0_0_0
+	}
+}
+
+// Decode deserializes a LeaveGroup request from the given PacketDecoder
+func (r *LeaveGroupRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.GroupID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("group id", err)
+	}
+	r.GroupID = BoundString("group_id", r.GroupID)
+
+	if version < 3 {
+		r.Members = make([]LeaveGroupMember, 1)
+		if r.Members[0].MemberID, err = decodeString(pd, flexible); err != nil {
+			return fieldError("member id", err)
+		}
+		r.Members[0].MemberID = BoundString("member_id", r.Members[0].MemberID)
+		return nil
+	}
+
+	memberCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("member array", err)
+	}
+
+	if memberCount > 0 {
+		r.Members = make([]LeaveGroupMember, memberCount)
+	}
+	for i := range r.Members {
+		m := &r.Members[i]
+
+		if m.MemberID, err = decodeString(pd, flexible); err != nil {
+			return fieldError("member id", err)
+		}
+		m.MemberID = BoundString("member_id", m.MemberID)
+
+		if m.GroupInstanceID, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("group instance id", err)
+		}
+		m.GroupInstanceID = BoundString("group_instance_id", m.GroupInstanceID)
+
+		if version >= 5 {
+			if m.Reason, err = decodeNullableString(pd, flexible); err != nil {
+				return fieldError("reason", err)
+			}
+			m.Reason = BoundString("leave_reason", m.Reason)
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// MemberIDs returns the ids of the members leaving the group
+func (r *LeaveGroupRequest) MemberIDs() []string {
+	ids := make([]string, 0, len(r.Members))
+	for _, m := range r.Members {
+		ids = append(ids, m.MemberID)
+	}
+	return ids
+}
+
+// ExtractTopics returns an empty list, leaving a group doesn't carry topics
+func (r *LeaveGroupRequest) ExtractTopics() []string {
+	return []string{}
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *LeaveGroupRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.GroupLeaveTotal.WithLabelValues(clientIP, r.GroupID).Inc()
+}
@@ -47,7 +47,7 @@ func (l *lengthField) reserveLength() int {
 
 func (l *lengthField) check(curOffset int, buf []byte) error {
 	if int32(curOffset-l.startOffset-4) != l.length {
-		return PacketDecodingError{"length field invalid"}
+		return PacketDecodingError{Info: "length field invalid"}
 	}
 
 	return nil
@@ -75,7 +75,7 @@ func (l *varintLengthField) reserveLength() int {
 
 func (l *varintLengthField) check(curOffset int, _ []byte) error {
 	if int64(curOffset-l.startOffset-l.reserveLength()) != l.length {
-		return PacketDecodingError{"length field invalid"}
+		return PacketDecodingError{Info: "length field invalid"}
 	}
 
 	return nil
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// ListGroupsRequest is used by admin and monitoring tools to list the groups of a broker
+type ListGroupsRequest struct {
+	Version int16
+	// StatesFilter are the group states listed, e.g. Stable, all of them when empty (v4+)
+	StatesFilter []string
+	// TypesFilter are the group types listed, e.g. classic or consumer, all of them when empty (v5+)
+	TypesFilter []string
+}
+
+// key returns the Kafka API key for ListGroups
+func (r *ListGroupsRequest) key() int16 {
+	return 16
+}
+
+// version returns the Kafka request version
+func (r *ListGroupsRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *ListGroupsRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_9_0_0
+	case 1:
+		return V0_11_0_0
+	case 2:
+		return V2_0_0_0
+	case 3:
+		return V2_4_0_0
+	case 4:
+		return V2_6_0_0
+	default:
+		return V3_8_0_0
+	}
+}
+
+// Decode deserializes a ListGroups request from the given PacketDecoder. Up to v3 the
+// request has no field.
+func (r *ListGroupsRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if version >= 4 {
+		if r.StatesFilter, err = decodeCompactStrings(pd); err != nil {
+			return fieldError("states filter", err)
+		}
+	}
+	if version >= 5 {
+		if r.TypesFilter, err = decodeCompactStrings(pd); err != nil {
+			return fieldError("types filter", err)
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// decodeCompactStrings reads a compact array of compact strings
+func decodeCompactStrings(pd PacketDecoder) ([]string, error) {
+	count, err := pd.getCompactArrayLength()
+	if err != nil || count <= 0 {
+		return nil, err
+	}
+
+	strs := make([]string, count)
+	for i := range strs {
+		if strs[i], err = pd.getCompactString(); err != nil {
+			return nil, err
+		}
+	}
+	return strs, nil
+}
+
+// ExtractTopics returns an empty list as ListGroups doesn't relate to topics
+func (r *ListGroupsRequest) ExtractTopics() []string {
+	return []string{}
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *ListGroupsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.ListGroupsTotal.WithLabelValues(clientIP, fmt.Sprintf("%d", r.Version)).Inc()
+}
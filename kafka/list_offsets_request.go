@@ -131,13 +131,13 @@ func (r *ListOffsetsRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *ListOffsetsRequest) CollectClientMetrics(clientIP string) {
+func (r *ListOffsetsRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
 	// Include API version in request metrics
 	versionStr := fmt.Sprintf("%d", r.Version)
 	metrics.RequestsCount.WithLabelValues(clientIP, "list_offsets", versionStr).Inc()
 	
 	// Collect metrics for ListOffsets operation - track topic relations
 	for _, topic := range r.Topics {
-		metrics.AddConsumerTopicRelationInfo(clientIP, topic.Topic)
+		storage.AddConsumerTopicRelationInfo(clientIP, topic.Topic)
 	}
 }
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDescribeLogDirsRequest(t *testing.T) {
+	orders := []LogDirTopic{{Topic: "orders", Partitions: []int32{0, 2}}}
+
+	tests := []struct {
+		name      string
+		version   int16
+		raw       []byte
+		want      []LogDirTopic
+		allTopics bool
+	}{
+		{"v1", 1, cat(int32s(1), str("orders"), int32s(2), int32s(0), int32s(2)), orders, false},
+		{"v1 all topics", 1, int32s(-1), nil, true},
+		{"v2 flexible", 2, cat([]byte{2}, compactStr("orders"), []byte{3}, int32s(0), int32s(2), []byte{0}, []byte{0}), orders, false},
+		// a tagged field of tag 1 and 1 byte after the topic list
+		{"v2 tagged fields", 2, cat([]byte{2}, compactStr("orders"), []byte{3}, int32s(0), int32s(2), []byte{0}, []byte{1, 1, 1, 'x'}), orders, false},
+		{"v4 all topics", 4, []byte{0, 0}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := DecodeBody(35, tt.version, tt.raw)
+			if err != nil {
+				t.Fatalf("decoding % x: %v", tt.raw, err)
+			}
+			req := body.(*DescribeLogDirsRequest)
+			if !reflect.DeepEqual(req.Topics, tt.want) || req.AllTopics() != tt.allTopics {
+				t.Errorf("decoded %+v, want %+v", req.Topics, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlterReplicaLogDirsRequest(t *testing.T) {
+	want := []AlterReplicaLogDir{{
+		Path:   "/data/disk2",
+		Topics: []LogDirTopic{{Topic: "orders", Partitions: []int32{1}}},
+	}}
+
+	tests := []struct {
+		name    string
+		version int16
+		raw     []byte
+	}{
+		{"v1", 1, cat(int32s(1), str("/data/disk2"), int32s(1), str("orders"), int32s(1), int32s(1))},
+		{"v2 flexible", 2, cat([]byte{2}, compactStr("/data/disk2"), []byte{2}, compactStr("orders"), []byte{2}, int32s(1), []byte{0}, []byte{0}, []byte{0})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := DecodeBody(34, tt.version, tt.raw)
+			if err != nil {
+				t.Fatalf("decoding % x: %v", tt.raw, err)
+			}
+			req := body.(*AlterReplicaLogDirsRequest)
+			if !reflect.DeepEqual(req.Dirs, want) {
+				t.Errorf("decoded %+v, want %+v", req.Dirs, want)
+			}
+			if topics := req.ExtractTopics(); !reflect.DeepEqual(topics, []string{"orders"}) {
+				t.Errorf("extracted topics %v, want orders", topics)
+			}
+		})
+	}
+}
@@ -3,67 +3,122 @@ package kafka
 import (
 	"fmt"
 	"log"
-	"os"
 	"sync"
 	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 )
 
+// DefaultSummaryLogPath is the summary log file used unless configured otherwise
+const DefaultSummaryLogPath = "kafka_activity_summary.log"
+
 var (
 	// Default logger to a separate file for important events
 	summaryLogger *SummaryLogger
 	once          sync.Once
+
+	summaryLogConfig = SummaryLogConfig{Path: DefaultSummaryLogPath}
 )
 
-// SummaryLogger manages writing important events to a separate file
+// SummaryLogConfig configures the summary log
+type SummaryLogConfig struct {
+	// Path of the file, the summary log is disabled when empty
+	Path string
+	// Output is the URI of the summary log destination, overriding Path: file:///path,
+	// stdout, syslog://host:port (UDP), syslog+tcp://host:port, or syslog:// for the local
+	// syslog daemon. Path is used when empty.
+	Output string
+	// Format of the lines, SummaryFormatText or SummaryFormatJSON, the log format when empty
+	Format string
+	// MaxSize is the size in bytes at which the file is rotated, 0 never rotates
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept, as Path.1 (the newest) to Path.MaxFiles
+	MaxFiles int
+}
+
+// ConfigureSummaryLog sets the configuration of the summary log. It must be called before
+// the first GetSummaryLogger.
+func ConfigureSummaryLog(config SummaryLogConfig) error {
+	if config.MaxSize < 0 || config.MaxFiles < 0 {
+		return fmt.Errorf("summary log max size and max files must not be negative")
+	}
+	if config.MaxSize > 0 && config.MaxFiles == 0 {
+		return fmt.Errorf("summary log rotation needs at least one rotated file to keep")
+	}
+	if config.Format != "" && config.Format != SummaryFormatText && config.Format != SummaryFormatJSON {
+		return fmt.Errorf("summary log format must be %s or %s, got %q", SummaryFormatText, SummaryFormatJSON, config.Format)
+	}
+	if config.Output != "" {
+		if _, _, err := parseSummaryOutput(config.Output); err != nil {
+			return err
+		}
+	}
+	summaryLogConfig = config
+	return nil
+}
+
+// SummaryLogger manages writing important events to a separate output, a file by default.
+// Events are still logged to the standard log when the summary log is disabled.
 type SummaryLogger struct {
-	file   *os.File
-	logger *log.Logger
-	mu     sync.Mutex
+	config  SummaryLogConfig
+	output  summaryOutput // nil when the summary log is disabled
+	stamped bool          // text lines start with their time
+	failing bool          // the last write failed, it was logged
+	mu      sync.Mutex
+	closed  bool
 }
 
 // GetSummaryLogger returns a singleton instance of the summary logger
 func GetSummaryLogger() *SummaryLogger {
 	once.Do(func() {
-		// Create the summary file
-		file, err := os.OpenFile("kafka_activity_summary.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("Failed to open summary log file: %v", err)
+		summaryLogger = &SummaryLogger{config: summaryLogConfig}
+		if summaryLogConfig.Path == "" && summaryLogConfig.Output == "" {
 			return
 		}
-		
-		summaryLogger = &SummaryLogger{
-			file:   file,
-			logger: log.New(file, "", log.LstdFlags),
+
+		// Open the summary output
+		output, stamped, err := openSummaryOutput(summaryLogConfig)
+		if err != nil {
+			log.Printf("Failed to open summary log: %v", err)
+			return
 		}
+		summaryLogger.output, summaryLogger.stamped = output, stamped
 	})
 	return summaryLogger
 }
 
+// json tells whether the lines are JSON objects
+func (sl *SummaryLogger) json() bool {
+	if sl.config.Format == "" {
+		return logging.JSON()
+	}
+	return sl.config.Format == SummaryFormatJSON
+}
+
 // LogAuthentication logs SASL authentication events to both standard log and summary
 func (sl *SummaryLogger) LogAuthentication(clientIP, mechanism, username string) {
-	if sl == nil || sl.logger == nil {
+	if sl == nil {
 		return
 	}
 	
 	message := fmt.Sprintf("Client: %s, Auth: %s, Username: %s", clientIP, mechanism, username)
+	fields := logging.Fields{"client_ip": clientIP, "mechanism": mechanism, "username": username}
 	
 	// Standard log using the normal logger
-	log.Printf("Client: %s, Raw SASL Auth, Mechanism: %s, Username: %s", clientIP, mechanism, username)
+	logging.Audit("auth", fields, "Client: %s, Raw SASL Auth, Mechanism: %s, Username: %s", clientIP, mechanism, username)
 	
 	// Also log to summary file
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-	sl.logger.Println(message)
+	sl.write(time.Now(), "auth", fields, message)
 }
 
 // LogTopicProduction logs produce events to both standard log and summary
-func (sl *SummaryLogger) LogTopicProduction(clientIP, clientPort, topic, username string) {
-	if sl == nil || sl.logger == nil {
+func (sl *SummaryLogger) LogTopicProduction(at time.Time, clientIP, clientPort, topic, username string) {
+	if sl == nil {
 		return
 	}
 	
-	// Format timestamp ourselves to match existing log format
-	timestamp := time.Now().Format("2006/01/02 15:04:05")
+	// Format timestamp ourselves to match existing log format, using the capture time of the request
+	timestamp := at.Format("2006/01/02 15:04:05")
 	
 	userInfo := ""
 	if username != "" {
@@ -72,25 +127,26 @@ func (sl *SummaryLogger) LogTopicProduction(clientIP, clientPort, topic, usernam
 	
 	message := fmt.Sprintf("%s PRODUCE: %s:%s -> topic: %s%s", 
 		timestamp, clientIP, clientPort, topic, userInfo)
+	fields := topicFields(clientIP, clientPort, topic, username)
 	
 	// Standard logs using the normal logger
-	log.Printf("client %s wrote to topic %s", clientIP, topic)
-	log.Printf("client %s:%s wrote to topic %s", clientIP, clientPort, topic)
+	logging.Event("produce", fields, "client %s wrote to topic %s", clientIP, topic)
+	if !logging.JSON() {
+		logging.Printf("client %s:%s wrote to topic %s", clientIP, clientPort, topic)
+	}
 	
 	// Also log to summary file
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-	sl.logger.Println(message)
+	sl.write(at, "produce", fields, message)
 }
 
 // LogTopicConsumption logs consume events to both standard log and summary
-func (sl *SummaryLogger) LogTopicConsumption(clientIP, clientPort, topic, username string) {
-	if sl == nil || sl.logger == nil {
+func (sl *SummaryLogger) LogTopicConsumption(at time.Time, clientIP, clientPort, topic, username string) {
+	if sl == nil {
 		return
 	}
 	
-	// Format timestamp ourselves to match existing log format
-	timestamp := time.Now().Format("2006/01/02 15:04:05")
+	// Format timestamp ourselves to match existing log format, using the capture time of the request
+	timestamp := at.Format("2006/01/02 15:04:05")
 	
 	userInfo := ""
 	if username != "" {
@@ -99,24 +155,71 @@ func (sl *SummaryLogger) LogTopicConsumption(clientIP, clientPort, topic, userna
 	
 	message := fmt.Sprintf("%s CONSUME: %s:%s <- topic: %s%s", 
 		timestamp, clientIP, clientPort, topic, userInfo)
+	fields := topicFields(clientIP, clientPort, topic, username)
 	
 	// Standard logs using the normal logger
-	log.Printf("client %s read from topic %s", clientIP, topic)
-	log.Printf("client %s:%s read from topic %s", clientIP, clientPort, topic)
+	logging.Event("consume", fields, "client %s read from topic %s", clientIP, topic)
+	if !logging.JSON() {
+		logging.Printf("client %s:%s read from topic %s", clientIP, clientPort, topic)
+	}
 	
 	// Also log to summary file
+	sl.write(at, "consume", fields, message)
+}
+
+// topicFields returns the structured fields of a produce or consume event
+func topicFields(clientIP, clientPort, topic, username string) logging.Fields {
+	fields := logging.Fields{"client_ip": clientIP, "src_port": clientPort, "topic": topic}
+	if username != "" {
+		fields["username"] = username
+	}
+	return fields
+}
+
+// write appends an event to the summary log, as the text message or as a JSON line
+// depending on the format
+func (sl *SummaryLogger) write(at time.Time, event string, fields logging.Fields, message string) {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
-	sl.logger.Println(message)
+
+	// events logged while shutting down or after a failed opening are dropped
+	if sl.closed || sl.output == nil {
+		return
+	}
+
+	var line []byte
+	if sl.json() {
+		line = logging.Marshal(at, event, fields)
+	} else if sl.stamped {
+		// the format of a standard logger with log.LstdFlags
+		line = []byte(time.Now().Format("2006/01/02 15:04:05 ") + message + "\n")
+	} else {
+		line = []byte(message + "\n")
+	}
+
+	// a failing output is only reported once, until it works again
+	if _, err := sl.output.Write(line); err != nil {
+		if !sl.failing {
+			log.Printf("Failed to write summary log: %v", err)
+		}
+		sl.failing = true
+		return
+	}
+	sl.failing = false
 }
 
-// Close safely closes the summary log file
+// Close safely closes the summary log output. Events logged afterwards are dropped.
 func (sl *SummaryLogger) Close() error {
-	if sl == nil || sl.file == nil {
+	if sl == nil {
 		return nil
 	}
-	
+
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
-	return sl.file.Close()
+	if sl.closed || sl.output == nil {
+		sl.closed = true
+		return nil
+	}
+	sl.closed = true
+	return sl.output.Close()
 }
@@ -73,7 +73,7 @@ func (m *Message) Decode(pd PacketDecoder) (err error) {
 	}
 
 	if m.Version > 1 {
-		return PacketDecodingError{fmt.Sprintf("unknown magic byte (%v)", m.Version)}
+		return PacketDecodingError{Info: fmt.Sprintf("unknown magic byte (%v)", m.Version)}
 	}
 
 	attribute, err := pd.getInt8()
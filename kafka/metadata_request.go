@@ -31,59 +31,61 @@ func (r *MetadataRequest) requiredVersion() Version {
 }
 
 // Decode deserializes a Metadata request from the given PacketDecoder
-func (r *MetadataRequest) Decode(pd PacketDecoder, version int16) error {
-	// Store version for metrics but use simpler decoding to avoid protocol issues
+func (r *MetadataRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	r.Version = version
+	flexible := isFlexible(r.key(), version)
 
-	// Safety check to prevent panics
-	if pd == nil {
-		r.Topics = []string{}
-		return nil
-	}
-
-	// Basic decoding that works across all versions without protocol alignment issues
-	topicCount, err := pd.getArrayLength()
+	// A null array (v1+) asks for all topics
+	topicCount, err := decodeArrayLength(pd, flexible)
 	if err != nil {
-		// Fallback to empty topics list on error
-		r.Topics = []string{}
-		return nil
+		return fieldError("topic array", err)
 	}
 
-	// Validate topicCount to prevent panics from malformed packets
-	if topicCount <= 0 || topicCount > 10000 {
-		// Instead of failing, just use an empty list
-		r.Topics = []string{}
-		return nil
+	if topicCount > 0 {
+		r.Topics = make([]string, 0, topicCount)
 	}
+	for i := 0; i < topicCount; i++ {
+		if version >= 10 {
+			// topic id, topics are requested either by id or by name
+			if _, err = pd.getRawBytes(16); err != nil {
+				return fieldError("topic id", err)
+			}
+		}
+
+		topic, err := decodeString(pd, flexible)
+		if err != nil {
+			return fieldError("topic name", err)
+		}
+		if topic != "" {
+			r.Topics = append(r.Topics, topic)
+		}
 
-	// Use defer-recover to protect against any panics during decoding
-	var topicsDecoded bool
-	func() {
-		defer func() {
-			if rec := recover(); rec != nil {
-				// If we panic during decoding, reset to empty list
-				r.Topics = []string{}
-				topicsDecoded = false
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
 			}
-		}()
-
-		// Now try to decode the topics
-		r.Topics = make([]string, topicCount)
-		for i := range r.Topics {
-			topic, err := pd.getString()
-			if err != nil {
-				// On error, we'll fall back to the recover block
-				panic("Error decoding topic string")
+		}
+	}
+
+	if version >= 4 {
+		if r.AllowAutoTopicCreation, err = pd.getBool(); err != nil {
+			return fieldError("allow auto topic creation", err)
+		}
+	}
+
+	if version >= 8 {
+		if version <= 10 {
+			if r.IncludeClusterAuthorizedOperations, err = pd.getBool(); err != nil {
+				return fieldError("include cluster authorized operations", err)
 			}
-			r.Topics[i] = topic
 		}
-		topicsDecoded = true
-	}()
+		if r.IncludeTopicAuthorizedOperations, err = pd.getBool(); err != nil {
+			return fieldError("include topic authorized operations", err)
+		}
+	}
 
-	// If topics were not successfully decoded, skip remaining bytes
-	if !topicsDecoded && pd.remaining() > 0 {
-		// Best effort to skip remaining bytes
-		_, _ = pd.getRawBytes(pd.remaining())
+	if flexible {
+		return pd.getTaggedFields()
 	}
 
 	return nil
@@ -95,7 +97,7 @@ func (r *MetadataRequest) ExtractTopics() []string {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *MetadataRequest) CollectClientMetrics(clientIP string) {
+func (r *MetadataRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
 	// Include API version in metrics
 	versionStr := fmt.Sprintf("%d", r.Version)
 	metrics.RequestsCount.WithLabelValues(clientIP, "metadata", versionStr).Inc()
@@ -103,7 +105,7 @@ func (r *MetadataRequest) CollectClientMetrics(clientIP string) {
 	// Collect metadata request metrics for topic relationships
 	for _, topic := range r.Topics {
 		if topic != "" {
-			metrics.AddActiveTopicInfo(clientIP, topic)
+			storage.AddActiveTopicInfo(clientIP, topic)
 		}
 	}
 }
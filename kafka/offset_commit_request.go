@@ -0,0 +1,210 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// OffsetCommitRequest is used by consumers to commit the offsets of a consumer group
+type OffsetCommitRequest struct {
+	Version         int16
+	ConsumerGroup   string
+	GenerationID    int32  // v1+
+	MemberID        string // v1+
+	GroupInstanceID string // v7+, static membership
+	RetentionTime   int64  // v2-v4
+	Topics          []OffsetCommitTopic
+}
+
+// OffsetCommitTopic contains the committed offsets of a topic
+type OffsetCommitTopic struct {
+	Topic      string
+	Partitions []OffsetCommitPartition
+}
+
+// OffsetCommitPartition contains the committed offset of a partition
+type OffsetCommitPartition struct {
+	Partition   int32
+	Offset      int64
+	LeaderEpoch int32 // v6+
+	Timestamp   int64 // v1 only
+	Metadata    string
+}
+
+// key returns the Kafka API key for OffsetCommit
+func (r *OffsetCommitRequest) key() int16 {
+	return 8
+}
+
+// version returns the Kafka request version
+func (r *OffsetCommitRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *OffsetCommitRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_8_2_0
+	case 1, 2:
+		return V0_9_0_0
+	case 3:
+		return V0_11_0_0
+	case 4:
+		return V2_0_0_0
+	case 5, 6:
+		return V2_1_0_0
+	default:
+		return V2_3_0_0
+	}
+}
+
+// Decode deserializes an OffsetCommit request from the given PacketDecoder
+func (r *OffsetCommitRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	r.GenerationID = -1
+	flexible := version >= 8
+
+	if r.ConsumerGroup, err = decodeString(pd, flexible); err != nil {
+		return fieldError("group id", err)
+	}
+	r.ConsumerGroup = BoundString("group_id", r.ConsumerGroup)
+
+	if version >= 1 {
+		if r.GenerationID, err = pd.getInt32(); err != nil {
+			return fieldError("generation id", err)
+		}
+		if r.MemberID, err = decodeString(pd, flexible); err != nil {
+			return fieldError("member id", err)
+		}
+		r.MemberID = BoundString("member_id", r.MemberID)
+	}
+
+	if version >= 7 {
+		var instanceID *string
+		if flexible {
+			var compactID string
+			if compactID, err = pd.getCompactString(); err == nil {
+				instanceID = &compactID
+			}
+		} else {
+			instanceID, err = pd.getNullableString()
+		}
+		if err != nil {
+			return fieldError("group instance id", err)
+		}
+		if instanceID != nil {
+			r.GroupInstanceID = BoundString("group_instance_id", *instanceID)
+		}
+	}
+
+	if version >= 2 && version <= 4 {
+		if r.RetentionTime, err = pd.getInt64(); err != nil {
+			return fieldError("retention time", err)
+		}
+	}
+
+	topicCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		r.Topics = make([]OffsetCommitTopic, topicCount)
+	}
+	for i := range r.Topics {
+		if err = r.Topics[i].decode(pd, version, flexible); err != nil {
+			return err
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (t *OffsetCommitTopic) decode(pd PacketDecoder, version int16, flexible bool) (err error) {
+	if t.Topic, err = decodeString(pd, flexible); err != nil {
+		return fieldError("topic name", err)
+	}
+
+	partitionCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("partition array", err)
+	}
+
+	if partitionCount > 0 {
+		t.Partitions = make([]OffsetCommitPartition, partitionCount)
+	}
+	for i := range t.Partitions {
+		p := &t.Partitions[i]
+		p.LeaderEpoch = -1
+
+		if p.Partition, err = pd.getInt32(); err != nil {
+			return fieldError("partition", err)
+		}
+		if p.Offset, err = pd.getInt64(); err != nil {
+			return fieldError("committed offset", err)
+		}
+		if version >= 6 {
+			if p.LeaderEpoch, err = pd.getInt32(); err != nil {
+				return fieldError("committed leader epoch", err)
+			}
+		}
+		if version == 1 {
+			if p.Timestamp, err = pd.getInt64(); err != nil {
+				return fieldError("commit timestamp", err)
+			}
+		}
+
+		var metadata *string
+		if flexible {
+			var compactMetadata string
+			if compactMetadata, err = pd.getCompactString(); err == nil {
+				metadata = &compactMetadata
+			}
+		} else {
+			metadata, err = pd.getNullableString()
+		}
+		if err != nil {
+			return fieldError("committed metadata", err)
+		}
+		if metadata != nil {
+			p.Metadata = BoundString("commit_metadata", *metadata)
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// GroupID returns the consumer group committing offsets
+func (r *OffsetCommitRequest) GroupID() string {
+	return r.ConsumerGroup
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *OffsetCommitRequest) ExtractTopics() []string {
+	topics := make([]string, len(r.Topics))
+	for i, topic := range r.Topics {
+		topics[i] = topic.Topic
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *OffsetCommitRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	// Committing offsets of a topic means consuming it
+	for _, topic := range r.ExtractTopics() {
+		storage.AddConsumerTopicRelationInfo(clientIP, topic)
+		storage.AddConsumerGroupTopicRelationInfo(clientIP, r.ConsumerGroup, topic)
+	}
+}
@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// OffsetFetchRequest is used by consumers to fetch the committed offsets of consumer groups.
+// Up to v7 it carries a single group, v8+ batches several groups.
+type OffsetFetchRequest struct {
+	Version       int16
+	Groups        []OffsetFetchGroup
+	RequireStable bool // v7+
+}
+
+// OffsetFetchGroup contains the partitions whose committed offsets are fetched for a group
+type OffsetFetchGroup struct {
+	GroupID     string
+	MemberID    string // v9+
+	MemberEpoch int32  // v9+
+	// AllTopics is set when the topic array is null (v2+): the offsets of every topic are fetched
+	AllTopics bool
+	Topics    []OffsetFetchTopic
+}
+
+// OffsetFetchTopic contains the partitions of a topic
+type OffsetFetchTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+// key returns the Kafka API key for OffsetFetch
+func (r *OffsetFetchRequest) key() int16 {
+	return 9
+}
+
+// version returns the Kafka request version
+func (r *OffsetFetchRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *OffsetFetchRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0, 1:
+		return V0_8_2_0
+	case 2:
+		return V0_10_2_0
+	case 3:
+		return V0_11_0_0
+	case 4:
+		return V2_0_0_0
+	case 5:
+		return V2_1_0_0
+	case 6:
+		return V2_4_0_0
+	case 7:
+		return V2_5_0_0
+	default:
+		return V3_0_0_0
+	}
+}
+
+// Decode deserializes an OffsetFetch request from the given PacketDecoder
+func (r *OffsetFetchRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+
+	// Use recover to handle any panics during decoding of malformed packets
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.Groups = nil
+			err = PacketDecodingError{Info: fmt.Sprintf("malformed OffsetFetch request: %v", rec)}
+		}
+	}()
+
+	flexible := isFlexible(r.key(), version)
+
+	if version >= 8 {
+		groupCount, err := pd.getCompactArrayLength()
+		if err != nil {
+			return fieldError("group array", err)
+		}
+		if groupCount > 0 {
+			r.Groups = make([]OffsetFetchGroup, groupCount)
+		}
+		for i := range r.Groups {
+			if err = r.Groups[i].decode(pd, version, flexible); err != nil {
+				return err
+			}
+		}
+	} else {
+		r.Groups = make([]OffsetFetchGroup, 1)
+		if err = r.Groups[0].decode(pd, version, flexible); err != nil {
+			return err
+		}
+	}
+
+	if version >= 7 {
+		if r.RequireStable, err = pd.getBool(); err != nil {
+			return fieldError("require stable", err)
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (g *OffsetFetchGroup) decode(pd PacketDecoder, version int16, flexible bool) (err error) {
+	if g.GroupID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("group id", err)
+	}
+	g.GroupID = BoundString("group_id", g.GroupID)
+
+	if version >= 9 {
+		if g.MemberID, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("member id", err)
+		}
+		g.MemberID = BoundString("member_id", g.MemberID)
+
+		if g.MemberEpoch, err = pd.getInt32(); err != nil {
+			return fieldError("member epoch", err)
+		}
+	}
+
+	topicCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	// a null array (v2+) fetches the offsets of all topics
+	g.AllTopics = topicCount < 0
+	if topicCount > 0 {
+		g.Topics = make([]OffsetFetchTopic, topicCount)
+	}
+	for i := range g.Topics {
+		t := &g.Topics[i]
+
+		if t.Topic, err = decodeString(pd, flexible); err != nil {
+			return fieldError("topic name", err)
+		}
+
+		if flexible {
+			t.Partitions, err = pd.getCompactInt32Array()
+		} else {
+			t.Partitions, err = pd.getInt32Array()
+		}
+		if err != nil {
+			return fieldError("partition array", err)
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if version >= 8 {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// GroupID returns the consumer group of the request, the first one of a batched (v8+) request
+func (r *OffsetFetchRequest) GroupID() string {
+	if len(r.Groups) == 0 {
+		return ""
+	}
+	return r.Groups[0].GroupID
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *OffsetFetchRequest) ExtractTopics() []string {
+	seen := make(map[string]bool)
+	topics := []string{}
+	for _, group := range r.Groups {
+		for _, topic := range group.Topics {
+			if !seen[topic.Topic] {
+				seen[topic.Topic] = true
+				topics = append(topics, topic.Topic)
+			}
+		}
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *OffsetFetchRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	// Fetching the committed offsets of a topic precedes consuming it
+	for _, group := range r.Groups {
+		for _, topic := range group.Topics {
+			storage.AddConsumerTopicRelationInfo(clientIP, topic.Topic)
+			storage.AddConsumerGroupTopicRelationInfo(clientIP, group.GroupID, topic.Topic)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// OffsetForLeaderEpochRequest is used by consumers and follower brokers to find the end offset
+// of a leader epoch, e.g. to detect log truncation after a leader change
+type OffsetForLeaderEpochRequest struct {
+	Version int16
+	// ReplicaID is the broker id of a follower, or -1 for consumers (v3+)
+	ReplicaID int32
+	Topics    []OffsetForLeaderEpochTopic
+}
+
+// OffsetForLeaderEpochTopic contains the partitions of a topic
+type OffsetForLeaderEpochTopic struct {
+	Topic      string
+	Partitions []OffsetForLeaderEpochPartition
+}
+
+// OffsetForLeaderEpochPartition contains the leader epoch looked up for a partition
+type OffsetForLeaderEpochPartition struct {
+	Partition          int32
+	CurrentLeaderEpoch int32 // v2+
+	LeaderEpoch        int32
+}
+
+// key returns the Kafka API key for OffsetForLeaderEpoch
+func (r *OffsetForLeaderEpochRequest) key() int16 {
+	return 23
+}
+
+// version returns the Kafka request version
+func (r *OffsetForLeaderEpochRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *OffsetForLeaderEpochRequest) requiredVersion() Version {
+	return V0_11_0_0
+}
+
+// Decode deserializes an OffsetForLeaderEpoch request from the given PacketDecoder
+func (r *OffsetForLeaderEpochRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	r.ReplicaID = -1
+
+	// Use recover to handle any panics during decoding of malformed packets
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.Topics = nil
+			err = PacketDecodingError{Info: fmt.Sprintf("malformed OffsetForLeaderEpoch request: %v", rec)}
+		}
+	}()
+
+	flexible := isFlexible(r.key(), version)
+
+	if version >= 3 {
+		if r.ReplicaID, err = pd.getInt32(); err != nil {
+			return fieldError("replica id", err)
+		}
+	}
+
+	var topicCount int
+	if flexible {
+		topicCount, err = pd.getCompactArrayLength()
+	} else {
+		topicCount, err = pd.getArrayLength()
+	}
+	if err != nil {
+		return fieldError("topic array", err)
+	}
+
+	if topicCount > 0 {
+		r.Topics = make([]OffsetForLeaderEpochTopic, topicCount)
+	}
+	for i := range r.Topics {
+		if err = r.Topics[i].decode(pd, version, flexible); err != nil {
+			return err
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+func (t *OffsetForLeaderEpochTopic) decode(pd PacketDecoder, version int16, flexible bool) (err error) {
+	var partitionCount int
+	if flexible {
+		if t.Topic, err = pd.getCompactString(); err != nil {
+			return fieldError("topic name", err)
+		}
+		partitionCount, err = pd.getCompactArrayLength()
+	} else {
+		if t.Topic, err = pd.getString(); err != nil {
+			return fieldError("topic name", err)
+		}
+		partitionCount, err = pd.getArrayLength()
+	}
+	if err != nil {
+		return fieldError("partition array", err)
+	}
+	t.Topic = BoundString("topic", t.Topic)
+
+	if partitionCount > 0 {
+		t.Partitions = make([]OffsetForLeaderEpochPartition, partitionCount)
+	}
+	for i := range t.Partitions {
+		p := &t.Partitions[i]
+		if p.Partition, err = pd.getInt32(); err != nil {
+			return fieldError("partition", err)
+		}
+		if version >= 2 {
+			if p.CurrentLeaderEpoch, err = pd.getInt32(); err != nil {
+				return fieldError("current leader epoch", err)
+			}
+		}
+		if p.LeaderEpoch, err = pd.getInt32(); err != nil {
+			return fieldError("leader epoch", err)
+		}
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// FromFollower reports whether the request was sent by a follower broker rather than a consumer
+func (r *OffsetForLeaderEpochRequest) FromFollower() bool {
+	return r.ReplicaID >= 0
+}
+
+// ExtractTopics returns a list of topics in this request
+func (r *OffsetForLeaderEpochRequest) ExtractTopics() []string {
+	topics := make([]string, 0, len(r.Topics))
+	for _, topic := range r.Topics {
+		if topic.Topic != "" {
+			topics = append(topics, topic.Topic)
+		}
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *OffsetForLeaderEpochRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	metrics.OffsetForLeaderEpochTotal.WithLabelValues(clientIP, fmt.Sprintf("%d", r.Version)).Inc()
+}
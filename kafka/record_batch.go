@@ -38,7 +38,8 @@ type RecordBatch struct {
 	PartialTrailingRecord bool
 	IsTransactional       bool
 
-	recordsLen int // uncompressed records size
+	recordsLen  int // uncompressed records size
+	recordCount int // number of records announced by the batch header, also known for partial batches
 }
 
 func (b *RecordBatch) decode(pd PacketDecoder) (err error) {
@@ -105,6 +106,7 @@ func (b *RecordBatch) decode(pd PacketDecoder) (err error) {
 	}
 	if numRecs >= 0 {
 		b.Records = make([]*Record, numRecs)
+		b.recordCount = numRecs
 	}
 
 	bufSize := int(batchLen) - recordBatchOverhead
@@ -15,6 +15,8 @@ type Records struct {
 	recordsType int
 	MsgSet      *MessageSet
 	RecordBatch *RecordBatch
+
+	size int // serialized size of the record set
 }
 
 func (r *Records) setTypeFromMagic(pd PacketDecoder) error {
@@ -52,3 +54,15 @@ func (r *Records) decode(pd PacketDecoder) error {
 	}
 	return fmt.Errorf("unknown records type: %v", r.recordsType)
 }
+
+// decodeSafely decodes records coming from the wire. Corrupted batches (e.g. bad compressed
+// data) must not take the sniffer down, so panics are turned into decoding errors.
+func (r *Records) decodeSafely(pd PacketDecoder) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = PacketDecodingError{Info: fmt.Sprintf("panic decoding records: %v", rec)}
+		}
+	}()
+
+	return r.decode(pd)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strings"
 
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
@@ -15,6 +14,23 @@ var (
 	MaxRequestSize int32 = 100 * 1024 * 1024
 )
 
+// Bounds of MaxRequestSize
+const (
+	minMaxRequestSize = 1024
+	maxMaxRequestSize = 1024 * 1024 * 1024
+)
+
+// SetMaxRequestSize sets MaxRequestSize, requests and responses over it are rejected as invalid.
+// A request is fully buffered before being decoded, so every connection decoding a request
+// may hold up to this size in memory. It must be called before decoding starts.
+func SetMaxRequestSize(size int) error {
+	if size < minMaxRequestSize || size > maxMaxRequestSize {
+		return fmt.Errorf("max request size must be between %d and %d bytes, got %d", minMaxRequestSize, maxMaxRequestSize, size)
+	}
+	MaxRequestSize = int32(size)
+	return nil
+}
+
 // ProtocolBody represents body of kafka request
 type ProtocolBody interface {
 	versionedDecoder
@@ -63,20 +79,33 @@ func (r *Request) Decode(pd PacketDecoder) (err error) {
 
 	r.CorrelationID, err = pd.getInt32() // +4 bytes
 	if err != nil {
-		return err
+		return fieldError("correlation id", err)
 	}
 
-	r.ClientID, err = pd.getString() // +2 + len(r.ClientID) bytes
+	// The client id stays a nullable string in the flexible request header v2, a null one is
+	// decoded as empty
+	clientID, err := pd.getNullableString() // +2 + len(r.ClientID) bytes
 	if err != nil {
-		return err
+		return fieldError("client id", err)
+	}
+	if clientID != nil {
+		r.ClientID = *clientID
+	}
+	r.ClientID = BoundString("client_id", r.ClientID)
+
+	// Request header v2, used by the flexible versions, ends with tagged fields
+	if isFlexible(r.Key, r.Version) {
+		if err = pd.getTaggedFields(); err != nil {
+			return fieldError("header tagged fields", err)
+		}
 	}
 
 	body := allocateBody(r.Key, r.Version)
 
 	// If  we can't (don't want) to unmarshal request structure - we need to discard the rest bytes
 	if body == nil {
-		// discard 10 bytes + clientID length
-		pd.discard(int(r.BodyLength) - 10 - len(r.ClientID))
+		// discard whatever follows the header, its length depends on the header version
+		pd.discard(pd.remaining())
 
 		// Skip Body decoding for now
 		return nil
@@ -84,12 +113,31 @@ func (r *Request) Decode(pd PacketDecoder) (err error) {
 
 	r.Body = body
 	if r.Body == nil {
-		return PacketDecodingError{fmt.Sprintf("unknown Request key (%d)", r.Key)}
+		return PacketDecodingError{Info: fmt.Sprintf("unknown Request key (%d)", r.Key)}
 	}
 
 	return r.Body.Decode(pd, r.Version)
 }
 
+// flexibleVersions maps api keys to their first flexible version, using compact strings,
+// compact arrays and tagged fields. SaslHandshake (17) and OffsetDelete (47) never became
+// flexible, every api added after AlterClientQuotas (49) is flexible from v0.
+var flexibleVersions = map[int16]int16{
+	0: 9, 1: 12, 2: 6, 3: 9, 4: 4, 5: 2, 6: 6, 7: 3, 8: 8, 9: 6,
+	10: 3, 11: 6, 12: 4, 13: 4, 14: 4, 15: 5, 16: 3, 18: 3, 19: 5,
+	20: 4, 21: 2, 22: 2, 23: 4, 24: 3, 25: 3, 26: 3, 27: 1, 28: 3, 29: 2,
+	30: 2, 31: 2, 32: 4, 33: 2, 34: 2, 35: 2, 36: 2, 37: 2, 38: 2, 39: 2,
+	40: 2, 41: 2, 42: 2, 43: 2, 44: 1, 45: 0, 46: 0, 48: 1, 49: 1,
+}
+
+// isFlexible reports whether a request version uses the flexible encoding
+func isFlexible(key, version int16) bool {
+	if first, ok := flexibleVersions[key]; ok {
+		return version >= first
+	}
+	return key > 49
+}
+
 // DecodeLength decodes length from packet
 func DecodeLength(encoded []byte) int32 {
 	return int32(binary.BigEndian.Uint32(encoded[:4]))
@@ -105,57 +153,23 @@ func DecodeVersion(encoded []byte) int16 {
 	return int16(binary.BigEndian.Uint16(encoded[6:]))
 }
 
-// ExtractHeaderInfo returns a map of header information from packet bytes for logging
-func ExtractHeaderInfo(headerBytes []byte) map[string]interface{} {
-	info := make(map[string]interface{})
-	
-	// Make sure we have enough bytes to extract information
-	if len(headerBytes) < 8 {
-		info["bytes_available"] = len(headerBytes)
-		return info
-	}
-	
-	// Extract key header information
-	size := DecodeLength(headerBytes)
-	key := DecodeKey(headerBytes)
-	version := DecodeVersion(headerBytes)
-	
-	// Add to info map
-	info["message_size"] = size
-	info["api_key"] = key
-	info["api_version"] = version
-	
-	// Map common API keys to names for easier debugging
-	apiName := "Unknown"
-	switch key {
-	case 0:
-		apiName = "Produce"
-	case 1:
-		apiName = "Fetch"
-	case 2:
-		apiName = "ListOffsets"
-	case 3:
-		apiName = "Metadata"
-	case 8:
-		apiName = "DescribeGroups"
-	case 10:
-		apiName = "FindCoordinator"
-	case 17:
-		apiName = "SaslHandshake"
-	case 18:
-		apiName = "ApiVersions"
-	case 36:
-		apiName = "SaslAuthenticate"
+// requestPrefixSize is the size of the length, key and version read in front of a request
+const requestPrefixSize = 8
+
+// UnreadBytes returns the bytes of a frame left in the reader after DecodeRequest failed with
+// the given PacketDecodingError: the rest of a message of invalid length, which must be
+// skipped, or none once the body was read and failed to decode.
+func UnreadBytes(err PacketDecodingError, readBytes int) int {
+	if !err.InvalidLength || readBytes < requestPrefixSize {
+		return 0
 	}
-	info["api_name"] = apiName
-	
-	return info
+	return readBytes - requestPrefixSize
 }
 
 // DecodeRequest decodes request from packets delivered by reader
 func DecodeRequest(r io.Reader) (*Request, int, error) {
 	var (
-		needReadBytes = 8
+		needReadBytes = requestPrefixSize
 		readBytes     = make([]byte, needReadBytes)
 	)
 	// read bytes to decode length, key, version
@@ -175,13 +189,13 @@ func DecodeRequest(r io.Reader) (*Request, int, error) {
 	// Ensure we have a reasonable length value before proceeding
 	// Defend against negative lengths, which could cause issues with slice allocation
 	if length < 0 {
-		return nil, needReadBytes, PacketDecodingError{fmt.Sprintf("invalid message length: %d", length)}
+		return nil, needReadBytes, PacketDecodingError{Info: fmt.Sprintf("invalid message length: %d", length), InvalidLength: true}
 	}
 
 	// Check request size to prevent memory allocation issues
 	// 4 is minimum size for CorrelationID
 	if length <= 4 || length > MaxRequestSize {
-		return nil, int(length) + needReadBytes, PacketDecodingError{fmt.Sprintf("message of length %d too large or too small", length)}
+		return nil, int(length) + needReadBytes, PacketDecodingError{Info: fmt.Sprintf("message of length %d too large or too small", length), InvalidLength: true}
 	}
 
 	// We will use a protocol body even for unsupported keys to log and track them
@@ -219,17 +233,47 @@ func DecodeRequest(r io.Reader) (*Request, int, error) {
 	// decode request - if it fails, we'll still return the partial request
 	err = Decode(encodedReq, req)
 	if err != nil {
-		// If we got an invalid length error, we'll still return as much as we can
-		// but we'll wrap the error to indicate it's a length issue
-		if strings.Contains(err.Error(), "invalid length") {
-			err = PacketDecodingError{fmt.Sprintf("invalid length error decoding request key %d (version %d): %v", key, version, err)}
+		// The frame was read whole, whatever failed is its body, e.g. a truncated one returning
+		// ErrInsufficientData. Tell which request failed, the decoders only know the field and
+		// offset.
+		e, ok := err.(PacketDecodingError)
+		if !ok {
+			e = PacketDecodingError{Info: err.Error()}
 		}
-		return req, bytesRead, err
+		e.ApiKey, e.Version, e.HasRequest = key, version, true
+		return req, bytesRead, e
 	}
 
 	return req, bytesRead, nil
 }
 
+// DecodeBody decodes the body of a request of the given key and version, without the size and
+// header in front of it. It returns the concrete body type, e.g. *FetchRequest, so that each
+// decoder can be exercised in isolation with a crafted payload. Errors are PacketDecodingErrors.
+func DecodeBody(key, version int16, payload []byte) (ProtocolBody, error) {
+	body := allocateBody(key, version)
+	if err := Decode(payload, bodyDecoder{body: body, version: version}); err != nil {
+		// as in DecodeRequest, e.g. a truncated payload returning ErrInsufficientData
+		e, ok := err.(PacketDecodingError)
+		if !ok {
+			e = PacketDecodingError{Info: err.Error()}
+		}
+		e.ApiKey, e.Version, e.HasRequest = key, version, true
+		return body, e
+	}
+	return body, nil
+}
+
+// bodyDecoder decodes a request body of a given version
+type bodyDecoder struct {
+	body    ProtocolBody
+	version int16
+}
+
+func (d bodyDecoder) Decode(pd PacketDecoder) error {
+	return d.body.Decode(pd, d.version)
+}
+
 // Helper function to get the minimum of two ints
 func min(a, b int) int {
 	if a < b {
@@ -239,9 +283,7 @@ func min(a, b int) int {
 }
 
 func allocateBody(key, version int16) ProtocolBody {
-	// Return the appropriate request body based on the API key
-	// We handle all keys from the Kafka protocol (0-67) as of Kafka 3.0+
-	// For the full list of API keys, see: https://kafka.apache.org/protocol#protocol_api_keys
+	// Return the appropriate request body based on the API key, the names of all keys are in apiNames
 	switch key {
 	// Implemented requests (with full decoding support)
 	case 0: // Produce
@@ -252,155 +294,68 @@ func allocateBody(key, version int16) ProtocolBody {
 		return &ListOffsetsRequest{}
 	case 3: // Metadata
 		return &MetadataRequest{}
-	case 8: // DescribeGroups (in some versions this was OffsetCommit)
-		return &DescribeGroupsRequest{}
+	case 8: // OffsetCommit
+		return &OffsetCommitRequest{}
 	case 10: // FindCoordinator
 		return &FindCoordinatorRequest{}
 	case 18: // ApiVersions
 		return &ApiVersionsRequest{}
-	case 19: // DeleteTopics
+	case 19: // CreateTopics
+		return &CreateTopicsRequest{}
+	case 20: // DeleteTopics
 		return &DeleteTopicsRequest{}
+	case 21: // DeleteRecords
+		return &DeleteRecordsRequest{Version: version}
+	case 30: // CreateAcls
+		return &CreateAclsRequest{Version: version}
+	case 31: // DeleteAcls
+		return &DeleteAclsRequest{Version: version}
+	case 22: // InitProducerId
+		return &InitProducerIdRequest{Version: version}
+	case 23: // OffsetForLeaderEpoch
+		return &OffsetForLeaderEpochRequest{}
+	case 24: // AddPartitionsToTxn
+		return &AddPartitionsToTxnRequest{Version: version}
 	case 32: // DescribeConfigs
 		return &DescribeConfigsRequest{}
-	
-	// Known API keys without full implementation - return GenericRequest
-	// These will still be identified correctly but won't decode all fields
-	case 4: // LeaderAndIsr
-		return &GenericRequest{ApiKey: key, ApiName: "LeaderAndIsr"}
-	case 5: // StopReplica
-		return &GenericRequest{ApiKey: key, ApiName: "StopReplica"}
-	case 6: // UpdateMetadata
-		return &GenericRequest{ApiKey: key, ApiName: "UpdateMetadata"}
-	case 7: // ControlledShutdown
-		return &GenericRequest{ApiKey: key, ApiName: "ControlledShutdown"}
+	case 33: // AlterConfigs
+		return &AlterConfigsRequest{Version: version}
+	case 34: // AlterReplicaLogDirs
+		return &AlterReplicaLogDirsRequest{}
+	case 35: // DescribeLogDirs
+		return &DescribeLogDirsRequest{}
+	case 37: // CreatePartitions
+		return &CreatePartitionsRequest{}
+	case 44: // IncrementalAlterConfigs
+		return &IncrementalAlterConfigsRequest{Version: version}
+	case 50: // DescribeUserScramCredentials
+		return &DescribeUserScramCredentialsRequest{}
+	case 51: // AlterUserScramCredentials
+		return &AlterUserScramCredentialsRequest{}
+	case 61: // DescribeProducers
+		return &DescribeProducersRequest{}
 	case 9: // OffsetFetch
-		return &GenericRequest{ApiKey: key, ApiName: "OffsetFetch"}
+		return &OffsetFetchRequest{Version: version}
 	case 11: // JoinGroup
-		return &GenericRequest{ApiKey: key, ApiName: "JoinGroup"}
+		return &JoinGroupRequest{Version: version}
 	case 12: // Heartbeat
-		return &GenericRequest{ApiKey: key, ApiName: "Heartbeat"}
+		return &HeartbeatRequest{Version: version}
 	case 13: // LeaveGroup
-		return &GenericRequest{ApiKey: key, ApiName: "LeaveGroup"}
+		return &LeaveGroupRequest{Version: version}
 	case 14: // SyncGroup
-		return &GenericRequest{ApiKey: key, ApiName: "SyncGroup"}
+		return &SyncGroupRequest{Version: version}
 	case 15: // DescribeGroups
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeGroups"}
+		return &DescribeGroupsRequest{}
 	case 16: // ListGroups
-		return &GenericRequest{ApiKey: key, ApiName: "ListGroups"}
+		return &ListGroupsRequest{}
 	case 17: // SaslHandshake
 		return &SaslHandshakeRequest{}
-	case 20: // DeleteRecords
-		return &GenericRequest{ApiKey: key, ApiName: "DeleteRecords"}
-	case 21: // InitProducerId
-		return &GenericRequest{ApiKey: key, ApiName: "InitProducerId"}
-	case 22: // OffsetForLeaderEpoch
-		return &GenericRequest{ApiKey: key, ApiName: "OffsetForLeaderEpoch"}
-	case 23: // AddPartitionsToTxn
-		return &GenericRequest{ApiKey: key, ApiName: "AddPartitionsToTxn"}
-	case 24: // AddOffsetsToTxn
-		return &GenericRequest{ApiKey: key, ApiName: "AddOffsetsToTxn"}
-	case 25: // EndTxn
-		return &GenericRequest{ApiKey: key, ApiName: "EndTxn"}
-	case 26: // WriteTxnMarkers
-		return &GenericRequest{ApiKey: key, ApiName: "WriteTxnMarkers"}
-	case 27: // TxnOffsetCommit
-		return &GenericRequest{ApiKey: key, ApiName: "TxnOffsetCommit"}
-	case 28: // DescribeAcls
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeAcls"}
-	case 29: // CreateAcls
-		return &GenericRequest{ApiKey: key, ApiName: "CreateAcls"}
-	case 30: // DeleteAcls
-		return &GenericRequest{ApiKey: key, ApiName: "DeleteAcls"}
-	case 31: // DeleteAcls
-		return &GenericRequest{ApiKey: key, ApiName: "DeleteAcls"}
-	case 33: // AlterConfigs
-		return &GenericRequest{ApiKey: key, ApiName: "AlterConfigs"}
-	case 34: // AlterReplicaLogDirs
-		return &GenericRequest{ApiKey: key, ApiName: "AlterReplicaLogDirs"}
-	case 35: // DescribeLogDirs
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeLogDirs"}
 	case 36: // SaslAuthenticate
 		return &SaslAuthenticateRequest{}
-	case 37: // CreatePartitions
-		return &GenericRequest{ApiKey: key, ApiName: "CreatePartitions"}
-	case 38: // CreateDelegationToken
-		return &GenericRequest{ApiKey: key, ApiName: "CreateDelegationToken"}
-	case 39: // RenewDelegationToken
-		return &GenericRequest{ApiKey: key, ApiName: "RenewDelegationToken"}
-	case 40: // ExpireDelegationToken
-		return &GenericRequest{ApiKey: key, ApiName: "ExpireDelegationToken"}
-	case 41: // DescribeDelegationToken
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeDelegationToken"}
-	case 42: // DeleteGroups
-		return &GenericRequest{ApiKey: key, ApiName: "DeleteGroups"}
-	case 43: // ElectLeaders
-		return &GenericRequest{ApiKey: key, ApiName: "ElectLeaders"}
-	case 44: // IncrementalAlterConfigs
-		return &GenericRequest{ApiKey: key, ApiName: "IncrementalAlterConfigs"}
-	case 45: // AlterPartitionReassignments
-		return &GenericRequest{ApiKey: key, ApiName: "AlterPartitionReassignments"}
-	case 46: // ListPartitionReassignments
-		return &GenericRequest{ApiKey: key, ApiName: "ListPartitionReassignments"}
-	case 47: // OffsetDelete
-		return &GenericRequest{ApiKey: key, ApiName: "OffsetDelete"}
-	case 48: // DescribeClientQuotas
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeClientQuotas"}
-	case 49: // AlterClientQuotas
-		return &GenericRequest{ApiKey: key, ApiName: "AlterClientQuotas"}
-	case 50: // DescribeUserScramCredentials
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeUserScramCredentials"}
-	case 51: // AlterUserScramCredentials
-		return &GenericRequest{ApiKey: key, ApiName: "AlterUserScramCredentials"}
-	case 52: // VoteRequest
-		return &GenericRequest{ApiKey: key, ApiName: "VoteRequest"}
-	case 53: // BeginQuorumEpoch
-		return &GenericRequest{ApiKey: key, ApiName: "BeginQuorumEpoch"}
-	case 54: // EndQuorumEpoch
-		return &GenericRequest{ApiKey: key, ApiName: "EndQuorumEpoch"}
-	case 55: // DescribeQuorum
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeQuorum"}
-	case 56: // AlterIsr
-		return &GenericRequest{ApiKey: key, ApiName: "AlterIsr"}
-	case 57: // UpdateFeatures
-		return &GenericRequest{ApiKey: key, ApiName: "UpdateFeatures"}
-	case 58: // Envelope
-		return &GenericRequest{ApiKey: key, ApiName: "Envelope"}
-	case 59: // FetchSnapshot
-		return &GenericRequest{ApiKey: key, ApiName: "FetchSnapshot"}
-	case 60: // DescribeCluster
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeCluster"}
-	case 61: // DescribeProducers
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeProducers"}
-	case 62: // BrokerRegistration
-		return &GenericRequest{ApiKey: key, ApiName: "BrokerRegistration"}
-	case 63: // BrokerHeartbeat
-		return &GenericRequest{ApiKey: key, ApiName: "BrokerHeartbeat"}
-	case 64: // UnregisterBroker
-		return &GenericRequest{ApiKey: key, ApiName: "UnregisterBroker"}
-	case 65: // DescribeTransactions
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeTransactions"}
-	case 66: // ListTransactions
-		return &GenericRequest{ApiKey: key, ApiName: "ListTransactions"}
-	case 67: // AllocateProducerIds
-		return &GenericRequest{ApiKey: key, ApiName: "AllocateProducerIds"}
-	case 68: // ConsumerGroupHeartbeat
-		return &GenericRequest{ApiKey: key, ApiName: "ConsumerGroupHeartbeat"}
-	case 69: // ConsumerGroupDescribe
-		return &GenericRequest{ApiKey: key, ApiName: "ConsumerGroupDescribe"}
-	case 71: // GetTelemetrySubscriptions
-		return &GenericRequest{ApiKey: key, ApiName: "GetTelemetrySubscriptions"}
-	case 72: // PushTelemetry
-		return &GenericRequest{ApiKey: key, ApiName: "PushTelemetry"}
-	case 74: // ListClientMetricsResources
-		return &GenericRequest{ApiKey: key, ApiName: "ListClientMetricsResources"}
-	case 75: // DescribeTopicPartitions
-		return &GenericRequest{ApiKey: key, ApiName: "DescribeTopicPartitions"}
-	case 80: // AddRaftVoter
-		return &GenericRequest{ApiKey: key, ApiName: "AddRaftVoter"}
-	case 81: // RemoveRaftVoter
-		return &GenericRequest{ApiKey: key, ApiName: "RemoveRaftVoter"}
+
+	// Known API keys without full implementation, and future API keys we don't know about yet.
+	// These will still be named but won't decode all fields.
 	default:
-		// For any future API keys we don't know about yet
-		return &GenericRequest{ApiKey: key, ApiName: fmt.Sprintf("Unknown(%d)", key)}
+		return &GenericRequest{ApiKey: key, ApiName: ApiName(key)}
 	}
 }
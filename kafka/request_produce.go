@@ -1,7 +1,6 @@
 package kafka
 
 import (
-	"fmt"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
@@ -12,6 +11,15 @@ import (
 // by setting the `min.isr` value in the brokers configuration).
 type RequiredAcks int16
 
+const (
+	// NoResponse doesn't send any response, the TCP ACK is all you get.
+	NoResponse RequiredAcks = 0
+	// WaitForLocal waits for only the local commit to succeed before responding.
+	WaitForLocal RequiredAcks = 1
+	// WaitForAll waits for all in-sync replicas to commit before responding.
+	WaitForAll RequiredAcks = -1
+)
+
 // ProduceRequest is a type of request in kafka
 type ProduceRequest struct {
 	TransactionalID *string
@@ -22,67 +30,99 @@ type ProduceRequest struct {
 }
 
 // Decode decodes kafka produce request from packet
-func (r *ProduceRequest) Decode(pd PacketDecoder, version int16) error {
+func (r *ProduceRequest) Decode(pd PacketDecoder, version int16) (err error) {
 	r.Version = version
+	flexible := version >= 9
 
 	if version >= 3 {
-		id, err := pd.getNullableString()
+		var id *string
+		if flexible {
+			var compactID string
+			if compactID, err = pd.getCompactString(); err == nil && compactID != "" {
+				id = &compactID
+			}
+		} else {
+			id, err = pd.getNullableString()
+		}
 		if err != nil {
-			return err
+			return fieldError("transactional id", err)
+		}
+		if id != nil {
+			bounded := BoundString("transactional_id", *id)
+			id = &bounded
 		}
 		r.TransactionalID = id
 	}
 	requiredAcks, err := pd.getInt16()
 	if err != nil {
-		return err
+		return fieldError("acks", err)
 	}
 	r.RequiredAcks = RequiredAcks(requiredAcks)
 	if r.Timeout, err = pd.getInt32(); err != nil {
-		return err
+		return fieldError("timeout", err)
 	}
-	topicCount, err := pd.getArrayLength()
+	topicCount, err := decodeArrayLength(pd, flexible)
 	if err != nil {
-		return err
+		return fieldError("topic array", err)
 	}
-	if topicCount == 0 {
+	if topicCount <= 0 {
 		return nil
 	}
 
 	r.records = make(map[string]map[int32]Records)
 	for i := 0; i < topicCount; i++ {
-		topic, err := pd.getString()
+		topic, err := decodeString(pd, flexible)
 		if err != nil {
-			return err
+			return fieldError("topic name", err)
 		}
-		partitionCount, err := pd.getArrayLength()
+		partitionCount, err := decodeArrayLength(pd, flexible)
 		if err != nil {
-			return err
+			return fieldError("partition array", err)
 		}
 		r.records[topic] = make(map[int32]Records)
 
 		for j := 0; j < partitionCount; j++ {
 			partition, err := pd.getInt32()
 			if err != nil {
-				return err
+				return fieldError("partition", err)
+			}
+
+			var recordSet []byte
+			if flexible {
+				recordSet, err = pd.getCompactBytes()
+			} else {
+				recordSet, err = pd.getBytes()
 			}
-			size, err := pd.getInt32()
 			if err != nil {
-				return err
+				return fieldError("record set", err)
 			}
 
-			// rewind decoder to size
-			recordsDecoder, err := pd.getSubset(int(size))
-			if err != nil {
-				return err
+			records := Records{size: len(recordSet)}
+			if len(recordSet) > 0 {
+				if err := records.decodeSafely(&RealDecoder{raw: recordSet}); err != nil {
+					return fieldError("records", err)
+				}
+			}
+			r.records[topic][partition] = records
+
+			if flexible {
+				if err = pd.getTaggedFields(); err != nil {
+					return err
+				}
 			}
-			var records Records
-			if err := records.decode(recordsDecoder); err != nil {
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
 				return err
 			}
-			r.records[topic][partition] = records
 		}
 	}
 
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
 	return nil
 }
 
@@ -105,7 +145,64 @@ func (r *ProduceRequest) ExtractTopics() []string {
 	return out
 }
 
-// RecordsLen retrieves total size in bytes of all records in message
+// PartitionCount returns the number of partitions produced to in a topic
+func (r *ProduceRequest) PartitionCount(topic string) int {
+	return len(r.records[topic])
+}
+
+// RecordHeaders returns the headers of each record by topic. Only v2 record batches
+// (Kafka 0.11+) carry headers, records of legacy message sets are skipped.
+func (r *ProduceRequest) RecordHeaders() map[string][][]*RecordHeader {
+	out := make(map[string][][]*RecordHeader)
+	for topic, partition := range r.records {
+		for _, records := range partition {
+			if records.recordsType != defaultRecords || records.RecordBatch == nil {
+				continue
+			}
+			for _, record := range records.RecordBatch.Records {
+				if record != nil && len(record.Headers) > 0 {
+					out[topic] = append(out[topic], record.Headers)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// RecordKeys returns the keys of each record by topic, nil for records produced without a key.
+// Records of legacy message sets are included, the ones of compressed sets unwrapped.
+func (r *ProduceRequest) RecordKeys() map[string][][]byte {
+	out := make(map[string][][]byte)
+	for topic, partition := range r.records {
+		for _, records := range partition {
+			switch records.recordsType {
+			case legacyRecords:
+				if records.MsgSet == nil {
+					continue
+				}
+				for _, block := range records.MsgSet.Messages {
+					for _, msg := range block.Messages() {
+						if msg.Msg != nil {
+							out[topic] = append(out[topic], msg.Msg.Key)
+						}
+					}
+				}
+			case defaultRecords:
+				if records.RecordBatch == nil {
+					continue
+				}
+				for _, record := range records.RecordBatch.Records {
+					if record != nil {
+						out[topic] = append(out[topic], record.Key)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// RecordsLen retrieves total number of records in message
 func (r *ProduceRequest) RecordsLen() (recordsLen int) {
 	for _, partition := range r.records {
 		for _, record := range partition {
@@ -113,41 +210,68 @@ func (r *ProduceRequest) RecordsLen() (recordsLen int) {
 			case legacyRecords:
 				recordsLen += len(record.MsgSet.Messages)
 			case defaultRecords:
-				recordsLen += len(record.RecordBatch.Records)
+				recordsLen += record.RecordBatch.recordCount
 			}
 		}
 	}
 	return
 }
 
-// RecordsSize retrieves total number of records in batch
+// RecordsSize retrieves total size in bytes of all record sets in message, as serialized on the wire
 func (r *ProduceRequest) RecordsSize() (recordsSize int) {
 	for _, partition := range r.records {
 		for _, record := range partition {
-			switch record.recordsType {
-			case legacyRecords:
-				for _, msg := range record.MsgSet.Messages {
-					recordsSize += msg.Msg.compressedSize
-				}
-			case defaultRecords:
-				recordsSize += record.RecordBatch.recordsLen
+			recordsSize += record.size
+		}
+	}
+	return
+}
+
+// Idempotent reports whether the request was sent by an idempotent producer: its record
+// batches carry a producer id, which is -1 for other producers. Legacy message sets, produced
+// before v3, have none.
+func (r *ProduceRequest) Idempotent() bool {
+	for _, partition := range r.records {
+		for _, records := range partition {
+			if records.recordsType == defaultRecords && records.RecordBatch != nil && records.RecordBatch.ProducerID >= 0 {
+				return true
 			}
 		}
 	}
+	return false
+}
+
+// TopicRecordsSize returns the size in bytes of the record sets produced to a topic, as
+// serialized on the wire
+func (r *ProduceRequest) TopicRecordsSize(topic string) (recordsSize int) {
+	for _, record := range r.records[topic] {
+		recordsSize += record.size
+	}
 	return
 }
 
 // CollectClientMetrics collects metrics associated with client
-func (r *ProduceRequest) CollectClientMetrics(srcHost string) {
-	// Include API version in metrics
-	versionStr := fmt.Sprintf("%d", r.Version)
-	metrics.RequestsCount.WithLabelValues(srcHost, "produce", versionStr).Inc()
-
+func (r *ProduceRequest) CollectClientMetrics(storage *metrics.Storage, srcHost string) {
+	// RequestsCount is already counted with the request header
 	batchSize := r.RecordsSize()
 	metrics.ProducerBatchSize.WithLabelValues(srcHost).Add(float64(batchSize))
 
 	batchLen := r.RecordsLen()
 	metrics.ProducerBatchLen.WithLabelValues(srcHost).Add(float64(batchLen))
+
+	if r.Idempotent() {
+		metrics.IdempotentProduceTotal.WithLabelValues(srcHost).Inc()
+	} else {
+		metrics.NonIdempotentProduceTotal.WithLabelValues(srcHost).Inc()
+	}
+
+	// Acks and the transactional id tell fire-and-forget producers from transactional ones
+	storage.SetProducerAcks(srcHost, int16(r.RequiredAcks), r.TransactionalID != nil)
+	// Timeouts far from the broker's request.timeout.ms tell misconfigured producers
+	storage.SetProduceTimeout(srcHost, r.Timeout)
+	if r.TransactionalID != nil {
+		storage.AddTransactionalProducerInfo(srcHost, *r.TransactionalID)
+	}
 }
 
 func (r *ProduceRequest) requiredVersion() Version {
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func int16s(v int16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func int32s(v int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func str(s string) []byte {
+	return append(int16s(int16(len(s))), s...)
+}
+
+// compactStr encodes a compact string, whose length is stored plus one
+func compactStr(s string) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(b, uint64(len(s)+1))
+	return append(b[:n], s...)
+}
+
+func cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+// requestFrame encodes a request of the given api key and version in front of the rest of
+// its header and its body
+func requestFrame(key, version int16, rest ...[]byte) []byte {
+	payload := cat(int16s(key), int16s(version), cat(rest...))
+	return cat(int32s(int32(len(payload))), payload)
+}
+
+// topicID is a topic id of a Metadata request, requesting a topic by id rather than by name
+var topicID = bytes.Repeat([]byte{0xab}, 16)
+
+func TestDecodeFlexibleRequestHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		clientID string
+	}{
+		{"no tagged fields", cat(int32s(7), str("consumer-1"), []byte{0}), "consumer-1"},
+		// a tagged field of tag 3 and 2 bytes, unknown to the decoder
+		{"tagged fields", cat(int32s(7), str("consumer-1"), []byte{1, 3, 2, 'a', 'b'}), "consumer-1"},
+		{"null client id", cat(int32s(7), int16s(-1), []byte{0}), ""},
+	}
+
+	// two topics, requested by name and by id, allowing auto topic creation
+	body := cat([]byte{3},
+		make([]byte, 16), compactStr("orders"), []byte{0},
+		topicID, []byte{0}, []byte{0},
+		[]byte{1, 0}, []byte{0})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := requestFrame(3, 12, tt.header, body)
+			req, n, err := DecodeRequest(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decoding % x: %v", data, err)
+			}
+			if n != len(data) {
+				t.Errorf("read %d bytes, want the %d of the frame", n, len(data))
+			}
+			if req.Key != 3 || req.Version != 12 || req.CorrelationID != 7 || req.ClientID != tt.clientID {
+				t.Errorf("decoded header %d v%d, correlation id %d, client id %q, want 3 v12, 7, %q",
+					req.Key, req.Version, req.CorrelationID, req.ClientID, tt.clientID)
+			}
+
+			metadata, ok := req.Body.(*MetadataRequest)
+			if !ok {
+				t.Fatalf("decoded %#v, want a metadata request", req.Body)
+			}
+			if !reflect.DeepEqual(metadata.Topics, []string{"orders"}) || !metadata.AllowAutoTopicCreation || metadata.IncludeTopicAuthorizedOperations {
+				t.Errorf("decoded %+v, want topic orders allowing auto topic creation", metadata)
+			}
+		})
+	}
+}
+
+func TestDecodeNonFlexibleRequestHeader(t *testing.T) {
+	// Metadata v8 has no header tagged fields, its body follows the client id
+	data := requestFrame(3, 8, int32s(7), str("consumer-1"), int32s(1), str("orders"), []byte{0, 1, 0})
+	req, _, err := DecodeRequest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding % x: %v", data, err)
+	}
+	metadata := req.Body.(*MetadataRequest)
+	if req.ClientID != "consumer-1" || !reflect.DeepEqual(metadata.Topics, []string{"orders"}) || !metadata.IncludeClusterAuthorizedOperations {
+		t.Errorf("decoded client id %q and %+v, want consumer-1 and topic orders", req.ClientID, metadata)
+	}
+}
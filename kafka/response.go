@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ResponseHeader is the part of a kafka response we need to match it with its request
+type ResponseHeader struct {
+	// Length is the size of the response, without the size field itself
+	Length int32
+
+	CorrelationID int32
+}
+
+// DecodeResponseHeader reads the next response from r, keeping only its header. The body
+// is discarded without being decoded: responses (e.g. Fetch) can be large and we only
+// need the correlation id. The number of bytes read is returned as well.
+func DecodeResponseHeader(r *bufio.Reader) (*ResponseHeader, int, error) {
+	const headerLength = 8
+
+	header := make([]byte, headerLength)
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, n, err
+	}
+
+	resp := &ResponseHeader{
+		Length:        int32(binary.BigEndian.Uint32(header[:4])),
+		CorrelationID: int32(binary.BigEndian.Uint32(header[4:])),
+	}
+
+	// the correlation id is part of the length
+	if resp.Length < 4 || resp.Length > MaxRequestSize {
+		return nil, n, PacketDecodingError{Info: fmt.Sprintf("invalid response length: %d", resp.Length)}
+	}
+
+	discarded, err := r.Discard(int(resp.Length) - 4)
+	n += discarded
+	if err != nil {
+		return nil, n, err
+	}
+
+	return resp, n, nil
+}
@@ -5,9 +5,15 @@ import (
 	"encoding/base64"
 	"fmt"
 	
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
+// StrictSasl only accepts usernames parsed from PLAIN and SCRAM messages. The speculative
+// extraction of usernames from JWTs or printable sequences of unknown mechanisms is disabled,
+// as it can mislabel users. It must be set before decoding starts.
+var StrictSasl = false
+
 // SaslAuthenticateRequest is the request sent by clients to authenticate with a
 // SASL-based mechanism. The sniffer can capture and decode this to extract
 // authentication details such as usernames.
@@ -26,6 +32,10 @@ type SaslAuthenticateRequest struct {
 	Username string
 	Password string
 	Mechanism string // The SASL mechanism being used (if we can determine it)
+
+	// Gssapi is set for the initial context token of a GSSAPI exchange. It has no username,
+	// the client principal is encrypted.
+	Gssapi *GssapiInitialToken
 }
 
 // Decode deserializes the SaslAuthenticateRequest from binary data
@@ -44,6 +54,7 @@ func (r *SaslAuthenticateRequest) Decode(pd PacketDecoder, version int16) error
 	// For PLAIN mechanism, the format is: [null-byte][username][null-byte][password]
 	// Try to extract username and password if it looks like PLAIN format
 	r.tryDecodePlainAuth(authBytes)
+	r.Username = BoundString("username", r.Username)
 	
 	return nil
 }
@@ -97,32 +108,36 @@ func (r *SaslAuthenticateRequest) tryDecodePlainAuth(authBytes []byte) {
 	
 	// =========================================================================================
 	// Approach 2: SCRAM-SHA-256/SCRAM-SHA-512 format
-	// Client-first-message: gs2-header [n=username,r=client-nonce]
+	// Client-first-message: gs2-header [n=username,r=client-nonce]. The exact mechanism is
+	// only known from the SaslHandshake of the connection.
 	// =========================================================================================
-	for i := 0; i < len(authBytes)-2; i++ {
-		// Look for the "n=" prefix that indicates username in SCRAM
-		if i+2 <= len(authBytes) && authBytes[i] == 'n' && authBytes[i+1] == '=' {
-			// Found the username indicator, find the end (next comma)
-			userStart := i + 2
-			userEnd := -1
-			
-			for j := userStart; j < len(authBytes); j++ {
-				if authBytes[j] == ',' {
-					userEnd = j
-					break
-				}
-			}
-			
-			if userEnd > userStart {
-				r.Mechanism = "SCRAM"
-				r.Username = string(authBytes[userStart:userEnd])
-				return
-			}
-		}
+	if first, ok := ParseScramClientFirst(authBytes); ok {
+		r.Mechanism = "SCRAM"
+		r.Username = first.Username
+		return
 	}
-	
+	if isScramClientFinal(authBytes) {
+		// the final message carries the proof but no username, don't mistake it for one below
+		r.Mechanism = "SCRAM"
+		return
+	}
+
 	// =========================================================================================
-	// Approach 3: JWT/OAUTHBEARER - look for "sub" claim in JWT payload
+	// Approach 3: GSSAPI (Kerberos) initial context token, possibly wrapped in SPNEGO. The
+	// client principal is encrypted, only the service principal of the ticket is readable.
+	// =========================================================================================
+	if token, ok := ParseGssapiInitialToken(authBytes); ok {
+		r.Mechanism = "GSSAPI"
+		r.Gssapi = &token
+		return
+	}
+
+	if StrictSasl {
+		return
+	}
+
+	// =========================================================================================
+	// Approach 4: JWT/OAUTHBEARER - look for "sub" claim in JWT payload
 	// =========================================================================================
 	// Check for JWT format: parts separated by periods
 	jwtParts := bytes.Split(authBytes, []byte{'.'})
@@ -157,7 +172,7 @@ func (r *SaslAuthenticateRequest) tryDecodePlainAuth(authBytes []byte) {
 	}
 	
 	// =========================================================================================
-	// Approach 4: Generic approach - look for printable ASCII sequences that could be usernames
+	// Approach 5: Generic approach - look for printable ASCII sequences that could be usernames
 	// =========================================================================================
 	start := -1
 	end := -1
@@ -205,7 +220,7 @@ func (r *SaslAuthenticateRequest) tryDecodePlainAuth(authBytes []byte) {
 			previewLen = len(authBytes)
 		}
 		hexPreview := fmt.Sprintf("%X", authBytes[:previewLen])
-		fmt.Printf("[DEBUG] SASL auth bytes (no username extracted): %s\n", hexPreview)
+		logging.Printf("[DEBUG] SASL auth bytes (no username extracted): %s", hexPreview)
 	}
 }
 
@@ -225,7 +240,7 @@ func (r *SaslAuthenticateRequest) requiredVersion() Version {
 }
 
 // CollectClientMetrics implements the ClientMetricsCollector interface
-func (r *SaslAuthenticateRequest) CollectClientMetrics(clientAddr string) {
+func (r *SaslAuthenticateRequest) CollectClientMetrics(storage *metrics.Storage, clientAddr string) {
 	versionStr := fmt.Sprintf("%d", r.ApiVersion)
 	metrics.RequestsCount.WithLabelValues(clientAddr, "SaslAuthenticate", versionStr).Inc()
 	
@@ -248,7 +263,7 @@ func (r *SaslAuthenticateRequest) CollectClientMetrics(clientAddr string) {
 			clientAddr, r.Username, mechanism)
 		
 		// Track in metrics
-		metrics.TrackSaslAuthentication(clientAddr, mechanism, r.Username)
+		storage.TrackSaslAuthentication(clientAddr, mechanism, r.Username)
 	}
 }
 
@@ -258,5 +273,8 @@ func (r *SaslAuthenticateRequest) String() string {
 		return fmt.Sprintf("SaslAuthenticate(Username=%s, Mechanism=%s)", 
 			r.Username, r.Mechanism)
 	}
+	if r.Gssapi != nil {
+		return fmt.Sprintf("SaslAuthenticate(Mechanism=%s, Service=%s)", r.Mechanism, r.Gssapi)
+	}
 	return "SaslAuthenticate()"
 }
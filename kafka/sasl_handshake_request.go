@@ -35,7 +35,7 @@ func (r *SaslHandshakeRequest) Decode(pd PacketDecoder, version int16) error {
 		return err
 	}
 	
-	r.Mechanism = mechanism
+	r.Mechanism = BoundString("mechanism", mechanism)
 	return nil
 }
 
@@ -55,7 +55,7 @@ func (r *SaslHandshakeRequest) requiredVersion() Version {
 }
 
 // CollectClientMetrics collects Kafka-related metrics about the connection
-func (r *SaslHandshakeRequest) CollectClientMetrics(clientAddr string) {
+func (r *SaslHandshakeRequest) CollectClientMetrics(storage *metrics.Storage, clientAddr string) {
 	// Store client address for later correlation
 	r.ClientAddr = clientAddr
 	
@@ -71,7 +71,7 @@ func (r *SaslHandshakeRequest) CollectClientMetrics(clientAddr string) {
 	if r.Mechanism != "" {
 		// Note: Username will be captured later from the SaslAuthenticate request or raw SASL token
 		// For now, we just track the mechanism with an empty username
-		metrics.AuthenticationInfo.WithLabelValues(clientAddr, r.Mechanism, "").Inc()
+		metrics.IncAuthentication(clientAddr, r.Mechanism, "")
 		
 		// Store this handshake in a global map for correlation with future packets
 		StoreAuthHandshake(clientAddr, r.Mechanism)
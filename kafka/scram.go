@@ -0,0 +1,103 @@
+package kafka
+
+import "strings"
+
+// ScramClientFirst is the client-first-message of a SCRAM exchange (RFC 5802), e.g.
+// "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL"
+type ScramClientFirst struct {
+	// ChannelBinding is the gs2 channel binding flag: "n", "y" or "p=<type>"
+	ChannelBinding string
+	AuthzID        string
+	Username       string
+	Nonce          string
+	// Extensions are the attributes following the nonce, e.g. "tokenauth=true" for
+	// Kafka delegation tokens
+	Extensions []string
+}
+
+// ParseScramClientFirst parses a SCRAM client-first-message. The gs2 header is stripped and
+// the username is unescaped ("=2C" is a comma, "=3D" an equal sign). It returns false for
+// anything else, including the client-final-message of the exchange.
+func ParseScramClientFirst(msg []byte) (ScramClientFirst, bool) {
+	var first ScramClientFirst
+
+	// gs2-header: cbind-flag "," [authzid] ","
+	attrs := strings.Split(string(msg), ",")
+	if len(attrs) < 4 {
+		return first, false
+	}
+
+	switch flag := attrs[0]; {
+	case flag == "n" || flag == "y":
+	case strings.HasPrefix(flag, "p=") && len(flag) > 2:
+	default:
+		return first, false
+	}
+	first.ChannelBinding = attrs[0]
+
+	if attrs[1] != "" {
+		if !strings.HasPrefix(attrs[1], "a=") {
+			return first, false
+		}
+		authzID, ok := unescapeScramName(attrs[1][2:])
+		if !ok {
+			return first, false
+		}
+		first.AuthzID = authzID
+	}
+
+	// client-first-message-bare: [reserved-mext ","] "n=" username "," "r=" nonce ["," extensions]
+	bare := attrs[2:]
+	if strings.HasPrefix(bare[0], "m=") {
+		bare = bare[1:]
+	}
+	if len(bare) < 2 || !strings.HasPrefix(bare[0], "n=") || !strings.HasPrefix(bare[1], "r=") {
+		return first, false
+	}
+
+	username, ok := unescapeScramName(bare[0][2:])
+	if !ok || username == "" {
+		return first, false
+	}
+	first.Username = username
+	first.Nonce = bare[1][2:]
+	first.Extensions = bare[2:]
+
+	return first, true
+}
+
+// isScramClientFinal tells whether msg looks like a SCRAM client-final-message, e.g.
+// "c=biws,r=<nonce>,p=<proof>"
+func isScramClientFinal(msg []byte) bool {
+	s := string(msg)
+	return strings.HasPrefix(s, "c=") && strings.Contains(s, ",r=") && strings.Contains(s, ",p=")
+}
+
+// unescapeScramName decodes a saslname, in which "=2C" and "=3D" stand for "," and "="
+// and any other "=" is invalid
+func unescapeScramName(name string) (string, bool) {
+	if !strings.Contains(name, "=") {
+		return name, true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '=' {
+			b.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", false
+		}
+		switch name[i+1 : i+3] {
+		case "2C":
+			b.WriteByte(',')
+		case "3D":
+			b.WriteByte('=')
+		default:
+			return "", false
+		}
+		i += 2
+	}
+	return b.String(), true
+}
@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScramClientFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want ScramClientFirst
+	}{
+		{
+			// RFC 7677, SCRAM-SHA-256
+			name: "sha-256",
+			msg:  "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			want: ScramClientFirst{ChannelBinding: "n", Username: "user", Nonce: "rOprNGfwEbeRWgbNEkqO", Extensions: []string{}},
+		},
+		{
+			// Java client, SCRAM-SHA-512
+			name: "sha-512",
+			msg:  "n,,n=alice,r=1xgc3xmeb6ccthlbyduvm84vmb",
+			want: ScramClientFirst{ChannelBinding: "n", Username: "alice", Nonce: "1xgc3xmeb6ccthlbyduvm84vmb", Extensions: []string{}},
+		},
+		{
+			name: "delegation token",
+			msg:  "n,,n=ZNgGmnyiTnawsBcpQXmxpQ,r=1dvi3ghvivpuyd0w9tay0h3d5x,tokenauth=true",
+			want: ScramClientFirst{ChannelBinding: "n", Username: "ZNgGmnyiTnawsBcpQXmxpQ", Nonce: "1dvi3ghvivpuyd0w9tay0h3d5x", Extensions: []string{"tokenauth=true"}},
+		},
+		{
+			name: "escaped username and authzid",
+			msg:  "y,a=admin=3Dx,n=team=2Corders,r=abc",
+			want: ScramClientFirst{ChannelBinding: "y", AuthzID: "admin=x", Username: "team,orders", Nonce: "abc", Extensions: []string{}},
+		},
+		{
+			name: "channel binding and reserved extension",
+			msg:  "p=tls-unique,,m=ext,n=bob,r=xyz",
+			want: ScramClientFirst{ChannelBinding: "p=tls-unique", Username: "bob", Nonce: "xyz", Extensions: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseScramClientFirst([]byte(tt.msg))
+			if !ok {
+				t.Fatalf("%q isn't parsed", tt.msg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsed %q as %+v, want %+v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScramClientFirstRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"client final", "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="},
+		{"plain", "\x00alice\x00secret"},
+		{"no gs2 header", "n=user,r=abc"},
+		{"invalid binding flag", "x,,n=user,r=abc"},
+		{"invalid authzid", "n,admin,n=user,r=abc"},
+		{"no nonce", "n,,n=user,s=abc"},
+		{"empty username", "n,,n=,r=abc"},
+		{"invalid escape", "n,,n=us=er,r=abc"},
+		{"truncated escape", "n,,n=user=2,r=abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if first, ok := ParseScramClientFirst([]byte(tt.msg)); ok {
+				t.Errorf("%q parsed as %+v", tt.msg, first)
+			}
+		})
+	}
+}
+
+func TestSaslAuthenticateScram(t *testing.T) {
+	tests := []struct {
+		msg      string
+		username string
+	}{
+		{"n,,n=user,r=rOprNGfwEbeRWgbNEkqO", "user"},
+		{"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", ""},
+	}
+	for _, tt := range tests {
+		raw := append([]byte{0, 0, 0, byte(len(tt.msg))}, tt.msg...)
+		var req SaslAuthenticateRequest
+		if err := req.Decode(NewPacketDecoder(raw), 1); err != nil {
+			t.Fatalf("decoding %q: %v", tt.msg, err)
+		}
+		if req.Mechanism != "SCRAM" || req.Username != tt.username {
+			t.Errorf("%q decoded as mechanism %q, username %q, want SCRAM, %q", tt.msg, req.Mechanism, req.Username, tt.username)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package kafka
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Schemes of the summary log output URI
+const (
+	summaryOutputFile      = "file"
+	summaryOutputStdout    = "stdout"
+	summaryOutputSyslog    = "syslog"
+	summaryOutputSyslogUDP = "syslog+udp"
+	summaryOutputSyslogTCP = "syslog+tcp"
+)
+
+// Formats of the summary log lines
+const (
+	SummaryFormatText = "text"
+	SummaryFormatJSON = "json"
+)
+
+// summaryOutput is the destination of the summary log, each Write gets a whole line
+type summaryOutput interface {
+	io.WriteCloser
+}
+
+// parseSummaryOutput checks an output URI and returns its scheme and address: the file path,
+// or the syslog host:port (empty for the local syslog daemon)
+func parseSummaryOutput(output string) (scheme, addr string, err error) {
+	if output == summaryOutputStdout {
+		return summaryOutputStdout, "", nil
+	}
+
+	u, err := url.Parse(output)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid summary output %q: %v", output, err)
+	}
+	switch u.Scheme {
+	case summaryOutputStdout:
+		return summaryOutputStdout, "", nil
+	case summaryOutputFile:
+		if u.Path == "" {
+			return "", "", fmt.Errorf("summary output %q has no file path", output)
+		}
+		return summaryOutputFile, u.Path, nil
+	case summaryOutputSyslog, summaryOutputSyslogUDP, summaryOutputSyslogTCP:
+		return u.Scheme, u.Host, nil
+	default:
+		return "", "", fmt.Errorf("summary output %q must be file:///path, stdout, syslog://host:port, syslog+tcp://host:port or syslog:// for the local daemon", output)
+	}
+}
+
+// openSummaryOutput opens the output of the configuration. stamped tells whether text lines
+// start with their time, syslog messages get a timestamp from the syslog header instead.
+func openSummaryOutput(config SummaryLogConfig) (output summaryOutput, stamped bool, err error) {
+	if config.Output == "" {
+		file, err := openSummaryFile(config.Path, config.MaxSize, config.MaxFiles)
+		return file, true, err
+	}
+
+	scheme, addr, err := parseSummaryOutput(config.Output)
+	if err != nil {
+		return nil, false, err
+	}
+	switch scheme {
+	case summaryOutputStdout:
+		return stdoutOutput{}, true, nil
+	case summaryOutputFile:
+		file, err := openSummaryFile(addr, config.MaxSize, config.MaxFiles)
+		return file, true, err
+	default:
+		// plain syslog:// is UDP, as the usual port 514
+		network := "udp"
+		if scheme == summaryOutputSyslogTCP {
+			network = "tcp"
+		}
+		if addr == "" {
+			network = ""
+		}
+		output, err := newSyslogOutput(network, addr)
+		return output, false, err
+	}
+}
+
+// stdoutOutput writes the summary log to the standard output, which is never closed
+type stdoutOutput struct{}
+
+func (stdoutOutput) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdoutOutput) Close() error {
+	return nil
+}
+
+// summaryFile is the summary log file, rotated once it reaches its max size
+type summaryFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File // nil after a failed rotation
+	size     int64
+}
+
+// openSummaryFile opens the summary file for appending
+func openSummaryFile(path string, maxSize int64, maxFiles int) (*summaryFile, error) {
+	f := &summaryFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file for appending
+func (f *summaryFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate renames the file to path.1, shifting older files and removing the oldest, and opens
+// a new one
+func (f *summaryFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+// Write appends a line to the file. The file is rotated before a line that would exceed its
+// max size, a line is never split across files.
+func (f *summaryFile) Write(line []byte) (int, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("could not rotate summary log file: %v", err)
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (f *summaryFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// trimLine returns a line without its newline, syslog messages are separated by the transport
+func trimLine(line []byte) string {
+	return strings.TrimSuffix(string(line), "\n")
+}
@@ -0,0 +1,79 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package kafka
+
+import (
+	"errors"
+	"log"
+	"log/syslog"
+	"time"
+)
+
+// syslogTag is the tag, or app name, of the summary messages sent to syslog
+const syslogTag = "kafka-sniffer"
+
+// syslogRetryInterval is the minimum time between connection attempts to an unreachable
+// syslog server, the lines written meanwhile are dropped
+const syslogRetryInterval = 5 * time.Second
+
+// errSyslogDisconnected is returned for lines written while the syslog server is unreachable
+var errSyslogDisconnected = errors.New("not connected to syslog")
+
+// syslogOutput sends each summary line as a syslog message. log/syslog reconnects once when
+// a write fails, the connection is also made again when the server was unreachable.
+type syslogOutput struct {
+	network, addr string
+	writer        *syslog.Writer // nil until connected
+	lastAttempt   time.Time
+}
+
+// newSyslogOutput connects to the syslog server at addr, or to the local daemon when network
+// is empty. The server may be down when starting, the connection is attempted again on write.
+func newSyslogOutput(network, addr string) (summaryOutput, error) {
+	s := &syslogOutput{network: network, addr: addr}
+	if err := s.connect(); err != nil {
+		log.Printf("Failed to connect to syslog, retrying on the next summary line: %v", err)
+	}
+	return s, nil
+}
+
+func (s *syslogOutput) connect() error {
+	s.lastAttempt = time.Now()
+	writer, err := syslog.Dial(s.network, s.addr, syslog.LOG_INFO|syslog.LOG_DAEMON, syslogTag)
+	if err != nil {
+		return err
+	}
+	s.writer = writer
+	return nil
+}
+
+// Write sends a line as a message, connecting first if needed
+func (s *syslogOutput) Write(line []byte) (int, error) {
+	if s.writer == nil {
+		if time.Since(s.lastAttempt) < syslogRetryInterval {
+			return 0, errSyslogDisconnected
+		}
+		if err := s.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.writer.Info(trimLine(line)); err != nil {
+		// log/syslog already failed to reconnect, try again after the retry interval
+		_ = s.writer.Close()
+		s.writer = nil
+		return 0, err
+	}
+	return len(line), nil
+}
+
+// Close closes the connection to the server
+func (s *syslogOutput) Close() error {
+	if s.writer == nil {
+		return nil
+	}
+	err := s.writer.Close()
+	s.writer = nil
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package kafka
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newSyslogOutput fails, log/syslog isn't available on this platform
+func newSyslogOutput(network, addr string) (summaryOutput, error) {
+	return nil, fmt.Errorf("syslog summary output isn't supported on %s", runtime.GOOS)
+}
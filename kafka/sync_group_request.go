@@ -0,0 +1,201 @@
+package kafka
+
+import "github.com/d-ulyanov/kafka-sniffer/metrics"
+
+// SyncGroupRequest is sent by group members after joining a group. The leader's request
+// carries the assignment of every member.
+type SyncGroupRequest struct {
+	Version         int16
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string // v3+, static membership
+	ProtocolType    string // v5+
+	ProtocolName    string // v5+
+	Assignments     []SyncGroupAssignment
+}
+
+// SyncGroupAssignment is the assignment of a group member
+type SyncGroupAssignment struct {
+	MemberID string
+	// Topics are the assigned topics and partitions, only decoded for consumer groups
+	Topics []AssignedTopic
+}
+
+// AssignedTopic is a topic of a consumer protocol assignment, with the partitions assigned
+// to the member
+type AssignedTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+// key returns the Kafka API key for SyncGroup
+func (r *SyncGroupRequest) key() int16 {
+	return 14
+}
+
+// version returns the Kafka request version
+func (r *SyncGroupRequest) version() int16 {
+	return r.Version
+}
+
+// requiredVersion states what the minimum required version is
+func (r *SyncGroupRequest) requiredVersion() Version {
+	switch r.Version {
+	case 0:
+		return V0_9_0_0
+	case 1:
+		return V0_11_0_0
+	case 2:
+		return V2_0_0_0
+	case 3:
+		return V2_3_0_0
+	case 4:
+		return V2_4_0_0
+	default:
+		return V2_5_0_0
+	}
+}
+
+// Decode deserializes a SyncGroup request from the given PacketDecoder
+func (r *SyncGroupRequest) Decode(pd PacketDecoder, version int16) (err error) {
+	r.Version = version
+	flexible := isFlexible(r.key(), version)
+
+	if r.GroupID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("group id", err)
+	}
+	r.GroupID = BoundString("group_id", r.GroupID)
+
+	if r.GenerationID, err = pd.getInt32(); err != nil {
+		return fieldError("generation id", err)
+	}
+
+	if r.MemberID, err = decodeString(pd, flexible); err != nil {
+		return fieldError("member id", err)
+	}
+	r.MemberID = BoundString("member_id", r.MemberID)
+
+	if version >= 3 {
+		if r.GroupInstanceID, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("group instance id", err)
+		}
+		r.GroupInstanceID = BoundString("group_instance_id", r.GroupInstanceID)
+	}
+
+	if version >= 5 {
+		if r.ProtocolType, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("protocol type", err)
+		}
+		r.ProtocolType = BoundString("protocol_type", r.ProtocolType)
+
+		if r.ProtocolName, err = decodeNullableString(pd, flexible); err != nil {
+			return fieldError("protocol name", err)
+		}
+		r.ProtocolName = BoundString("protocol_name", r.ProtocolName)
+	}
+
+	assignmentCount, err := decodeArrayLength(pd, flexible)
+	if err != nil {
+		return fieldError("assignment array", err)
+	}
+
+	if assignmentCount > 0 {
+		r.Assignments = make([]SyncGroupAssignment, assignmentCount)
+	}
+	for i := range r.Assignments {
+		a := &r.Assignments[i]
+
+		if a.MemberID, err = decodeString(pd, flexible); err != nil {
+			return fieldError("assignment member id", err)
+		}
+		a.MemberID = BoundString("member_id", a.MemberID)
+
+		assignment, err := decodeBytes(pd, flexible)
+		if err != nil {
+			return fieldError("assignment", err)
+		}
+		if r.ProtocolType == "" || r.ProtocolType == "consumer" {
+			a.Topics = decodeConsumerAssignment(assignment)
+		}
+
+		if flexible {
+			if err = pd.getTaggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flexible {
+		return pd.getTaggedFields()
+	}
+
+	return nil
+}
+
+// maxConsumerAssignmentVersion is the latest version of the consumer protocol assignment,
+// later ones are taken for another protocol
+const maxConsumerAssignmentVersion = 3
+
+// decodeConsumerAssignment returns the topics and partitions of a consumer protocol assignment.
+// The assignment is opaque to the broker: before v5 the protocol type isn't sent, and the
+// assignments of other protocols (e.g. Kafka Connect) seldom decode as a consumer one. Those
+// failing to decode return no topics.
+func decodeConsumerAssignment(assignment []byte) []AssignedTopic {
+	if len(assignment) == 0 {
+		return nil
+	}
+
+	pd := &RealDecoder{raw: assignment}
+
+	// the assignment schema version, its later versions only add fields after the partitions
+	version, err := pd.getInt16()
+	if err != nil || version < 0 || version > maxConsumerAssignmentVersion {
+		return nil
+	}
+
+	topicCount, err := pd.getArrayLength()
+	if err != nil || topicCount <= 0 {
+		return nil
+	}
+
+	topics := make([]AssignedTopic, 0, topicCount)
+	for i := 0; i < topicCount; i++ {
+		topic, err := pd.getString()
+		if err != nil || topic == "" {
+			return nil
+		}
+		partitions, err := pd.getInt32Array()
+		if err != nil {
+			return nil
+		}
+		topics = append(topics, AssignedTopic{Topic: BoundString("topic", topic), Partitions: partitions})
+	}
+
+	// the user data of the assignor closes the assignment, a missing one means it's not a
+	// consumer assignment
+	if _, err = pd.getBytes(); err != nil {
+		return nil
+	}
+	return topics
+}
+
+// ExtractTopics returns the topics assigned by the group leader
+func (r *SyncGroupRequest) ExtractTopics() []string {
+	seen := make(map[string]bool)
+	var topics []string
+	for _, a := range r.Assignments {
+		for _, t := range a.Topics {
+			if !seen[t.Topic] {
+				seen[t.Topic] = true
+				topics = append(topics, t.Topic)
+			}
+		}
+	}
+	return topics
+}
+
+// CollectClientMetrics implements the ClientMetricsCollector interface
+func (r *SyncGroupRequest) CollectClientMetrics(storage *metrics.Storage, clientIP string) {
+	storage.AddConsumerGroupMemberInfo(clientIP, r.GroupID, r.MemberID)
+}
@@ -2,6 +2,9 @@ package kafka
 
 import (
 	"fmt"
+	"unicode/utf8"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
 // Encoder is a simple interface for any type that can be encoded as an array of bytes
@@ -78,13 +81,20 @@ var (
 	V0_9_0_0  = newKafkaVersion(0, 9, 0, 0)
 	V0_10_0_0 = newKafkaVersion(0, 10, 0, 0)
 	V0_10_1_0 = newKafkaVersion(0, 10, 1, 0)
+	V0_10_2_0 = newKafkaVersion(0, 10, 2, 0)
 	V0_11_0_0 = newKafkaVersion(0, 11, 0, 0)
 	V1_0_0_0  = newKafkaVersion(1, 0, 0, 0)
 	V1_1_0_0  = newKafkaVersion(1, 1, 0, 0)
 	V2_0_0_0  = newKafkaVersion(2, 0, 0, 0)
 	V2_1_0_0  = newKafkaVersion(2, 1, 0, 0)
+	V2_2_0_0  = newKafkaVersion(2, 2, 0, 0)
 	V2_3_0_0  = newKafkaVersion(2, 3, 0, 0)
 	V2_4_0_0  = newKafkaVersion(2, 4, 0, 0)
+	V2_5_0_0  = newKafkaVersion(2, 5, 0, 0)
+	V2_6_0_0  = newKafkaVersion(2, 6, 0, 0)
+	V2_7_0_0  = newKafkaVersion(2, 7, 0, 0)
+	V3_0_0_0  = newKafkaVersion(3, 0, 0, 0)
+	V3_8_0_0  = newKafkaVersion(3, 8, 0, 0)
 
 	MinVersion = V0_8_2_0
 	MaxVersion = V2_4_0_0
@@ -97,3 +107,23 @@ func (v Version) String() string {
 
 	return fmt.Sprintf("%d.%d.%d", v.version[0], v.version[1], v.version[2])
 }
+
+// MaxFieldLength is the maximum length (in bytes) of client-controlled strings, like
+// client ids, transactional ids or usernames, that are allowed into metrics and logs
+var MaxFieldLength = 256
+
+// BoundString truncates a client-controlled string to MaxFieldLength bytes without
+// splitting a multi-byte character, and counts the truncation per field
+func BoundString(field, s string) string {
+	if len(s) <= MaxFieldLength {
+		return s
+	}
+
+	cut := MaxFieldLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	metrics.TruncatedFieldsTotal.WithLabelValues(field).Inc()
+	return s[:cut]
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Fields are the structured fields of an event. Keep to the stable field names
+// (client_ip, src_port, topic, username, api, version...) so JSON logs stay queryable.
+type Fields map[string]interface{}
+
+var (
+	jsonFormat bool
+
+	// output is where JSON events are written, the standard logger's output before it got wrapped
+	output io.Writer
+	mu     sync.Mutex
+)
+
+// SetFormat selects the log format. In JSON format every line of the standard logger becomes
+// a "message" event, so that the output stays parseable even for free-form lines. It must be
+// called before anything is logged.
+func SetFormat(format string) error {
+	switch format {
+	case FormatText:
+		jsonFormat = false
+	case FormatJSON:
+		jsonFormat = true
+		output = log.Writer()
+		log.SetFlags(0)
+		log.SetOutput(messageWriter{})
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+// JSON reports whether events are logged as JSON objects
+func JSON() bool {
+	return jsonFormat
+}
+
+// Event logs a routine event, suppressed in quiet mode and subject to sampling. The text line
+// is built from format and v, the JSON object from event and fields.
+func Event(event string, fields Fields, format string, v ...interface{}) {
+	if quiet || !sample() {
+		return
+	}
+	Audit(event, fields, format, v...)
+}
+
+// Audit logs an audit or security event, it is never suppressed
+func Audit(event string, fields Fields, format string, v ...interface{}) {
+	if !jsonFormat {
+		log.Printf(format, v...)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	_, _ = output.Write(Marshal(time.Now(), event, fields))
+}
+
+// Marshal returns an event as a single JSON line
+func Marshal(at time.Time, event string, fields Fields) []byte {
+	obj := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		obj[k] = v
+	}
+	obj["time"] = at.Format(time.RFC3339Nano)
+	obj["event"] = event
+
+	line, err := json.Marshal(obj)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"event": event, "error": err.Error()})
+	}
+	return append(line, '\n')
+}
+
+// messageWriter wraps the lines of the standard logger into "message" events
+type messageWriter struct{}
+
+func (messageWriter) Write(p []byte) (int, error) {
+	line := Marshal(time.Now(), "message", Fields{"message": strings.TrimRight(string(p), "\n")})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := output.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
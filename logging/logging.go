@@ -0,0 +1,36 @@
+// Package logging separates routine data-plane logs (produce, fetch, connection chatter)
+// from audit and security logs. Routine logs go through this package and can be turned off,
+// audit and security logs keep using the standard logger directly, or Audit for structured events.
+package logging
+
+import "log"
+
+var quiet bool
+
+// SetQuiet turns routine logs off. It must be called before packets are decoded.
+func SetQuiet(q bool) {
+	quiet = q
+}
+
+// Quiet reports whether routine logs are turned off
+func Quiet() bool {
+	return quiet
+}
+
+// Printf logs a routine line through the standard logger unless quiet mode is on, or the
+// line is sampled out
+func Printf(format string, v ...interface{}) {
+	if quiet || !sample() {
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// Println logs a routine line through the standard logger unless quiet mode is on, or the
+// line is sampled out
+func Println(v ...interface{}) {
+	if quiet || !sample() {
+		return
+	}
+	log.Println(v...)
+}
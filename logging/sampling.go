@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// sampleRate keeps 1 in sampleRate routine lines, 0 and 1 keep all of them
+	sampleRate uint64
+	// rateLimit is the maximum number of routine lines per second, 0 is unlimited
+	rateLimit int64
+
+	// sampled counts the routine lines seen by the sampling
+	sampled uint64
+	// window is the unix second of the current rate limit window, windowLines the routine
+	// lines seen in it, including the suppressed ones
+	window      int64
+	windowLines int64
+)
+
+// SetSampling keeps 1 in every rate routine lines, and at most perSecond of them per second.
+// Zero disables either limit. Audit lines are never sampled, nor are metrics affected. It must
+// be called before packets are decoded.
+func SetSampling(rate, perSecond int) {
+	if rate < 0 {
+		rate = 0
+	}
+	if perSecond < 0 {
+		perSecond = 0
+	}
+	sampleRate = uint64(rate)
+	rateLimit = int64(perSecond)
+}
+
+// sample tells whether a routine line is logged. It is shared by all stream goroutines and
+// only uses atomic counters: the lines of a second are counted, those beyond the limit are
+// suppressed and reported once the next second starts.
+func sample() bool {
+	if sampleRate > 1 && atomic.AddUint64(&sampled, 1)%sampleRate != 0 {
+		return false
+	}
+	if rateLimit == 0 {
+		return true
+	}
+
+	now := time.Now().Unix()
+	if start := atomic.LoadInt64(&window); now != start && atomic.CompareAndSwapInt64(&window, start, now) {
+		if lines := atomic.SwapInt64(&windowLines, 0); lines > rateLimit {
+			log.Printf("suppressed %d routine log lines over the limit of %d per second", lines-rateLimit, rateLimit)
+		}
+	}
+	return atomic.AddInt64(&windowLines, 1) <= rateLimit
+}
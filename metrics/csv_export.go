@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// csvHeader are the columns of the relationship CSV files
+var csvHeader = []string{"timestamp", "client_ip", "username", "mechanism", "direction", "topic"}
+
+// StartCSVExport writes a CSV file of the client relationships to dir every interval, named
+// after the time of the snapshot, e.g. relationships-20240516T162549Z.csv. A last file is
+// written once ctx is done, then the returned channel is closed.
+func (s *Storage) StartCSVExport(ctx context.Context, dir string, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				s.exportCSV(dir)
+				return
+			case <-ticker.C:
+				s.exportCSV(dir)
+			}
+		}
+	}()
+	return done
+}
+
+// exportCSV writes the current snapshot to dir, logging failures
+func (s *Storage) exportCSV(dir string) {
+	snapshot := s.Snapshot()
+	name := "relationships-" + snapshot.Time.UTC().Format("20060102T150405Z") + ".csv"
+	if err := writeFileAtomic(filepath.Join(dir, name), func(w io.Writer) error {
+		return WriteSnapshotCSV(w, snapshot)
+	}); err != nil {
+		log.Printf("could not export relationships: %v", err)
+	}
+}
+
+// WriteSnapshotCSV writes a row per client, direction and topic of the snapshot
+func WriteSnapshotCSV(w io.Writer, snapshot Snapshot) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	timestamp := snapshot.Time.UTC().Format(time.RFC3339)
+	for _, c := range snapshot.Clients {
+		for _, topic := range c.ProducedTopics {
+			if err := cw.Write([]string{timestamp, c.ClientIP, c.Username, c.Mechanism, "produce", topic}); err != nil {
+				return err
+			}
+		}
+		for _, topic := range c.ConsumedTopics {
+			if err := cw.Write([]string{timestamp, c.ClientIP, c.Username, c.Mechanism, "consume", topic}); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeFileAtomic writes a temporary file next to path and renames it, so that readers of
+// path never see a partial file
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// a no-op once renamed
+	defer os.Remove(tmp.Name())
+
+	// temporary files are private, the export is as readable as the summary log
+	if err = tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = write(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %v", tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
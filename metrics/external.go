@@ -69,6 +69,13 @@ var (
 		Help:      "Relationship between user, client and consumed topics",
 	}, []string{"client_ip", "username", "topic"})
 
+	// UserGroupInfo tracks which users are members of which consumer groups
+	UserGroupInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "user_group_info",
+		Help:      "Relationship between user, client and consumer groups",
+	}, []string{"client_ip", "username", "group"})
+
 	// RequestVersionInfo tracks API versions used by clients
 	RequestVersionInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
@@ -82,6 +89,306 @@ var (
 		Name:      "api_version_by_request_type",
 		Help:      "API versions used by clients for different request types and clients",
 	}, []string{"client_ip", "request_type", "version"})
+
+	// LogDirOpTotal counts log directory operations (DescribeLogDirs / AlterReplicaLogDirs)
+	LogDirOpTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "log_dir_op_total",
+		Help:      "Total log directory operations by client",
+	}, []string{"client_ip", "operation"})
+
+	// MaxApiKeySeen tracks the highest API key observed, which helps to detect protocol drift
+	MaxApiKeySeen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "max_api_key_seen",
+		Help:      "Highest Kafka API key observed in client requests",
+	})
+
+	// TruncatedFieldsTotal counts client-controlled strings cut down to the maximum field length
+	TruncatedFieldsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "truncated_fields_total",
+		Help:      "Total client-controlled strings truncated to the maximum field length",
+	}, []string{"field"})
+
+	// WebhookDeliveryTotal counts webhook deliveries by result (success, retry, failed)
+	WebhookDeliveryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_total",
+		Help:      "Total webhook event deliveries by result",
+	}, []string{"result"})
+
+	// CreatePartitionsInfo tracks the latest partition count requested for a topic via CreatePartitions
+	CreatePartitionsInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "create_partitions_info",
+		Help:      "Partition count requested by the latest CreatePartitions request for a topic",
+	}, []string{"topic", "new_count"})
+
+	// NegotiatedProtocolInfo tracks the ApiVersions request version used by clients to negotiate the protocol
+	NegotiatedProtocolInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "negotiated_protocol_info",
+		Help:      "ApiVersions request version used by clients to negotiate the protocol",
+	}, []string{"client_ip", "version"})
+
+	// OffsetForLeaderEpochTotal counts OffsetForLeaderEpoch requests, sent by consumers after a leader change
+	OffsetForLeaderEpochTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "offset_for_leader_epoch_total",
+		Help:      "Total OffsetForLeaderEpoch requests by client and request version",
+	}, []string{"client_ip", "version"})
+
+	// DeleteRecordsTotal counts the topics of DeleteRecords requests, which destroy data
+	DeleteRecordsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "delete_records_total",
+		Help:      "Total DeleteRecords requests by client and topic",
+	}, []string{"client_ip", "topic"})
+
+	// TxnInitTotal counts InitProducerId requests of transactional producers
+	TxnInitTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "txn_init_total",
+		Help:      "Total InitProducerId requests of transactional producers by client and transactional id",
+	}, []string{"client_ip", "transactional_id"})
+
+	// AutoTopicCreateAttemptTotal counts metadata requests allowing auto topic creation of
+	// topics never produced to or consumed from
+	AutoTopicCreateAttemptTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auto_topic_create_attempt_total",
+		Help:      "Total metadata requests allowing auto topic creation of unknown topics by client and topic",
+	}, []string{"client_ip", "topic"})
+
+	// DescribeConfigsTotal counts the resources whose configs are described, by resource type
+	DescribeConfigsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "describe_configs_total",
+		Help:      "Total resources described by DescribeConfigs requests by client and resource type",
+	}, []string{"client_ip", "resource_type"})
+
+	// AlterConfigsTotal counts the resources whose configs are altered by AlterConfigs and
+	// IncrementalAlterConfigs requests, by resource type
+	AlterConfigsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alter_configs_total",
+		Help:      "Total resources altered by AlterConfigs and IncrementalAlterConfigs requests by client and resource type",
+	}, []string{"client_ip", "resource_type"})
+
+	// AclChangesTotal counts the ACLs created and the deletion filters sent by clients
+	AclChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "acl_changes_total",
+		Help:      "Total ACL creations and deletion filters by client, operation and resource type",
+	}, []string{"client_ip", "operation", "resource_type"})
+
+	// GroupHeartbeatTotal counts Heartbeat requests of group members
+	GroupHeartbeatTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "group_heartbeat_total",
+		Help:      "Total Heartbeat requests by client and group",
+	}, []string{"client_ip", "group"})
+
+	// GroupLeaveTotal counts LeaveGroup requests, members leaving trigger a rebalance
+	GroupLeaveTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "group_leave_total",
+		Help:      "Total LeaveGroup requests by client and group",
+	}, []string{"client_ip", "group"})
+
+	// ScramCredentialOpTotal counts SCRAM credential operations (describe, upsert, delete)
+	ScramCredentialOpTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scram_credential_op_total",
+		Help:      "Total SCRAM credential operations by operation",
+	}, []string{"op"})
+
+	// UnauthenticatedDataTotal counts produce/fetch requests on SASL listeners without an observed SaslAuthenticate
+	UnauthenticatedDataTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unauthenticated_data_total",
+		Help:      "Total data requests on SASL listeners from connections without observed authentication",
+	}, []string{"client_ip"})
+
+	// FilteredTopicsTotal counts topic occurrences skipped by the topic include/exclude filter
+	FilteredTopicsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "filtered_topics_total",
+		Help:      "Total topic occurrences in requests skipped by the topic filter",
+	})
+
+	// ProduceHeaderSeenTotal counts record header keys of produced records
+	ProduceHeaderSeenTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "produce_header_seen_total",
+		Help:      "Total produced records carrying a header key, counted when header capture is enabled",
+	}, []string{"client_ip", "header_key"})
+
+	// AuthFailureSuspectedTotal counts connections closed soon after their SaslHandshake without
+	// any request following the SASL exchange. It's a heuristic, broker responses aren't decoded.
+	AuthFailureSuspectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failure_suspected_total",
+		Help:      "Total connections closed soon after a SASL handshake without further requests, likely failed authentications",
+	}, []string{"client_ip", "mechanism"})
+
+	// ProduceNullKeyTotal counts produced records without a key, spread over the partitions
+	// instead of being routed by key
+	ProduceNullKeyTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "produce_null_key_total",
+		Help:      "Total produced records without a key, by topic",
+	}, []string{"topic"})
+
+	// TLSConnectionsTotal counts connections encrypted with TLS, which can't be decoded
+	TLSConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tls_connections_total",
+		Help:      "Total connections starting with a TLS handshake, their requests can't be decoded",
+	}, []string{"client_ip"})
+
+	// ProduceBytesTotal counts the record bytes produced by clients to each topic
+	ProduceBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "produce_bytes_total",
+		Help:      "Total record bytes produced by client and topic",
+	}, []string{"client_ip", "topic"})
+
+	// FindCoordinatorTotal counts coordinator lookups by coordinator type
+	FindCoordinatorTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "find_coordinator_total",
+		Help:      "Total FindCoordinator lookups by client and coordinator type (group, transaction, share)",
+	}, []string{"client_ip", "coordinator_type"})
+
+	// TopicCreateTotal counts the topics clients create, or validate the creation of
+	TopicCreateTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "topic_create_total",
+		Help:      "Total topics created by client, validate_only is true when the creation was only validated",
+	}, []string{"client_ip", "topic", "validate_only"})
+
+	// IdempotentProduceTotal counts produce requests of idempotent producers, transactional
+	// ones included
+	IdempotentProduceTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "idempotent_produce_total",
+		Help:      "Total produce requests whose record batches carry a producer id, by client",
+	}, []string{"client_ip"})
+
+	// NonIdempotentProduceTotal counts produce requests of producers without idempotence
+	NonIdempotentProduceTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "non_idempotent_produce_total",
+		Help:      "Total produce requests without producer id (-1, or legacy message sets), by client",
+	}, []string{"client_ip"})
+
+	// ConnectionBytesTotal counts the bytes sent by clients to the brokers
+	ConnectionBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connection_bytes_total",
+		Help:      "Total bytes read from the connections of a client to the brokers",
+	}, []string{"client_ip"})
+
+	// InvalidLengthTotal counts messages whose size is negative, too small or over the maximum
+	// request size, sent by malformed clients or probes
+	InvalidLengthTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "invalid_length_total",
+		Help:      "Total messages rejected for an invalid size by client",
+	}, []string{"client_ip"})
+
+	// FetchTotal counts fetch requests by fetcher type, telling the replication of followers
+	// from consumers
+	FetchTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_total",
+		Help:      "Total fetch requests by client and fetcher type (consumer, follower)",
+	}, []string{"client_ip", "fetcher_type"})
+
+	// ListGroupsTotal counts ListGroups requests, sent by admin and monitoring tools
+	ListGroupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "list_groups_total",
+		Help:      "Total ListGroups requests by client and request version",
+	}, []string{"client_ip", "version"})
+
+	// DescribeProducersTotal counts the topics whose producer state is described by admin clients
+	DescribeProducersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "describe_producers_total",
+		Help:      "Total topics of DescribeProducers requests by client and topic",
+	}, []string{"client_ip", "topic"})
+
+	// UnknownApiKeyTotal counts requests of api keys the sniffer doesn't know, sent by clients of
+	// a newer Kafka version
+	UnknownApiKeyTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unknown_api_key_total",
+		Help:      "Total requests of unknown api keys by client and api key",
+	}, []string{"client_ip", "api_key"})
+
+	// DuplicateCorrelationTotal counts requests reusing the correlation id of a recent request of
+	// their connection, e.g. sent by a buggy retry loop
+	DuplicateCorrelationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_correlation_total",
+		Help:      "Total requests reusing the correlation id of a recent request of their connection, by client",
+	}, []string{"client_ip"})
+
+	// AssemblerFlushedTotal counts the connections flushed by the periodic flush of the TCP
+	// assembler, by result: flushed (segments were pushed past a gap or the connection was closed,
+	// as counted by gopacket) or closed
+	AssemblerFlushedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "assembler_flushed_total",
+		Help:      "Total connections flushed or closed by the periodic flush of the TCP assembler",
+	}, []string{"result"})
+
+	// StreamsActive is the number of streams being decoded, each holding a read buffer
+	StreamsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "streams_active",
+		Help:      "Number of client streams currently being decoded",
+	})
+
+	// DecodeQueueDepth is the number of streams waiting for a decode worker, when decoding is
+	// bounded to a worker pool
+	DecodeQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "decode_queue_depth",
+		Help:      "Number of client streams with a queued request waiting for a decode worker",
+	})
+
+	// RequestLatencySeconds observes the time between a request and its response
+	RequestLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_latency_seconds",
+		Help:      "Round-trip time between requests and their responses by request type",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"request_type"})
+
+	// KafkaOutputRecordsTotal counts the event records produced by the Kafka sink by result (sent, failed)
+	KafkaOutputRecordsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_output_records_total",
+		Help:      "Total event records produced to the output topic by result",
+	}, []string{"result"})
+
+	// EventsDispatchedTotal counts events handed to each output sink by result (sent, dropped, failed)
+	EventsDispatchedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dispatched_total",
+		Help:      "Total events dispatched to output sinks by result",
+	}, []string{"sink", "result"})
+
+	// EmitSinkDroppedTotal counts events an output sink lost because its buffer was full
+	EmitSinkDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emit_sink_dropped_total",
+		Help:      "Total events dropped from full output sink buffers",
+	}, []string{"sink"})
 )
 
 // InitializeMetrics initializes the metrics with zero values so they appear in the metrics endpoint
@@ -114,6 +421,7 @@ func init() {
 }
 
 // ClientMetricsCollector is an interface, which allows to collect metrics for concrete client
+// into a storage
 type ClientMetricsCollector interface {
-	CollectClientMetrics(srcHost string)
+	CollectClientMetrics(storage *Storage, srcHost string)
 }
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of the client relationships kept by a Storage
+type Snapshot struct {
+	Time    time.Time            `json:"time"`
+	Clients []ClientRelationship `json:"clients"`
+}
+
+// ClientRelationship lists what is known about a client
+type ClientRelationship struct {
+	ClientIP       string   `json:"client_ip"`
+	Username       string   `json:"username,omitempty"`
+	Mechanism      string   `json:"mechanism,omitempty"`
+	Application    string   `json:"application,omitempty"`
+	ProducedTopics []string `json:"produced_topics"`
+	ConsumedTopics []string `json:"consumed_topics"`
+	Groups         []string `json:"groups"`
+}
+
+// Snapshot returns the current client relationships, sorted by client IP
+func (s *Storage) Snapshot() Snapshot {
+	s.mapMutex.RLock()
+	defer s.mapMutex.RUnlock()
+
+	clients := make(map[string]*ClientRelationship)
+	client := func(clientIP string) *ClientRelationship {
+		c, ok := clients[clientIP]
+		if !ok {
+			c = &ClientRelationship{
+				ClientIP:       clientIP,
+				ProducedTopics: []string{},
+				ConsumedTopics: []string{},
+				Groups:         []string{},
+			}
+			clients[clientIP] = c
+		}
+		return c
+	}
+
+	for clientIP, info := range s.userClientMapping {
+		c := client(clientIP)
+		c.Username = info.username
+		c.Mechanism = info.mechanism
+	}
+	for clientIP, application := range s.clientApplications {
+		client(clientIP).Application = application
+	}
+	for clientIP, topics := range s.clientProducerTopics {
+		c := client(clientIP)
+		c.ProducedTopics = sortedTopics(topics)
+	}
+	for clientIP, topics := range s.clientConsumerTopics {
+		c := client(clientIP)
+		c.ConsumedTopics = sortedTopics(topics)
+	}
+	for clientIP, groups := range s.clientGroups {
+		c := client(clientIP)
+		c.Groups = sortedKeys(groups)
+	}
+
+	snapshot := Snapshot{Time: time.Now(), Clients: make([]ClientRelationship, 0, len(clients))}
+	for _, c := range clients {
+		snapshot.Clients = append(snapshot.Clients, *c)
+	}
+	sort.Slice(snapshot.Clients, func(i, j int) bool {
+		return snapshot.Clients[i].ClientIP < snapshot.Clients[j].ClientIP
+	})
+
+	return snapshot
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedTopics(topics map[string]topicActivity) []string {
+	keys := make([]string, 0, len(topics))
+	for k := range topics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RelationshipsHandler serves the snapshot of the default storage as JSON
+func RelationshipsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if defaultStorage == nil {
+			http.Error(w, "metrics storage not initialized", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(defaultStorage.Snapshot()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
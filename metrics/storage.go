@@ -1,11 +1,14 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -15,18 +18,46 @@ const namespace = "kafka_sniffer"
 // metric with specific labels is removed from storage. It is needed to keep only fresh producer,
 // topic and consumer relations.
 type Storage struct {
-	producerTopicRelationInfo *metric
-	consumerTopicRelationInfo *metric
-	activeConnectionsTotal    *metric
+	producerTopicRelationInfo      *metric
+	consumerTopicRelationInfo      *metric
+	activeConnectionsTotal         *metric
+	consumerGroupTopicRelationInfo *metric
+	consumerGroupMemberInfo        *metric
+	memberPartitionAssignment      *metric
+	fetchPartitions                *metric
+	producePartitions              *metric
+	producerAcks                   *metric
+	produceTimeout                 *metric
+	transactionalProducerInfo      *metric
+	clientSoftwareCurrent          *metric
+	fetchMaxWait                   *metric
+	fetchMinBytes                  *metric
+	// clientTopicCount follows the topic maps, it doesn't expire on its own
+	clientTopicCount               *prometheus.GaugeVec
 	
 	// Maps client IPs to their authenticated usernames
 	userClientMapping     map[string]userInfo
 	// Maps client IPs to the topics they produce to
-	clientProducerTopics  map[string]map[string]bool
+	clientProducerTopics  map[string]map[string]topicActivity
 	// Maps client IPs to the topics they consume from
-	clientConsumerTopics  map[string]map[string]bool
+	clientConsumerTopics  map[string]map[string]topicActivity
+	// Maps client IPs to the consumer groups they take part in
+	clientGroups          map[string]map[string]bool
+	// Maps client IPs to the application derived from their ClientID
+	clientApplications    map[string]string
+	// Maps client IPs to the time of their last tracked activity
+	clientLastActive      map[string]time.Time
+	// Topics not seen for longer than topicExpireTime are pruned, as their relation metrics expire
+	topicExpireTime       time.Duration
 	// Mutex for thread-safe map access
 	mapMutex              sync.RWMutex
+	// now returns the time of client activity and expiration, replaced in tests
+	now                   func() time.Time
+}
+
+// topicActivity is the last activity of a client on a topic
+type topicActivity struct {
+	lastSeen time.Time
 }
 
 // userInfo stores authentication information for a client
@@ -36,27 +67,123 @@ type userInfo struct {
 	lastActive time.Time
 }
 
-// NewStorage creates new Storage
+// StorageOptions sets the expiration time of each family of expiring metrics. Zero durations
+// default to DefaultExpireTime.
+type StorageOptions struct {
+	DefaultExpireTime time.Duration
+	// Relations expire the producer, consumer and group relations to topics, group members and
+	// transactional ids
+	Relations time.Duration
+	// Connections expire the active connections of clients
+	Connections time.Duration
+	// Clients expire the settings seen in the requests of clients: partition counts, acks,
+	// fetch settings and client software
+	Clients time.Duration
+}
+
+// WithDefaults returns the options with zero durations set to DefaultExpireTime
+func (o StorageOptions) WithDefaults() StorageOptions {
+	for _, d := range []*time.Duration{&o.Relations, &o.Connections, &o.Clients} {
+		if *d == 0 {
+			*d = o.DefaultExpireTime
+		}
+	}
+	return o
+}
+
+// NewStorage creates new Storage whose metrics all expire after expireTime
 func NewStorage(registerer prometheus.Registerer, expireTime time.Duration) *Storage {
+	return NewStorageWithOptions(registerer, StorageOptions{DefaultExpireTime: expireTime})
+}
+
+// NewStorageWithOptions creates new Storage with an expiration time per metric family
+func NewStorageWithOptions(registerer prometheus.Registerer, opts StorageOptions) *Storage {
+	opts = opts.WithDefaults()
+
 	var s = &Storage{
 		producerTopicRelationInfo: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "producer_topic_relation_info",
 			Help:      "Relation information between producer and topic",
-		}, []string{"client_ip", "topic"}), expireTime),
+		}, []string{"client_ip", "topic", "application"}), opts.Relations),
 		consumerTopicRelationInfo: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "consumer_topic_relation_info",
 			Help:      "Relation information between consumer and topic",
-		}, []string{"client_ip", "topic"}), expireTime),
+		}, []string{"client_ip", "topic", "application"}), opts.Relations),
 		activeConnectionsTotal: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "active_connections_total",
 			Help:      "Contains total count of active connections",
-		}, []string{"client_ip"}), expireTime),
+		}, []string{"client_ip"}), opts.Connections),
+		consumerGroupTopicRelationInfo: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consumer_group_topic_relation_info",
+			Help:      "Relation information between consumer, consumer group and topic",
+		}, []string{"client_ip", "group", "topic"}), opts.Relations),
+		consumerGroupMemberInfo: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consumer_group_member_info",
+			Help:      "Relation information between client, consumer group and group member id",
+		}, []string{"client_ip", "group", "member_id"}), opts.Relations),
+		memberPartitionAssignment: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "member_partition_assignment",
+			Help:      "Number of partitions of a topic assigned to a consumer group member by the group leader",
+		}, []string{"group", "member_id", "topic"}), opts.Relations),
+		fetchPartitions: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fetch_partitions",
+			Help:      "Number of partitions of a topic in the last fetch request of a client",
+		}, []string{"client_ip", "topic"}), opts.Clients),
+		producePartitions: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "produce_partitions",
+			Help:      "Number of partitions of a topic in the last produce request of a client",
+		}, []string{"client_ip", "topic"}), opts.Clients),
+		producerAcks: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "producer_acks",
+			Help:      "Required acks (0, 1 or -1 for all) of the produce requests of a client, and whether they are transactional",
+		}, []string{"client_ip", "acks", "transactional"}), opts.Clients),
+		produceTimeout: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "produce_timeout_ms",
+			Help:      "Timeout in milliseconds of the last produce request of a client",
+		}, []string{"client_ip"}), opts.Clients),
+		transactionalProducerInfo: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "transactional_producer_info",
+			Help:      "Relation information between client and the transactional id of its produce requests",
+		}, []string{"client_ip", "transactional_id"}), opts.Relations),
+		clientSoftwareCurrent: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "client_software_current",
+			Help:      "Client software name and version currently used by a client, as sent in ApiVersions requests",
+		}, []string{"client_ip", "software_name", "software_version"}), opts.Clients),
+		fetchMaxWait: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fetch_max_wait_ms",
+			Help:      "Max wait time in milliseconds of the last fetch request of a client",
+		}, []string{"client_ip"}), opts.Clients),
+		fetchMinBytes: newMetric(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fetch_min_bytes",
+			Help:      "Min bytes of the last fetch request of a client",
+		}, []string{"client_ip"}), opts.Clients),
+		clientTopicCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "client_topic_count",
+			Help:      "Number of distinct topics a client currently produces to or consumes from",
+		}, []string{"client_ip", "direction"}),
 		userClientMapping:     make(map[string]userInfo),
-		clientProducerTopics:  make(map[string]map[string]bool),
-		clientConsumerTopics:  make(map[string]map[string]bool),
+		clientProducerTopics:  make(map[string]map[string]topicActivity),
+		clientConsumerTopics:  make(map[string]map[string]topicActivity),
+		clientGroups:          make(map[string]map[string]bool),
+		clientApplications:    make(map[string]string),
+		clientLastActive:      make(map[string]time.Time),
+		topicExpireTime:       opts.Relations,
+		now:                   time.Now,
 	}
 
 	// Use safe registration approach for all metrics to avoid panics on duplicate registration
@@ -70,6 +197,18 @@ func NewStorage(registerer prometheus.Registerer, expireTime time.Duration) *Sto
 	tryRegister(s.producerTopicRelationInfo.promMetric)
 	tryRegister(s.consumerTopicRelationInfo.promMetric)
 	tryRegister(s.activeConnectionsTotal.promMetric)
+	tryRegister(s.consumerGroupTopicRelationInfo.promMetric)
+	tryRegister(s.consumerGroupMemberInfo.promMetric)
+	tryRegister(s.memberPartitionAssignment.promMetric)
+	tryRegister(s.fetchPartitions.promMetric)
+	tryRegister(s.producePartitions.promMetric)
+	tryRegister(s.producerAcks.promMetric)
+	tryRegister(s.produceTimeout.promMetric)
+	tryRegister(s.transactionalProducerInfo.promMetric)
+	tryRegister(s.clientSoftwareCurrent.promMetric)
+	tryRegister(s.fetchMaxWait.promMetric)
+	tryRegister(s.fetchMinBytes.promMetric)
+	tryRegister(s.clientTopicCount)
 	
 	// Then register the global metrics from external.go
 	
@@ -82,59 +221,243 @@ func NewStorage(registerer prometheus.Registerer, expireTime time.Duration) *Sto
 	tryRegister(AuthUserActivity) 
 	tryRegister(ProducerUserTopicInfo)
 	tryRegister(ConsumerUserTopicInfo)
+	tryRegister(UserGroupInfo)
+	tryRegister(LogDirOpTotal)
+	tryRegister(MaxApiKeySeen)
+	tryRegister(TruncatedFieldsTotal)
+	tryRegister(WebhookDeliveryTotal)
+	tryRegister(CreatePartitionsInfo)
+	tryRegister(NegotiatedProtocolInfo)
+	tryRegister(EventsDispatchedTotal)
+	tryRegister(KafkaOutputRecordsTotal)
+	tryRegister(EmitSinkDroppedTotal)
+	tryRegister(OffsetForLeaderEpochTotal)
+	tryRegister(DeleteRecordsTotal)
+	tryRegister(AclChangesTotal)
+	tryRegister(DescribeConfigsTotal)
+	tryRegister(AlterConfigsTotal)
+	tryRegister(TxnInitTotal)
+	tryRegister(AutoTopicCreateAttemptTotal)
+	tryRegister(GroupHeartbeatTotal)
+	tryRegister(GroupLeaveTotal)
+	tryRegister(ScramCredentialOpTotal)
+	tryRegister(UnauthenticatedDataTotal)
+	tryRegister(RequestLatencySeconds)
+	tryRegister(FilteredTopicsTotal)
+	tryRegister(ProduceHeaderSeenTotal)
+	tryRegister(TLSConnectionsTotal)
+	tryRegister(StreamsActive)
+	tryRegister(ProduceBytesTotal)
+	tryRegister(FindCoordinatorTotal)
+	tryRegister(TopicCreateTotal)
+	tryRegister(IdempotentProduceTotal)
+	tryRegister(NonIdempotentProduceTotal)
+	tryRegister(ConnectionBytesTotal)
+	tryRegister(InvalidLengthTotal)
+	tryRegister(FetchTotal)
+	tryRegister(DescribeProducersTotal)
+	tryRegister(ListGroupsTotal)
+	tryRegister(AssemblerFlushedTotal)
+	tryRegister(DuplicateCorrelationTotal)
+	tryRegister(DecodeQueueDepth)
+	tryRegister(UnknownApiKeyTotal)
+	tryRegister(ProduceNullKeyTotal)
+	tryRegister(AuthFailureSuspectedTotal)
 
 	return s
 }
 
 // AddProducerTopicRelationInfo adds (producer, topic) pair to metrics
 func (s *Storage) AddProducerTopicRelationInfo(producer, topic string) {
-	s.producerTopicRelationInfo.set(producer, topic)
+	s.producerTopicRelationInfo.set(producer, topic, s.clientApplication(producer))
 	
 	// Track producer -> topic relationship in memory
 	s.mapMutex.Lock()
 	defer s.mapMutex.Unlock()
 	
 	if _, exists := s.clientProducerTopics[producer]; !exists {
-		s.clientProducerTopics[producer] = make(map[string]bool)
+		s.clientProducerTopics[producer] = make(map[string]topicActivity)
 	}
-	s.clientProducerTopics[producer][topic] = true
+	s.clientProducerTopics[producer][topic] = topicActivity{lastSeen: s.now()}
+	s.touch(producer)
+	s.updateTopicCount(producer)
 	
 	// If this client has an associated username, also update the user-topic metrics
 	if userInfo, exists := s.userClientMapping[producer]; exists {
 		// Update the metric to track which user is producing to this topic
-		ProducerUserTopicInfo.WithLabelValues(producer, userInfo.username, topic).Set(1)
-		fmt.Printf("Storage: Updated producer-topic relation with username: %s -> %s (user: %s)\n", 
+		SetProducerUserTopic(producer, userInfo.username, topic)
+		logging.Printf("Storage: Updated producer-topic relation with username: %s -> %s (user: %s)", 
 			producer, topic, userInfo.username)
 	}
 }
 
 // AddConsumerTopicRelationInfo adds (consumer, topic) pair to metrics
 func (s *Storage) AddConsumerTopicRelationInfo(consumer, topic string) {
-	s.consumerTopicRelationInfo.set(consumer, topic)
+	s.consumerTopicRelationInfo.set(consumer, topic, s.clientApplication(consumer))
 	
 	// Track consumer -> topic relationship in memory
 	s.mapMutex.Lock()
 	defer s.mapMutex.Unlock()
 	
 	if _, exists := s.clientConsumerTopics[consumer]; !exists {
-		s.clientConsumerTopics[consumer] = make(map[string]bool)
+		s.clientConsumerTopics[consumer] = make(map[string]topicActivity)
 	}
-	s.clientConsumerTopics[consumer][topic] = true
+	s.clientConsumerTopics[consumer][topic] = topicActivity{lastSeen: s.now()}
+	s.touch(consumer)
+	s.updateTopicCount(consumer)
 	
 	// If this client has an associated username, also update the user-topic metrics
 	if userInfo, exists := s.userClientMapping[consumer]; exists {
 		// Update the metric to track which user is consuming from this topic
-		ConsumerUserTopicInfo.WithLabelValues(consumer, userInfo.username, topic).Set(1)
-		fmt.Printf("Storage: Updated consumer-topic relation with username: %s -> %s (user: %s)\n", 
+		SetConsumerUserTopic(consumer, userInfo.username, topic)
+		logging.Printf("Storage: Updated consumer-topic relation with username: %s -> %s (user: %s)", 
 			consumer, topic, userInfo.username)
 	}
 }
 
+// AddConsumerGroupTopicRelationInfo adds (consumer, group, topic) triple to metrics
+func (s *Storage) AddConsumerGroupTopicRelationInfo(consumer, group, topic string) {
+	s.consumerGroupTopicRelationInfo.set(consumer, group, topic)
+	s.addClientGroup(consumer, group)
+}
+
+// AddConsumerGroupMemberInfo adds (client, group, member id) triple to metrics
+func (s *Storage) AddConsumerGroupMemberInfo(clientIP, group, memberID string) {
+	s.consumerGroupMemberInfo.set(clientIP, group, memberID)
+	s.addClientGroup(clientIP, group)
+}
+
+// SetMemberPartitionAssignment sets the number of partitions of a topic assigned to a group member
+func (s *Storage) SetMemberPartitionAssignment(group, memberID, topic string, partitions int) {
+	s.memberPartitionAssignment.setValue(float64(partitions), group, memberID, topic)
+}
+
+// AddClientGroup tracks a group used by a client, e.g. whose coordinator it looked up,
+// before any membership is known
+func (s *Storage) AddClientGroup(clientIP, group string) {
+	s.addClientGroup(clientIP, group)
+}
+
+// SetFetchPartitions sets the number of partitions of a topic fetched by a client
+func (s *Storage) SetFetchPartitions(clientIP, topic string, partitions int) {
+	s.fetchPartitions.setValue(float64(partitions), clientIP, topic)
+}
+
+// SetFetchWait sets the max wait time and min bytes of the last fetch request of a client.
+// Consumers with a low max wait and tiny min bytes send many fetch requests.
+func (s *Storage) SetFetchWait(clientIP string, maxWaitMs, minBytes int32) {
+	s.fetchMaxWait.setValue(float64(maxWaitMs), clientIP)
+	s.fetchMinBytes.setValue(float64(minBytes), clientIP)
+}
+
+// SetProducePartitions sets the number of partitions of a topic produced to by a client
+func (s *Storage) SetProducePartitions(clientIP, topic string, partitions int) {
+	s.producePartitions.setValue(float64(partitions), clientIP, topic)
+}
+
+// SetProducerAcks records the required acks of a produce request of a client
+func (s *Storage) SetProducerAcks(clientIP string, acks int16, transactional bool) {
+	s.producerAcks.set(clientIP, strconv.Itoa(int(acks)), strconv.FormatBool(transactional))
+}
+
+// SetProduceTimeout sets the timeout of the last produce request of a client
+func (s *Storage) SetProduceTimeout(clientIP string, timeoutMs int32) {
+	s.produceTimeout.setValue(float64(timeoutMs), clientIP)
+}
+
+// AddTransactionalProducerInfo adds (client, transactional id) pair to metrics
+func (s *Storage) AddTransactionalProducerInfo(clientIP, transactionalID string) {
+	s.transactionalProducerInfo.set(clientIP, transactionalID)
+}
+
+// SetClientSoftware records the client software name and version currently used by a client
+func (s *Storage) SetClientSoftware(clientIP, name, version string) {
+	s.clientSoftwareCurrent.set(clientIP, name, version)
+}
+
+// addClientGroup tracks client -> group relationship in memory, and the user -> group one
+// when the client has an associated username
+func (s *Storage) addClientGroup(clientIP, group string) {
+	s.mapMutex.Lock()
+	defer s.mapMutex.Unlock()
+
+	if _, exists := s.clientGroups[clientIP]; !exists {
+		s.clientGroups[clientIP] = make(map[string]bool)
+	}
+	s.clientGroups[clientIP][group] = true
+	s.touch(clientIP)
+
+	if userInfo, exists := s.userClientMapping[clientIP]; exists {
+		SetUserGroup(clientIP, userInfo.username, group)
+	}
+}
+
+// GroupMemberClient returns the client IP of a group member, as long as its membership hasn't expired
+func (s *Storage) GroupMemberClient(group, memberID string) (string, bool) {
+	labels, ok := s.consumerGroupMemberInfo.find(func(labels []string) bool {
+		return labels[1] == group && labels[2] == memberID
+	})
+	if !ok {
+		return "", false
+	}
+	return labels[0], true
+}
+
+// SetClientApplication associates a client IP with the application derived from its ClientID
+func (s *Storage) SetClientApplication(clientIP, application string) {
+	s.mapMutex.Lock()
+	defer s.mapMutex.Unlock()
+
+	s.clientApplications[clientIP] = application
+	s.touch(clientIP)
+}
+
+// clientApplication returns the application of a client, falling back to its IP
+func (s *Storage) clientApplication(clientIP string) string {
+	s.mapMutex.RLock()
+	defer s.mapMutex.RUnlock()
+
+	if application, exists := s.clientApplications[clientIP]; exists {
+		return application
+	}
+	return clientIP
+}
+
 // AddActiveConnectionsTotal adds incoming connection
 func (s *Storage) AddActiveConnectionsTotal(clientIP string) {
 	s.activeConnectionsTotal.inc(clientIP)
 }
 
+// AddActiveTopicInfo adds a topic used by a client without telling whether it produces or
+// consumes, e.g. in a metadata request, so both relations are added
+func (s *Storage) AddActiveTopicInfo(clientIP, topic string) {
+	s.AddProducerTopicRelationInfo(clientIP, topic)
+	s.AddConsumerTopicRelationInfo(clientIP, topic)
+}
+
+// RecordAuthUser records the activity of an authenticated user, and maps the client to the
+// username so that its topic relations get the user series
+func (s *Storage) RecordAuthUser(clientIP, username, mechanism string) {
+	if username == "" {
+		return
+	}
+	SetAuthUserActivity(clientIP, username, mechanism)
+	s.AddUserClientMapping(clientIP, username, mechanism)
+}
+
+// TrackSaslAuthentication counts a SASL authentication of a client. The username is empty
+// when only the mechanism is known, e.g. from the handshake.
+func (s *Storage) TrackSaslAuthentication(clientIP, mechanism, username string) {
+	if mechanism == "" {
+		return
+	}
+	IncAuthentication(clientIP, mechanism, username)
+	if username != "" {
+		s.RecordAuthUser(clientIP, username, mechanism)
+		s.AddActiveConnectionsTotal(clientIP)
+	}
+}
+
 // AddUserClientMapping associates a username with a client IP
 func (s *Storage) AddUserClientMapping(clientIP, username, mechanism string) {
 	s.mapMutex.Lock()
@@ -144,20 +467,22 @@ func (s *Storage) AddUserClientMapping(clientIP, username, mechanism string) {
 	s.userClientMapping[clientIP] = userInfo{
 		username:   username,
 		mechanism:  mechanism,
-		lastActive: time.Now(),
+		lastActive: s.now(),
 	}
+	s.touch(clientIP)
 	
 	// Also update the user-topic metrics for any existing topic relationships
 	s.updateUserTopicMetrics(clientIP, username)
 	
-	fmt.Printf("Storage: Added user mapping for client %s, username %s, mechanism %s\n", 
+	logging.Printf("Storage: Added user mapping for client %s, username %s, mechanism %s", 
 		clientIP, username, mechanism)
 }
 
 // GetUsernameForClient returns the username associated with a client IP
 func (s *Storage) GetUsernameForClient(clientIP string) string {
-	s.mapMutex.RLock()
-	defer s.mapMutex.RUnlock()
+	// the last active time is written
+	s.mapMutex.Lock()
+	defer s.mapMutex.Unlock()
 	
 	userData, exists := s.userClientMapping[clientIP]
 	if !exists {
@@ -165,7 +490,7 @@ func (s *Storage) GetUsernameForClient(clientIP string) string {
 	}
 	
 	// Update last active time
-	userData.lastActive = time.Now()
+	userData.lastActive = s.now()
 	s.userClientMapping[clientIP] = userData
 	
 	return userData.username
@@ -184,28 +509,88 @@ func (s *Storage) GetAuthMechanismForClient(clientIP string) string {
 	return userData.mechanism
 }
 
-// GetClientProducerTopics returns the list of topics a client is producing to
+// GetClientProducerTopics returns the list of topics a client is producing to, pruning the
+// topics it hasn't produced to for longer than the expiration time
 func (s *Storage) GetClientProducerTopics(clientIP string) []string {
+	s.mapMutex.Lock()
+	defer s.mapMutex.Unlock()
+
+	topics := pruneTopics(s.clientProducerTopics, clientIP, s.topicExpireTime, s.now())
+	s.updateTopicCount(clientIP)
+	return topics
+}
+
+// GetClientConsumerTopics returns the list of topics a client is consuming from, pruning the
+// topics it hasn't consumed from for longer than the expiration time
+func (s *Storage) GetClientConsumerTopics(clientIP string) []string {
+	s.mapMutex.Lock()
+	defer s.mapMutex.Unlock()
+
+	topics := pruneTopics(s.clientConsumerTopics, clientIP, s.topicExpireTime, s.now())
+	s.updateTopicCount(clientIP)
+	return topics
+}
+
+// updateTopicCount sets the topic counts of a client from the topic maps, removing them once
+// the client has no topics. Called with the lock held.
+func (s *Storage) updateTopicCount(clientIP string) {
+	for direction, clientTopics := range map[string]map[string]map[string]topicActivity{
+		"produce": s.clientProducerTopics,
+		"consume": s.clientConsumerTopics,
+	} {
+		if count := len(clientTopics[clientIP]); count > 0 {
+			s.clientTopicCount.WithLabelValues(clientIP, direction).Set(float64(count))
+		} else {
+			s.clientTopicCount.DeleteLabelValues(clientIP, direction)
+		}
+	}
+}
+
+// TopicSeen tells whether a topic was produced to or consumed from by any client within the
+// expiration time, i.e. whether it is known to exist
+func (s *Storage) TopicSeen(topic string) bool {
 	s.mapMutex.RLock()
 	defer s.mapMutex.RUnlock()
-	
+
+	now := s.now()
+	for _, clientTopics := range []map[string]map[string]topicActivity{s.clientProducerTopics, s.clientConsumerTopics} {
+		for _, topics := range clientTopics {
+			activity, ok := topics[topic]
+			if ok && (s.topicExpireTime == 0 || now.Sub(activity.lastSeen) <= s.topicExpireTime) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneTopics removes the topics of a client not seen for longer than expireTime and returns
+// the remaining ones. A zero expireTime keeps every topic. Called with the lock held.
+func pruneTopics(clientTopics map[string]map[string]topicActivity, clientIP string, expireTime time.Duration, now time.Time) []string {
 	topics := []string{}
-	for topic := range s.clientProducerTopics[clientIP] {
+	for topic, activity := range clientTopics[clientIP] {
+		if expireTime > 0 && now.Sub(activity.lastSeen) > expireTime {
+			delete(clientTopics[clientIP], topic)
+			continue
+		}
 		topics = append(topics, topic)
 	}
+	if len(topics) == 0 {
+		delete(clientTopics, clientIP)
+	}
 	return topics
 }
 
-// GetClientConsumerTopics returns the list of topics a client is consuming from
-func (s *Storage) GetClientConsumerTopics(clientIP string) []string {
+// GetClientGroups returns the list of consumer groups a client takes part in
+func (s *Storage) GetClientGroups(clientIP string) []string {
 	s.mapMutex.RLock()
 	defer s.mapMutex.RUnlock()
-	
-	topics := []string{}
-	for topic := range s.clientConsumerTopics[clientIP] {
-		topics = append(topics, topic)
+
+	groups := []string{}
+	for group := range s.clientGroups[clientIP] {
+		groups = append(groups, group)
 	}
-	return topics
+	return groups
 }
 
 // updateUserTopicMetrics updates all topic metrics with the username
@@ -213,32 +598,86 @@ func (s *Storage) GetClientConsumerTopics(clientIP string) []string {
 func (s *Storage) updateUserTopicMetrics(clientIP, username string) {
 	// Update producer topic metrics
 	for topic := range s.clientProducerTopics[clientIP] {
-		ProducerUserTopicInfo.WithLabelValues(clientIP, username, topic).Set(1)
-		fmt.Printf("Storage: Updated existing producer-topic relation with username: %s -> %s (user: %s)\n", 
+		SetProducerUserTopic(clientIP, username, topic)
+		logging.Printf("Storage: Updated existing producer-topic relation with username: %s -> %s (user: %s)", 
 			clientIP, topic, username)
 	}
 	
 	// Update consumer topic metrics
 	for topic := range s.clientConsumerTopics[clientIP] {
-		ConsumerUserTopicInfo.WithLabelValues(clientIP, username, topic).Set(1)
-		fmt.Printf("Storage: Updated existing consumer-topic relation with username: %s -> %s (user: %s)\n", 
+		SetConsumerUserTopic(clientIP, username, topic)
+		logging.Printf("Storage: Updated existing consumer-topic relation with username: %s -> %s (user: %s)", 
 			clientIP, topic, username)
 	}
+
+	// Update consumer group metrics
+	for group := range s.clientGroups[clientIP] {
+		SetUserGroup(clientIP, username, group)
+	}
+}
+
+// touch records activity of a client, called with the lock held
+func (s *Storage) touch(clientIP string) {
+	s.clientLastActive[clientIP] = s.now()
 }
 
-// CleanupExpiredUserMappings removes inactive user mappings to prevent memory leaks
+// CleanupExpiredUserMappings removes the user mapping, topics, groups and application of
+// clients without activity for longer than expirationTime, to prevent memory leaks
 func (s *Storage) CleanupExpiredUserMappings(expirationTime time.Duration) {
 	s.mapMutex.Lock()
 	defer s.mapMutex.Unlock()
-	
-	now := time.Now()
+
+	now := s.now()
 	for clientIP, userInfo := range s.userClientMapping {
-		if now.Sub(userInfo.lastActive) > expirationTime {
-			fmt.Printf("Storage: Removing expired user mapping for client %s, username %s\n", 
+		lastActive := userInfo.lastActive
+		if t, ok := s.clientLastActive[clientIP]; ok && t.After(lastActive) {
+			lastActive = t
+		}
+		if now.Sub(lastActive) > expirationTime {
+			logging.Printf("Storage: Removing expired user mapping for client %s, username %s",
 				clientIP, userInfo.username)
 			delete(s.userClientMapping, clientIP)
 		}
 	}
+
+	// Clients still active may have stopped using some of their topics
+	for clientIP := range s.clientProducerTopics {
+		pruneTopics(s.clientProducerTopics, clientIP, expirationTime, now)
+		s.updateTopicCount(clientIP)
+	}
+	for clientIP := range s.clientConsumerTopics {
+		pruneTopics(s.clientConsumerTopics, clientIP, expirationTime, now)
+		s.updateTopicCount(clientIP)
+	}
+
+	for clientIP, lastActive := range s.clientLastActive {
+		if now.Sub(lastActive) > expirationTime {
+			delete(s.clientProducerTopics, clientIP)
+			delete(s.clientConsumerTopics, clientIP)
+			delete(s.clientGroups, clientIP)
+			delete(s.clientApplications, clientIP)
+			delete(s.clientLastActive, clientIP)
+			s.updateTopicCount(clientIP)
+		}
+	}
+}
+
+// StartCleanup runs CleanupExpiredUserMappings every interval until ctx is done, removing
+// the state of clients inactive for longer than ttl
+func (s *Storage) StartCleanup(ctx context.Context, interval, ttl time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.CleanupExpiredUserMappings(ttl)
+			}
+		}
+	}()
 }
 
 // metric contains expiration functionality
@@ -272,6 +711,12 @@ func (m *metric) set(labels ...string) {
 	m.update(labels...)
 }
 
+func (m *metric) setValue(value float64, labels ...string) {
+	m.promMetric.WithLabelValues(labels...).Set(value)
+
+	m.update(labels...)
+}
+
 func (m *metric) inc(labels ...string) {
 	m.promMetric.WithLabelValues(labels...).Inc()
 
@@ -289,6 +734,19 @@ func (m *metric) update(labels ...string) {
 	}
 }
 
+// find returns the labels of the first live relation matching
+func (m *metric) find(match func(labels []string) bool) ([]string, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for _, r := range m.relations {
+		if match(r.labels) {
+			return r.labels, true
+		}
+	}
+	return nil, false
+}
+
 // runExpiration removes metric by specific label values and removes relation
 func (m *metric) runExpiration() {
 	for labels := range m.expCh {
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeClock is a clock only moving when advanced
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestStorage returns a storage whose client activity follows clock
+func newTestStorage(clock *fakeClock, opts StorageOptions) *Storage {
+	s := NewStorageWithOptions(prometheus.NewRegistry(), opts)
+	s.now = clock.Now
+	return s
+}
+
+// mappedUsername returns the username mapped to a client, without marking it active like
+// GetUsernameForClient
+func mappedUsername(s *Storage, clientIP string) string {
+	s.mapMutex.RLock()
+	defer s.mapMutex.RUnlock()
+	return s.userClientMapping[clientIP].username
+}
+
+func TestCleanupExpiredUserMappings(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 16, 16, 0, 0, 0, time.UTC)}
+	s := newTestStorage(clock, StorageOptions{DefaultExpireTime: time.Hour})
+	ttl := 10 * time.Minute
+
+	s.AddUserClientMapping("10.0.0.1", "alice", "PLAIN")
+	s.AddProducerTopicRelationInfo("10.0.0.1", "orders")
+
+	clock.Advance(6 * time.Minute)
+	s.AddUserClientMapping("10.0.0.2", "bob", "PLAIN")
+	s.CleanupExpiredUserMappings(ttl)
+	if username := mappedUsername(s, "10.0.0.1"); username != "alice" {
+		t.Fatalf("username of an active client is %q, want alice", username)
+	}
+
+	clock.Advance(5 * time.Minute)
+	s.CleanupExpiredUserMappings(ttl)
+	if username := mappedUsername(s, "10.0.0.1"); username != "" {
+		t.Errorf("username of a client inactive for 11m is %q, want it removed", username)
+	}
+	if topics := s.GetClientProducerTopics("10.0.0.1"); len(topics) != 0 {
+		t.Errorf("topics of a client inactive for 11m are %v, want them removed", topics)
+	}
+	if username := mappedUsername(s, "10.0.0.2"); username != "bob" {
+		t.Errorf("username of a client inactive for 5m is %q, want bob", username)
+	}
+}
+
+func TestCleanupKeepsActiveClients(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 16, 16, 0, 0, 0, time.UTC)}
+	s := newTestStorage(clock, StorageOptions{DefaultExpireTime: time.Hour})
+	ttl := 10 * time.Minute
+
+	s.AddUserClientMapping("10.0.0.1", "alice", "PLAIN")
+	// activity on a topic keeps the user mapping of the client
+	clock.Advance(8 * time.Minute)
+	s.AddConsumerTopicRelationInfo("10.0.0.1", "orders")
+	clock.Advance(8 * time.Minute)
+	s.CleanupExpiredUserMappings(ttl)
+
+	if username := mappedUsername(s, "10.0.0.1"); username != "alice" {
+		t.Errorf("username of a client active 8m ago is %q, want alice", username)
+	}
+	if topics := s.GetClientConsumerTopics("10.0.0.1"); len(topics) != 1 || topics[0] != "orders" {
+		t.Errorf("consumed topics are %v, want [orders]", topics)
+	}
+}
+
+// waitForCount waits up to a second for a metric to have count series
+func waitForCount(c prometheus.Collector, count int) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if testutil.CollectAndCount(c) == count {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestExpirePerFamily(t *testing.T) {
+	s := NewStorageWithOptions(prometheus.NewRegistry(), StorageOptions{
+		DefaultExpireTime: time.Hour,
+		Connections:       50 * time.Millisecond,
+	})
+
+	s.AddActiveConnectionsTotal("10.0.0.1")
+	s.AddProducerTopicRelationInfo("10.0.0.1", "orders")
+	s.SetProduceTimeout("10.0.0.1", 30000)
+
+	if !waitForCount(s.activeConnectionsTotal.promMetric, 0) {
+		t.Errorf("active connections didn't expire after 50ms")
+	}
+	if n := testutil.CollectAndCount(s.producerTopicRelationInfo.promMetric); n != 1 {
+		t.Errorf("%d producer relations, want the one expiring in an hour", n)
+	}
+	if n := testutil.CollectAndCount(s.produceTimeout.promMetric); n != 1 {
+		t.Errorf("%d produce timeouts, want the one expiring in an hour", n)
+	}
+}
+
+func TestStorageOptionsWithDefaults(t *testing.T) {
+	opts := StorageOptions{DefaultExpireTime: time.Hour, Clients: time.Minute}.WithDefaults()
+	if opts.Relations != time.Hour || opts.Connections != time.Hour {
+		t.Errorf("unset families expire after %v and %v, want the default 1h", opts.Relations, opts.Connections)
+	}
+	if opts.Clients != time.Minute {
+		t.Errorf("clients expire after %v, want 1m", opts.Clients)
+	}
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UsernameResolver maps SASL usernames to the names shown in the user metrics, e.g. the person
+// or team behind a service account. The extra labels enrich auth_user_activity.
+type UsernameResolver interface {
+	Resolve(username string) (display string, labels map[string]string)
+}
+
+// NopUsernameResolver keeps usernames as they are
+type NopUsernameResolver struct{}
+
+// Resolve implements UsernameResolver
+func (NopUsernameResolver) Resolve(username string) (string, map[string]string) {
+	return username, nil
+}
+
+var (
+	usernameResolver UsernameResolver = NopUsernameResolver{}
+	// userLabelNames are the extra labels of auth_user_activity, in order
+	userLabelNames []string
+)
+
+// labelNamePattern matches valid Prometheus label names, the ones starting with __ are reserved
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SetUsernameResolver sets the resolver of the usernames of the user metrics, and the names of
+// the extra labels it adds to auth_user_activity. Labels missing from a resolved username are
+// empty. It must be called before NewStorage, which registers the metric.
+func SetUsernameResolver(resolver UsernameResolver, labelNames ...string) error {
+	seen := map[string]bool{"client_ip": true, "username": true, "mechanism": true}
+	for _, name := range labelNames {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate label name %q", name)
+		}
+		seen[name] = true
+	}
+
+	usernameResolver = resolver
+	userLabelNames = labelNames
+	AuthUserActivity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "auth_user_activity",
+		Help:      "Activity tracking for authenticated users",
+	}, append([]string{"client_ip", "username", "mechanism"}, labelNames...))
+
+	// like InitializeMetrics, so that the metric appears before the first authentication
+	initValues := make([]string, 3+len(labelNames))
+	for i := range initValues {
+		initValues[i] = "init"
+	}
+	AuthUserActivity.WithLabelValues(initValues...).Set(0)
+	return nil
+}
+
+// displayName returns the name of a username in the user metrics
+func displayName(username string) string {
+	if username == "" {
+		return ""
+	}
+	display, _ := usernameResolver.Resolve(username)
+	return display
+}
+
+// userLabelValues returns the display name of a username and the values of the extra labels
+func userLabelValues(username string) (string, []string) {
+	display, labels := usernameResolver.Resolve(username)
+	values := make([]string, len(userLabelNames))
+	for i, name := range userLabelNames {
+		values[i] = labels[name]
+	}
+	return display, values
+}
+
+// UserMap is a UsernameResolver reading a CSV file. Its header names the columns: the username,
+// the display name, then the extra labels, e.g.
+//
+//	username,display,team
+//	svc-orders,Orders service,checkout
+//
+// Usernames missing from the file are kept as they are.
+type UserMap struct {
+	labelNames []string
+	users      map[string]mappedUser
+}
+
+// mappedUser is the display name and labels of a username
+type mappedUser struct {
+	display string
+	labels  map[string]string
+}
+
+// LoadUserMap reads a user map from a CSV file
+func LoadUserMap(path string) (*UserMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := readUserMap(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read user map %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// readUserMap reads a user map in CSV
+func readUserMap(r io.Reader) (*UserMap, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < 2 {
+		return nil, fmt.Errorf("the header must name at least the username and display columns")
+	}
+
+	m := &UserMap{labelNames: header[2:], users: make(map[string]mappedUser)}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		user := mappedUser{display: record[1], labels: make(map[string]string, len(m.labelNames))}
+		for i, name := range m.labelNames {
+			user.labels[name] = record[i+2]
+		}
+		m.users[record[0]] = user
+	}
+}
+
+// LabelNames returns the names of the extra labels of the map
+func (m *UserMap) LabelNames() []string {
+	return m.labelNames
+}
+
+// Resolve implements UsernameResolver
+func (m *UserMap) Resolve(username string) (string, map[string]string) {
+	user, ok := m.users[username]
+	if !ok || user.display == "" {
+		return username, user.labels
+	}
+	return user.display, user.labels
+}
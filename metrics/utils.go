@@ -1,9 +1,13 @@
 package metrics
 
 import (
-	"fmt"
+	"regexp"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 )
 
 type userMapping struct {
@@ -17,6 +21,13 @@ var (
 	once           sync.Once
 	clientUserMap  = make(map[string]*userMapping) // Maps client IPs to usernames
 	clientUserMutex sync.RWMutex                  // Protects the map
+	maxApiKey       int32 = -1                     // Highest API key seen so far
+	maxApiKeyMutex  sync.Mutex                     // Serializes updates of maxApiKey
+
+	topicPartitionCounts      = make(map[string]string) // Latest CreatePartitions count per topic
+	topicPartitionCountsMutex sync.Mutex                // Protects the map
+
+	applicationPattern *regexp.Regexp // Derives the application label from ClientID
 )
 
 // No automatic initialization here - main.go will initialize and set the storage
@@ -42,14 +53,76 @@ func AddConsumerTopicRelationInfo(consumer, topic string) {
 	RecordConsumerUserTopic(consumer, topic)
 }
 
+// AddConsumerGroupTopicRelationInfo adds consumer-group-topic relation to the default metrics storage
+func AddConsumerGroupTopicRelationInfo(consumer, group, topic string) {
+	if defaultStorage != nil {
+		defaultStorage.AddConsumerGroupTopicRelationInfo(consumer, group, topic)
+	}
+}
+
+// AddConsumerGroupMemberInfo adds consumer group membership to the default metrics storage
+func AddConsumerGroupMemberInfo(clientIP, group, memberID string) {
+	if defaultStorage != nil {
+		defaultStorage.AddConsumerGroupMemberInfo(clientIP, group, memberID)
+	}
+}
+
+// SetMemberPartitionAssignment records the partitions assigned to a group member in the default
+// metrics storage
+func SetMemberPartitionAssignment(group, memberID, topic string, partitions int) {
+	if defaultStorage != nil {
+		defaultStorage.SetMemberPartitionAssignment(group, memberID, topic, partitions)
+	}
+}
+
+// AddClientGroup adds a client-group relation to the default metrics storage
+func AddClientGroup(clientIP, group string) {
+	if defaultStorage != nil {
+		defaultStorage.AddClientGroup(clientIP, group)
+	}
+}
+
+// SetProducerAcks records the required acks of a produce request in the default metrics storage
+func SetProducerAcks(clientIP string, acks int16, transactional bool) {
+	if defaultStorage != nil {
+		defaultStorage.SetProducerAcks(clientIP, acks, transactional)
+	}
+}
+
+// SetProduceTimeout records the timeout of a produce request in the default metrics storage
+func SetProduceTimeout(clientIP string, timeoutMs int32) {
+	if defaultStorage != nil {
+		defaultStorage.SetProduceTimeout(clientIP, timeoutMs)
+	}
+}
+
+// AddTransactionalProducerInfo adds client-transactional id relation to the default metrics storage
+func AddTransactionalProducerInfo(clientIP, transactionalID string) {
+	if defaultStorage != nil {
+		defaultStorage.AddTransactionalProducerInfo(clientIP, transactionalID)
+	}
+}
+
+// SetClientSoftware records the client software of a client in the default metrics storage
+func SetClientSoftware(clientIP, name, version string) {
+	if defaultStorage != nil {
+		defaultStorage.SetClientSoftware(clientIP, name, version)
+	}
+}
+
+// GroupMemberClient returns the client IP of a group member from the default metrics storage
+func GroupMemberClient(group, memberID string) (string, bool) {
+	if defaultStorage == nil {
+		return "", false
+	}
+	return defaultStorage.GroupMemberClient(group, memberID)
+}
+
 // AddActiveTopicInfo adds general topic information to metrics
 // This is used for metadata and other requests that don't clearly indicate producer/consumer
 func AddActiveTopicInfo(clientIP, topic string) {
 	if defaultStorage != nil {
-		// For metadata requests, we don't know if client is producer or consumer
-		// so we record both to indicate activity
-		defaultStorage.AddProducerTopicRelationInfo(clientIP, topic)
-		defaultStorage.AddConsumerTopicRelationInfo(clientIP, topic)
+		defaultStorage.AddActiveTopicInfo(clientIP, topic)
 	}
 }
 
@@ -60,6 +133,34 @@ func SetDefaultStorage(storage *Storage) {
 	})
 }
 
+// SetAuthUserActivity sets the auth_user_activity series of a user. All writes to the metric go
+// through here so that the label values are always passed in the same order. The username is
+// resolved, with the extra labels of the resolver.
+func SetAuthUserActivity(clientIP, username, mechanism string) {
+	display, labels := userLabelValues(username)
+	AuthUserActivity.WithLabelValues(append([]string{clientIP, display, mechanism}, labels...)...).Set(1)
+}
+
+// SetProducerUserTopic sets the producer_user_topic_info series of a (client, user, topic) triple
+func SetProducerUserTopic(clientIP, username, topic string) {
+	ProducerUserTopicInfo.WithLabelValues(clientIP, displayName(username), topic).Set(1)
+}
+
+// SetConsumerUserTopic sets the consumer_user_topic_info series of a (client, user, topic) triple
+func SetConsumerUserTopic(clientIP, username, topic string) {
+	ConsumerUserTopicInfo.WithLabelValues(clientIP, displayName(username), topic).Set(1)
+}
+
+// SetUserGroup sets the user_group_info series of a (client, user, group) triple
+func SetUserGroup(clientIP, username, group string) {
+	UserGroupInfo.WithLabelValues(clientIP, displayName(username), group).Set(1)
+}
+
+// IncAuthentication counts an authentication of a client, username is empty when only the mechanism is known
+func IncAuthentication(clientIP, mechanism, username string) {
+	AuthenticationInfo.WithLabelValues(clientIP, mechanism, displayName(username)).Inc()
+}
+
 // RecordAuthUser records authenticated user activity
 func RecordAuthUser(clientIP, username, mechanism string) {
 	if username == "" {
@@ -69,7 +170,7 @@ func RecordAuthUser(clientIP, username, mechanism string) {
 	// Recording auth user
 	
 	// Record the authentication in metrics
-	AuthUserActivity.WithLabelValues(clientIP, username, mechanism).Set(1)
+	SetAuthUserActivity(clientIP, username, mechanism)
 	
 	// Save username to clientIP mapping for future use
 	setClientUser(clientIP, username, mechanism)
@@ -84,7 +185,7 @@ func RecordProducerUserTopic(clientIP, topic string) {
 	username := getClientUser(clientIP)
 	if username != "" {
 		// Recording producer topic relation
-		ProducerUserTopicInfo.WithLabelValues(clientIP, username, topic).Set(1)
+		SetProducerUserTopic(clientIP, username, topic)
 	} else {
 		// No username found for client when recording producer topic
 	}
@@ -95,7 +196,7 @@ func RecordConsumerUserTopic(clientIP, topic string) {
 	username := getClientUser(clientIP)
 	if username != "" {
 		// Recording consumer topic relation
-		ConsumerUserTopicInfo.WithLabelValues(clientIP, username, topic).Set(1)
+		SetConsumerUserTopic(clientIP, username, topic)
 	} else {
 		// No username found for client when recording consumer topic
 	}
@@ -111,12 +212,12 @@ func updateTopicRelationshipsWithUsername(clientIP, username string) {
 	// Get any existing topic relationships for this client and update them with username
 	producerTopics := defaultStorage.GetClientProducerTopics(clientIP)
 	for _, topic := range producerTopics {
-		ProducerUserTopicInfo.WithLabelValues(clientIP, username, topic).Set(1)
+		SetProducerUserTopic(clientIP, username, topic)
 	}
 	
 	consumerTopics := defaultStorage.GetClientConsumerTopics(clientIP)
 	for _, topic := range consumerTopics {
-		ConsumerUserTopicInfo.WithLabelValues(clientIP, username, topic).Set(1)
+		SetConsumerUserTopic(clientIP, username, topic)
 	}
 }
 
@@ -162,15 +263,15 @@ func CleanupExpiredUserMappings() {
 
 // TrackSaslAuthentication tracks authentication metrics for SASL connections
 func TrackSaslAuthentication(clientIP, mechanism, username string) {
-	fmt.Printf("DEBUG: TrackSaslAuthentication called for client=%s, mechanism=%s, username=%s\n", 
+	logging.Printf("DEBUG: TrackSaslAuthentication called for client=%s, mechanism=%s, username=%s", 
 		clientIP, mechanism, username)
 	
 	// Track in the authentication metrics
 	if mechanism != "" {
 		// Record authentication info in the metrics
 		// The username field may be empty for the initial SASL handshake
-		AuthenticationInfo.WithLabelValues(clientIP, mechanism, username).Inc()
-		fmt.Println("DEBUG: Recorded authentication info in metrics")
+		IncAuthentication(clientIP, mechanism, username)
+		logging.Println("DEBUG: Recorded authentication info in metrics")
 		
 		// Record authenticated user activity
 		RecordAuthUser(clientIP, username, mechanism)
@@ -179,12 +280,68 @@ func TrackSaslAuthentication(clientIP, mechanism, username string) {
 		if username != "" && defaultStorage != nil {
 			// Track active connection for this client
 			defaultStorage.AddActiveConnectionsTotal(clientIP)
-			fmt.Printf("DEBUG: Added active connection for client %s\n", clientIP)
+			logging.Printf("DEBUG: Added active connection for client %s", clientIP)
 		} else {
-			fmt.Printf("DEBUG: Skip adding active connection - username empty or defaultStorage nil (username empty: %v, defaultStorage nil: %v)\n", 
+			logging.Printf("DEBUG: Skip adding active connection - username empty or defaultStorage nil (username empty: %v, defaultStorage nil: %v)", 
 				username == "", defaultStorage == nil)
 		}
 	} else {
-		fmt.Println("DEBUG: Skipping auth tracking - mechanism is empty")
+		logging.Println("DEBUG: Skipping auth tracking - mechanism is empty")
+	}
+}
+
+// RecordApiKeySeen raises the max_api_key_seen gauge when a higher API key is observed
+func RecordApiKeySeen(key int16) {
+	// Fast path - nearly every request uses a key we've already seen
+	if int32(key) <= atomic.LoadInt32(&maxApiKey) {
+		return
+	}
+
+	maxApiKeyMutex.Lock()
+	defer maxApiKeyMutex.Unlock()
+
+	if int32(key) > maxApiKey {
+		atomic.StoreInt32(&maxApiKey, int32(key))
+		MaxApiKeySeen.Set(float64(key))
+	}
+}
+
+// SetCreatePartitionsInfo records the partition count requested for a topic, replacing
+// the series of the previously requested count so only the latest one is exposed
+func SetCreatePartitionsInfo(topic string, count int32) {
+	newCount := strconv.Itoa(int(count))
+
+	topicPartitionCountsMutex.Lock()
+	defer topicPartitionCountsMutex.Unlock()
+
+	if oldCount, exists := topicPartitionCounts[topic]; exists && oldCount != newCount {
+		CreatePartitionsInfo.DeleteLabelValues(topic, oldCount)
+	}
+	topicPartitionCounts[topic] = newCount
+
+	CreatePartitionsInfo.WithLabelValues(topic, newCount).Set(1)
+}
+
+// SetApplicationPattern sets the regexp used to derive an application name from ClientID.
+// The first capture group is used if present, otherwise the whole match.
+func SetApplicationPattern(pattern *regexp.Regexp) {
+	applicationPattern = pattern
+}
+
+// ApplicationFromClientID derives the application name from a ClientID, returning fallback
+// (usually the client IP) when no pattern is configured or the ClientID doesn't match
+func ApplicationFromClientID(clientID, fallback string) string {
+	if applicationPattern == nil {
+		return fallback
+	}
+
+	match := applicationPattern.FindStringSubmatch(clientID)
+	switch {
+	case match == nil:
+		return fallback
+	case len(match) > 1 && match[1] != "":
+		return match[1]
+	default:
+		return match[0]
 	}
 }
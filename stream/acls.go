@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"github.com/d-ulyanov/kafka-sniffer/events"
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+)
+
+// auditAcls writes an audit log and publishes an event for each ACL created, or each
+// deletion filter sent, by the client. operation is "create" or "delete".
+func (h *KafkaStream) auditAcls(operation string, acls []kafka.AclBinding) {
+	username := h.currentUsername
+	if username == "" {
+		username = h.auth.GetUsernameByIP(h.srcHost)
+	}
+
+	for _, acl := range acls {
+		logging.Audit("acl_change", logging.Fields{
+			"client_ip":       h.srcHost,
+			"username":        username,
+			"operation":       operation,
+			"resource_type":   acl.ResourceType,
+			"resource_name":   acl.ResourceName,
+			"pattern_type":    acl.PatternType,
+			"principal":       acl.Principal,
+			"host":            acl.Host,
+			"acl_operation":   acl.Operation,
+			"permission_type": acl.PermissionType,
+		}, "[AUDIT] Client: %s, User: %s, ACL %s: %s %s:%s (%s), Principal: %s, Host: %s, Operation: %s",
+			h.srcHost, username, operation, acl.PermissionType, acl.ResourceType, acl.ResourceName,
+			acl.PatternType, acl.Principal, acl.Host, acl.Operation)
+
+		h.publish(events.Event{
+			Type:     events.AclChange,
+			Username: username,
+			Details: map[string]string{
+				"operation":       operation,
+				"resource_type":   acl.ResourceType,
+				"resource_name":   acl.ResourceName,
+				"pattern_type":    acl.PatternType,
+				"principal":       acl.Principal,
+				"host":            acl.Host,
+				"acl_operation":   acl.Operation,
+				"permission_type": acl.PermissionType,
+			},
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package stream
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// anonymizedPrefix starts the anonymized client addresses, telling them from real ones
+const anonymizedPrefix = "anon-"
+
+// SetAnonymizeKey replaces client addresses with a keyed hash of them, so that no client IP
+// ends up in metrics, logs or events. The same address always gets the same hash for a given
+// key, keeping the correlation of a client's connections. A nil key keeps the addresses.
+func (h *KafkaStreamFactory) SetAnonymizeKey(key []byte) {
+	h.anonymizeKey = key
+}
+
+// anonymize returns the address as is, or its hash when anonymization is enabled
+func (h *KafkaStreamFactory) anonymize(addr string) string {
+	if h.anonymizeKey == nil {
+		return addr
+	}
+
+	mac := hmac.New(sha256.New, h.anonymizeKey)
+	mac.Write([]byte(addr))
+	// 64 bits are plenty to tell clients apart
+	return anonymizedPrefix + hex.EncodeToString(mac.Sum(nil)[:8])
+}
@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/events"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// recordingSink keeps the published events
+type recordingSink struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (s *recordingSink) Publish(e events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+// sendStream feeds data to a new stream of the connection from clientIP:clientPort to the
+// broker port 9092 of 10.0.0.100, and waits until it is decoded
+func sendStream(f *KafkaStreamFactory, clientIP string, clientPort uint16, data []byte) {
+	netFlow := gopacket.NewFlow(layers.EndpointIPv4, net.ParseIP(clientIP).To4(), net.ParseIP("10.0.0.100").To4())
+	src, dst := layers.NewTCPPortEndpoint(layers.TCPPort(clientPort)), layers.NewTCPPortEndpoint(9092)
+	transport, _ := gopacket.FlowFromEndpoints(src, dst)
+
+	s := f.New(netFlow, transport)
+	s.Reassembled([]tcpassembly.Reassembly{{Bytes: data, Seen: time.Now()}})
+	s.ReassemblyComplete()
+	f.Wait()
+}
+
+func TestAnonymizedClientAddresses(t *testing.T) {
+	f := newTestFactory()
+	f.SetAnonymizeKey([]byte("secret"))
+	sink := &recordingSink{}
+	f.SetEventSink(sink)
+
+	sendStream(f, "192.168.1.10", 50000, produceRequest("orders"))
+	sendStream(f, "192.168.1.10", 50001, produceRequest("orders"))
+	sendStream(f, "192.168.1.11", 50000, produceRequest("orders"))
+
+	if len(sink.events) != 3 {
+		t.Fatalf("got %d events, want a produce relation per connection", len(sink.events))
+	}
+	first, second, other := sink.events[0].ClientIP, sink.events[1].ClientIP, sink.events[2].ClientIP
+	for _, ip := range []string{first, second, other} {
+		if !strings.HasPrefix(ip, anonymizedPrefix) {
+			t.Errorf("client ip %q isn't anonymized", ip)
+		}
+	}
+	if first != second {
+		t.Errorf("the connections of one client got the hashes %q and %q", first, second)
+	}
+	if first == other {
+		t.Errorf("two clients got the same hash %q", first)
+	}
+}
+
+func TestAnonymizeKey(t *testing.T) {
+	f := newTestFactory()
+	if addr := f.anonymize("192.168.1.10"); addr != "192.168.1.10" {
+		t.Errorf("address without a key is %q, want it unchanged", addr)
+	}
+
+	f.SetAnonymizeKey([]byte("secret"))
+	hashed := f.anonymize("192.168.1.10")
+	f.SetAnonymizeKey([]byte("other"))
+	if rekeyed := f.anonymize("192.168.1.10"); rekeyed == hashed {
+		t.Errorf("two keys give the same hash %q", hashed)
+	}
+}
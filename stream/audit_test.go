@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+)
+
+// captureAudits reads data in JSON log format and returns the logged events of the given type
+func captureAudits(t *testing.T, data []byte, event string) []map[string]interface{} {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	if err := logging.SetFormat(logging.FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = logging.SetFormat(logging.FormatText)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	f, _ := newAuthenticatedFactory("admin")
+	readRequests(f, data)
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", scanner.Text(), err)
+		}
+		if obj["event"] == event {
+			events = append(events, obj)
+		}
+	}
+	return events
+}
+
+func TestCreatePartitionsAudit(t *testing.T) {
+	// CreatePartitions v1 growing orders to 6 partitions, without assignment, validate only
+	data := frame(37, 1, int32s(1), str("orders"), int32s(6), int32s(-1), int32s(30000), []byte{1})
+
+	audits := captureAudits(t, data, "create_partitions")
+	if len(audits) != 1 {
+		t.Fatalf("got %d create_partitions events, want 1", len(audits))
+	}
+	audit := audits[0]
+	if audit["client_ip"] != "10.0.0.1" || audit["username"] != "admin" || audit["topic"] != "orders" ||
+		audit["count"] != float64(6) || audit["validate_only"] != true {
+		t.Errorf("got %v, want admin growing orders to 6 partitions, validate only", audit)
+	}
+}
+
+// flexibleFrame encodes a request of a flexible version, whose header ends with empty tagged fields
+func flexibleFrame(key, version int16, body ...[]byte) []byte {
+	payload := cat(int16s(key), int16s(version), int32s(7), str("test"), []byte{0})
+	payload = append(payload, cat(body...)...)
+	return cat(int32s(int32(len(payload))), payload)
+}
+
+// compactStr encodes a compact string shorter than 127 bytes
+func compactStr(s string) []byte {
+	return append([]byte{byte(len(s) + 1)}, s...)
+}
+
+func TestAlterScramCredentialsAudit(t *testing.T) {
+	// AlterUserScramCredentials deleting the SCRAM-SHA-256 credential of bob and upserting the
+	// SCRAM-SHA-512 one of alice with 8192 iterations
+	data := flexibleFrame(51, 0,
+		[]byte{2}, compactStr("bob"), []byte{1}, []byte{0},
+		[]byte{2}, compactStr("alice"), []byte{2}, int32s(8192), compactStr("salt"), compactStr("salted"), []byte{0},
+		[]byte{0})
+
+	audits := captureAudits(t, data, "alter_scram_credentials")
+	if len(audits) != 2 {
+		t.Fatalf("got %d alter_scram_credentials events, want 2", len(audits))
+	}
+	if deletion := audits[0]; deletion["operation"] != "delete" || deletion["user"] != "bob" ||
+		deletion["mechanism"] != "SCRAM-SHA-256" || deletion["username"] != "admin" {
+		t.Errorf("got %v, want admin deleting the SCRAM-SHA-256 credential of bob", deletion)
+	}
+	if upsertion := audits[1]; upsertion["operation"] != "upsert" || upsertion["user"] != "alice" ||
+		upsertion["mechanism"] != "SCRAM-SHA-512" || upsertion["iterations"] != float64(8192) {
+		t.Errorf("got %v, want the SCRAM-SHA-512 credential of alice upserted with 8192 iterations", upsertion)
+	}
+	for _, audit := range audits {
+		for _, secret := range []string{"salt", "salted", "salted_password"} {
+			if _, ok := audit[secret]; ok {
+				t.Errorf("got %v, the salt and salted password must not be logged", audit)
+			}
+		}
+	}
+}
+
+func TestDescribeScramCredentialsAudit(t *testing.T) {
+	// DescribeUserScramCredentials of all users, then of alice
+	data := cat(flexibleFrame(50, 0, []byte{0}, []byte{0}),
+		flexibleFrame(50, 0, []byte{2}, compactStr("alice"), []byte{0}, []byte{0}))
+
+	audits := captureAudits(t, data, "describe_scram_credentials")
+	if len(audits) != 2 {
+		t.Fatalf("got %d describe_scram_credentials events, want 2", len(audits))
+	}
+	if audits[0]["all_users"] != true {
+		t.Errorf("got %v, want all users described", audits[0])
+	}
+	if users, ok := audits[1]["users"].([]interface{}); audits[1]["all_users"] != false || !ok || len(users) != 1 || users[0] != "alice" {
+		t.Errorf("got %v, want alice described", audits[1])
+	}
+}
+
+func TestDeleteTopicsAudit(t *testing.T) {
+	// DeleteTopics v1 of orders and payments
+	data := frame(20, 1, int32s(2), str("orders"), str("payments"), int32s(30000))
+
+	audits := captureAudits(t, data, "topic_delete")
+	if len(audits) != 2 {
+		t.Fatalf("got %d topic_delete events, want 2", len(audits))
+	}
+	for i, topic := range []string{"orders", "payments"} {
+		if audits[i]["topic"] != topic || audits[i]["username"] != "admin" || audits[i]["client_ip"] != "10.0.0.1" {
+			t.Errorf("got %v, want admin deleting %s", audits[i], topic)
+		}
+	}
+}
+
+func TestAlterReplicaLogDirsAudit(t *testing.T) {
+	// AlterReplicaLogDirs v1 moving partition 3 of orders to /data/disk2
+	data := frame(34, 1, int32s(1), str("/data/disk2"), int32s(1), str("orders"), int32s(1), int32s(3))
+
+	audits := captureAudits(t, data, "alter_replica_log_dirs")
+	if len(audits) != 1 {
+		t.Fatalf("got %d alter_replica_log_dirs events, want 1", len(audits))
+	}
+	partitions, ok := audits[0]["partitions"].([]interface{})
+	if audits[0]["topic"] != "orders" || audits[0]["log_dir"] != "/data/disk2" || !ok || len(partitions) != 1 || partitions[0] != float64(3) {
+		t.Errorf("got %v, want partition 3 of orders moved to /data/disk2", audits[0])
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 	
 	"github.com/d-ulyanov/kafka-sniffer/kafka"
-	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
 // tryExtractAuthData attempts to extract authentication information from
@@ -41,7 +40,7 @@ func (h *KafkaStream) tryExtractAuthData(buf *bufio.Reader, clientIP, mechanism
 	} else if strings.HasPrefix(strings.ToUpper(mechanism), "SCRAM-") {
 		// SCRAM mechanism - look for n=username
 		username = extractScramUsername(rawData)
-	} else {
+	} else if !kafka.StrictSasl {
 		// Try generic approaches
 		username = extractGenericUsername(rawData)
 	}
@@ -52,9 +51,9 @@ func (h *KafkaStream) tryExtractAuthData(buf *bufio.Reader, clientIP, mechanism
 			username, clientIP)
 		
 		// Store the username in our tracking system
-		if kafka.UpdateAuthSession(clientIP, username) {
+		if h.auth.UpdateSession(clientIP, username) {
 			// Now also update the metrics
-			metrics.TrackSaslAuthentication(clientIP, mechanism, username)
+			h.metricsStorage.TrackSaslAuthentication(clientIP, mechanism, username)
 		}
 	}
 }
@@ -85,32 +84,18 @@ func extractPlainUsername(data []byte) string {
 	return ""
 }
 
-// extractScramUsername attempts to extract a username from SCRAM auth data
+// extractScramUsername attempts to extract a username from SCRAM auth data. The raw data may
+// start with a length prefix, the client-first-message is looked for at each offset.
 func extractScramUsername(data []byte) string {
-	// Look for n=username in the data
-	usernamePrefix := []byte("n=")
-	idx := bytes.Index(data, usernamePrefix)
-	
-	if idx >= 0 && idx+2 < len(data) {
-		// Found username prefix, find the end (comma or other separator)
-		start := idx + 2
-		end := -1
-		
-		for i := start; i < len(data); i++ {
-			if data[i] == ',' || data[i] == 0 {
-				end = i
-				break
-			}
-		}
-		
-		if end > start {
-			username := string(data[start:end])
-			if isValidUsername(username) {
-				return username
+	for i := range data {
+		switch data[i] {
+		case 'n', 'y', 'p':
+			if first, ok := kafka.ParseScramClientFirst(data[i:]); ok && isValidUsername(first.Username) {
+				return first.Username
 			}
 		}
 	}
-	
+
 	return ""
 }
 
@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/events"
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// authFailureWindow is how soon after its SaslHandshake a connection without further requests
+// must close to be suspected of a failed authentication. Brokers close the connection right
+// after a failed SaslAuthenticate.
+const authFailureWindow = 10 * time.Second
+
+// authFlowStep is a single step of the SASL flow of a connection
+type authFlowStep struct {
+	at     time.Time
+	name   string
+	detail string
+}
+
+// authFlow keeps the sequence ApiVersions -> SaslHandshake -> SaslAuthenticate -> first Produce/Fetch
+// for one connection, so that auth problems can be diagnosed from a single log line.
+type authFlow struct {
+	steps         []authFlowStep
+	handshake     bool
+	handshakeAt   time.Time
+	mechanism     string
+	authenticated bool
+	// used is set by the first request following the SASL exchange, which needs a successful
+	// authentication
+	used bool
+	done bool
+}
+
+// record appends a step seen at the given time to the flow. Steps are ignored once the summary has been emitted.
+func (f *authFlow) record(at time.Time, name, detail string) {
+	if f.done {
+		return
+	}
+	f.steps = append(f.steps, authFlowStep{at: at, name: name, detail: detail})
+}
+
+// String formats the flow as "Step(detail)@time -> Step@time"
+func (f *authFlow) String() string {
+	parts := make([]string, 0, len(f.steps))
+	for _, step := range f.steps {
+		name := step.name
+		if step.detail != "" {
+			name = fmt.Sprintf("%s(%s)", step.name, step.detail)
+		}
+		parts = append(parts, fmt.Sprintf("%s@%s", name, step.at.Format("15:04:05.000")))
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// observeAuthFlow updates the SASL flow of the stream with a decoded request and
+// emits the summary once the first data request after authentication is seen
+func (h *KafkaStream) observeAuthFlow(req *kafka.Request) {
+	f := &h.authFlow
+	if f.done {
+		return
+	}
+
+	switch body := req.Body.(type) {
+	case *kafka.ApiVersionsRequest:
+		if !f.handshake {
+			f.record(h.packetTime(), "ApiVersions", fmt.Sprintf("v%d", req.Version))
+		}
+	case *kafka.SaslHandshakeRequest:
+		f.handshake = true
+		f.handshakeAt = h.packetTime()
+		f.mechanism = body.Mechanism
+		f.record(f.handshakeAt, "SaslHandshake", body.Mechanism)
+	case *kafka.SaslAuthenticateRequest:
+		if !f.handshake {
+			return
+		}
+		f.record(h.packetTime(), "SaslAuthenticate", body.Username)
+		if body.Username != "" {
+			f.authenticated = true
+		}
+	case *kafka.ProduceRequest, *kafka.FetchRequest:
+		if !f.handshake {
+			return
+		}
+		f.used = true
+		f.record(h.packetTime(), kafka.ApiName(req.Key), "")
+		h.emitAuthFlow()
+	default:
+		if f.handshake {
+			f.used = true
+		}
+	}
+}
+
+// checkAuthFailure reports a connection closed soon after its SaslHandshake without any
+// request following the SASL exchange, which looks like a failed authentication. It is a
+// guess: the responses of the broker aren't decoded, and a client may as well give up.
+func (h *KafkaStream) checkAuthFailure() {
+	f := &h.authFlow
+	if !f.handshake || f.used || f.done {
+		return
+	}
+	elapsed := h.packetTime().Sub(f.handshakeAt)
+	if elapsed > authFailureWindow {
+		return
+	}
+
+	metrics.AuthFailureSuspectedTotal.WithLabelValues(h.srcHost, f.mechanism).Inc()
+	log.Printf("[SECURITY] Client: %s:%s, User: %s, Mechanism: %s, suspected authentication failure: connection closed %s after the SASL handshake without further requests",
+		h.srcHost, h.srcPort, h.currentUsername, f.mechanism, elapsed.Round(time.Millisecond))
+}
+
+// checkAuthenticated reports data-plane requests sent on a SASL listener before any
+// SaslAuthenticate was seen on the connection: either the capture missed the start of
+// the connection or the listener doesn't enforce authentication.
+func (h *KafkaStream) checkAuthenticated(req *kafka.Request) {
+	switch req.Body.(type) {
+	case *kafka.SaslAuthenticateRequest:
+		h.authSeen = true
+	case *kafka.ProduceRequest, *kafka.FetchRequest:
+		if !h.saslListener || h.authSeen {
+			return
+		}
+
+		metrics.UnauthenticatedDataTotal.WithLabelValues(h.srcHost).Inc()
+		if h.unauthWarned {
+			return
+		}
+		h.unauthWarned = true
+
+		log.Printf("[SECURITY] Client: %s:%s sent %s to SASL listener %s:%s without authenticating",
+			h.srcHost, h.srcPort, kafka.ApiName(req.Key), h.dstHost, h.dstPort)
+		h.publish(events.Event{
+			Type:    events.AuthAnomaly,
+			Details: map[string]string{"reason": "data request without authentication", "listener": h.dstHost + ":" + h.dstPort},
+		})
+	}
+}
+
+// observeRawAuth records a username extracted from a raw SASL token
+func (h *KafkaStream) observeRawAuth(username string) {
+	h.authSeen = true
+	if h.authFlow.done || !h.authFlow.handshake {
+		return
+	}
+	h.authFlow.record(h.packetTime(), "SaslAuthenticate", username)
+	h.authFlow.authenticated = true
+}
+
+// emitAuthFlow logs the SASL flow summary of the connection once
+func (h *KafkaStream) emitAuthFlow() {
+	f := &h.authFlow
+	if f.done || !f.handshake {
+		return
+	}
+	f.done = true
+
+	status := "authenticated"
+	if !f.authenticated {
+		status = "incomplete"
+		h.publish(events.Event{
+			Type:      events.AuthAnomaly,
+			Mechanism: h.currentMechanism,
+			Details:   map[string]string{"reason": "sasl handshake without authenticated user", "flow": f.String()},
+		})
+	}
+
+	log.Printf("[SASL FLOW] Client: %s:%s, Status: %s, User: %s, Flow: %s",
+		h.srcHost, h.srcPort, status, h.currentUsername, f)
+}
@@ -1,12 +1,39 @@
 package stream
 
 import (
+	"encoding/binary"
 	"fmt"
 	"log"
 	
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 )
 
+// maxPlausibleApiVersion bounds the request versions taken for real, no API has reached it yet
+const maxPlausibleApiVersion = 20
+
+// maxPlausibleApiKey bounds the api keys taken for real. Unknown keys below it may be APIs newer
+// than the sniffer, keys above it come from misframed streams.
+const maxPlausibleApiKey = 255
+
+// plausibleApiKey reports whether a request header may come from a real client, possibly of a
+// newer protocol version than the sniffer knows
+func plausibleApiKey(key, version int16) bool {
+	return key >= 0 && key <= maxPlausibleApiKey && version >= 0 && version <= maxPlausibleApiVersion
+}
+
+// looksLikeRequestHeader reports whether a frame starts with a plausible request header: a
+// known api key followed by a version. Raw PLAIN tokens start with a null byte too, but their
+// "version" is made of username characters, way above any real version.
+func looksLikeRequestHeader(frame []byte) bool {
+	if len(frame) < 4 {
+		return false
+	}
+	key := int16(binary.BigEndian.Uint16(frame[:2]))
+	version := int16(binary.BigEndian.Uint16(frame[2:4]))
+	return kafka.KnownApiKey(key) && version >= 0 && version <= maxPlausibleApiVersion
+}
+
 // extractSaslPlainUsername attempts to extract the username from a raw SASL PLAIN token
 // SASL PLAIN format is: [null-byte][username][null-byte][password]
 func extractSaslPlainUsername(data []byte) (string, bool) {
@@ -32,7 +59,7 @@ func extractSaslPlainUsername(data []byte) (string, bool) {
 	}
 	
 	if passwordStart > 1 && passwordStart < len(data) {
-		username := string(data[usernameStart:passwordStart-1])
+		username := kafka.BoundString("username", string(data[usernameStart:passwordStart-1]))
 		return username, true
 	}
 	
@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+)
+
+const (
+	// detectionRequests is the number of consecutive requests a stream must start with for its
+	// destination port to be taken for a broker port
+	detectionRequests = 2
+
+	// maxPlausibleVersion is above the latest version of every api, higher versions are
+	// taken for another protocol
+	maxPlausibleVersion = 20
+)
+
+// brokerPortDetector collects the broker ports detected at runtime, up to max ports
+type brokerPortDetector struct {
+	max   int
+	mu    sync.RWMutex
+	ports map[string]bool
+}
+
+// SetDetectBrokerPorts detects broker ports missing from SetBrokerPorts: a stream to another
+// port is only decoded once it starts with two valid Kafka requests, its port then being
+// added to the broker ports. Up to max ports are detected, later streams to other ports are
+// ignored. 0 disables the detection, streams to other ports are then decoded as is.
+func (h *KafkaStreamFactory) SetDetectBrokerPorts(max int) {
+	h.detector = nil
+	if max > 0 {
+		h.detector = &brokerPortDetector{max: max, ports: make(map[string]bool)}
+	}
+}
+
+// isBrokerPort reports whether the port was set or detected as a broker port
+func (h *KafkaStreamFactory) isBrokerPort(port string) bool {
+	return h.brokerPorts[port] || h.detector != nil && h.detector.has(port)
+}
+
+// has reports whether the port was detected
+func (d *brokerPortDetector) has(port string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.ports[port]
+}
+
+// full reports whether no more port can be detected
+func (d *brokerPortDetector) full() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.ports) >= d.max
+}
+
+// add adds a detected port, it returns false when the port was already detected or no more
+// port can be
+func (d *brokerPortDetector) add(port string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ports[port] || len(d.ports) >= d.max {
+		return false
+	}
+	d.ports[port] = true
+	return true
+}
+
+// detectBrokerPort checks whether the stream starts with Kafka requests, adding its destination
+// port to the detected ones. The requests are peeked, r still returns them afterwards.
+func (h *KafkaStream) detectBrokerPort(r *bufio.Reader) bool {
+	if !startsWithRequests(r, detectionRequests) {
+		return false
+	}
+
+	if h.detector.add(h.dstPort) {
+		logging.Event("broker_port_detected", logging.Fields{
+			"broker_ip":   h.dstHost,
+			"broker_port": h.dstPort,
+			"client_ip":   h.srcHost,
+		}, "detected Kafka broker port %s from %s:%s -> %s:%s", h.dstPort, h.srcHost, h.srcPort, h.dstHost, h.dstPort)
+	}
+	// the stream is decoded even if the set got full meanwhile
+	return true
+}
+
+// startsWithRequests reports whether the first frames of r are n plausible Kafka requests.
+// The frames must fit in the buffer of r together, they aren't consumed.
+func startsWithRequests(r *bufio.Reader, n int) bool {
+	off := 0
+	for i := 0; i < n; i++ {
+		head, err := r.Peek(off + 4)
+		if err != nil {
+			return false
+		}
+		size := int(int32(binary.BigEndian.Uint32(head[off:])))
+		if size <= 0 || off+4+size > r.Size() {
+			return false
+		}
+		frame, err := r.Peek(off + 4 + size)
+		if err != nil {
+			return false
+		}
+
+		req, _, err := kafka.DecodeRequest(bytes.NewReader(frame[off:]))
+		if err != nil || !kafka.KnownApiKey(req.Key) || req.Version < 0 || req.Version > maxPlausibleVersion {
+			return false
+		}
+		off += 4 + size
+	}
+	return true
+}
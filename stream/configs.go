@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"strings"
+
+	"github.com/d-ulyanov/kafka-sniffer/events"
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+)
+
+// auditConfigChanges writes an audit log and publishes an event for each resource whose configs
+// are altered by an AlterConfigs or IncrementalAlterConfigs request. Config values are only
+// logged with kafka.CaptureConfigValues.
+func (h *KafkaStream) auditConfigChanges(api string, validateOnly bool, resources []kafka.AlterConfigsResource) {
+	username := h.currentUsername
+	if username == "" {
+		username = h.auth.GetUsernameByIP(h.srcHost)
+	}
+
+	for _, resource := range resources {
+		resourceType := kafka.ConfigResourceTypeName(resource.ResourceType)
+
+		changes := make([]string, 0, len(resource.Configs))
+		names := make([]string, 0, len(resource.Configs))
+		for _, config := range resource.Configs {
+			names = append(names, config.Name)
+			change := config.Operation + " " + config.Name
+			if kafka.CaptureConfigValues && config.Operation != "DELETE" {
+				change += "=" + config.Value
+			}
+			changes = append(changes, change)
+		}
+
+		logging.Audit("config_change", logging.Fields{
+			"client_ip":     h.srcHost,
+			"username":      username,
+			"api":           api,
+			"resource_type": resourceType,
+			"resource_name": resource.ResourceName,
+			"configs":       changes,
+			"validate_only": validateOnly,
+		}, "[AUDIT] Client: %s, User: %s, %s %s: %s, Changes: %s, Validate only: %t",
+			h.srcHost, username, api, resourceType, resource.ResourceName, strings.Join(changes, ", "), validateOnly)
+
+		if validateOnly {
+			continue
+		}
+		h.publish(events.Event{
+			Type:     events.ConfigChange,
+			Username: username,
+			Details: map[string]string{
+				"api":           api,
+				"resource_type": resourceType,
+				"resource_name": resource.ResourceName,
+				"configs":       strings.Join(names, ","),
+			},
+		})
+	}
+}
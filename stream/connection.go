@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"io"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countingReader counts the bytes read from a stream
+type countingReader struct {
+	r       io.Reader
+	n       int64
+	counter prometheus.Counter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		c.counter.Add(float64(n))
+	}
+	return n, err
+}
+
+// connectionStats are the figures of the connection closed log
+type connectionStats struct {
+	opened   time.Time
+	reader   *countingReader
+	requests int
+}
+
+// logConnectionClosed logs the duration, bytes and requests of the connection, when the
+// stream stops being read
+func (h *KafkaStream) logConnectionClosed(stats *connectionStats) {
+	username := h.currentUsername
+	if username == "" {
+		username = h.auth.GetUsernameByIP(h.srcHost)
+	}
+	// capture times, so that replays log the duration of the original connection
+	duration := h.packetTime().Sub(stats.opened)
+
+	logging.Event("connection_close", logging.Fields{
+		"client_ip":   h.srcHost,
+		"src_port":    h.srcPort,
+		"broker_ip":   h.dstHost,
+		"broker_port": h.dstPort,
+		"username":    username,
+		"duration":    duration.Seconds(),
+		"bytes":       stats.reader.n,
+		"requests":    stats.requests,
+	}, "%s:%s -> %s:%s closed after %s, %d bytes, %d requests, User: %s",
+		h.srcHost, h.srcPort, h.dstHost, h.dstPort, duration.Round(time.Millisecond), stats.reader.n, stats.requests, username)
+}
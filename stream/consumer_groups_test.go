@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func int64s(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// newIsolatedFactory returns a factory with its own storage and auth tracker
+func newIsolatedFactory() (*KafkaStreamFactory, *metrics.Storage) {
+	storage := metrics.NewStorage(prometheus.NewRegistry(), 0)
+	f := NewKafkaStreamFactory(storage, false)
+	f.SetAuthTracker(kafka.NewAuthTracker())
+	return f, storage
+}
+
+// newAuthenticatedFactory returns an isolated factory, whose client 10.0.0.1 authenticated as
+// username
+func newAuthenticatedFactory(username string) (*KafkaStreamFactory, *metrics.Storage) {
+	f, storage := newIsolatedFactory()
+	f.auth.StoreHandshake("10.0.0.1", "PLAIN")
+	f.auth.UpdateSession("10.0.0.1", username)
+	return f, storage
+}
+
+// offsetCommitRequest is an OffsetCommit v2 request of offset 42 of partition 0 of a topic
+func offsetCommitRequest(group, topic string) []byte {
+	return frame(8, 2, str(group), int32s(1), str("member-1"), int64s(-1),
+		int32s(1), str(topic), int32s(1), int32s(0), int64s(42), int16s(-1))
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOffsetCommitUsesFactoryStorage(t *testing.T) {
+	f, storage := newAuthenticatedFactory("commit-user")
+	readRequests(f, offsetCommitRequest("commit-group", "commit-topic"))
+
+	if topics := storage.GetClientConsumerTopics("10.0.0.1"); !contains(topics, "commit-topic") {
+		t.Errorf("consumer topics are %v, want commit-topic", topics)
+	}
+	if groups := storage.GetClientGroups("10.0.0.1"); !contains(groups, "commit-group") {
+		t.Errorf("client groups are %v, want commit-group", groups)
+	}
+	userTopic := metrics.ConsumerUserTopicInfo.WithLabelValues("10.0.0.1", "commit-user", "commit-topic")
+	if v := testutil.ToFloat64(userTopic); v != 1 {
+		t.Errorf("consumer user topic series is %v, want 1", v)
+	}
+}
+
+// offsetFetchRequest is an OffsetFetch v1 request of partition 0 of a topic
+func offsetFetchRequest(group, topic string) []byte {
+	return frame(9, 1, str(group), int32s(1), str(topic), int32s(1), int32s(0))
+}
+
+func TestOffsetFetchUsesFactoryStorage(t *testing.T) {
+	f, storage := newAuthenticatedFactory("fetch-user")
+	readRequests(f, offsetFetchRequest("fetch-group", "fetch-topic"))
+
+	if topics := storage.GetClientConsumerTopics("10.0.0.1"); !contains(topics, "fetch-topic") {
+		t.Errorf("consumer topics are %v, want fetch-topic", topics)
+	}
+	if groups := storage.GetClientGroups("10.0.0.1"); !contains(groups, "fetch-group") {
+		t.Errorf("client groups are %v, want fetch-group", groups)
+	}
+	userTopic := metrics.ConsumerUserTopicInfo.WithLabelValues("10.0.0.1", "fetch-user", "fetch-topic")
+	if v := testutil.ToFloat64(userTopic); v != 1 {
+		t.Errorf("consumer user topic series is %v, want 1", v)
+	}
+}
+
+// syncGroupRequest is a SyncGroup v0 request of a member, assigning partition 0 of topics to
+// other members
+func syncGroupRequest(group, memberID string, assignments map[string]string) []byte {
+	body := cat(str(group), int32s(1), str(memberID), int32s(int32(len(assignments))))
+	for member, topic := range assignments {
+		assignment := cat(int16s(0), int32s(1), str(topic), int32s(1), int32s(0), int32s(-1))
+		body = cat(body, str(member), int32s(int32(len(assignment))), assignment)
+	}
+	return frame(14, 0, body)
+}
+
+func TestSyncGroupUsesFactoryStorage(t *testing.T) {
+	f, storage := newAuthenticatedFactory("sync-user")
+
+	// The member syncs with the group, then the leader assigns it a topic
+	f.ReadStream(bytes.NewReader(syncGroupRequest("sync-group", "member-2", nil)), "10.0.0.2")
+	f.ReadStream(bytes.NewReader(syncGroupRequest("sync-group", "member-1",
+		map[string]string{"member-2": "sync-topic"})), "10.0.0.1")
+
+	if client, ok := storage.GroupMemberClient("sync-group", "member-2"); !ok || client != "10.0.0.2" {
+		t.Fatalf("client of member-2 is %q, want 10.0.0.2", client)
+	}
+	if topics := storage.GetClientConsumerTopics("10.0.0.2"); !contains(topics, "sync-topic") {
+		t.Errorf("consumer topics of the member are %v, want sync-topic", topics)
+	}
+	if topics := storage.GetClientConsumerTopics("10.0.0.1"); contains(topics, "sync-topic") {
+		t.Errorf("consumer topics of the leader are %v, the topic is assigned to the member", topics)
+	}
+	if groups := storage.GetClientGroups("10.0.0.2"); !contains(groups, "sync-group") {
+		t.Errorf("client groups of the member are %v, want sync-group", groups)
+	}
+}
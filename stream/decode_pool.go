@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// DefaultDecodeQueueBytes is the default number of bytes queued for each stream decoded by
+// the worker pool
+const DefaultDecodeQueueBytes = 1024 * 1024
+
+// errDecodeQueueFull stops the decoding of a stream whose queue overflowed
+var errDecodeQueueFull = errors.New("decode queue full")
+
+// streamReader is the reader of the reassembled data of a stream
+type streamReader interface {
+	io.Reader
+	Reassembled([]tcpassembly.Reassembly)
+	ReassemblyComplete()
+}
+
+// decodePool bounds the number of streams decoding requests at once
+type decodePool struct {
+	workers    chan struct{}
+	queueBytes int
+}
+
+// SetDecodeWorkers bounds the number of connections decoding requests at once, capping the
+// CPU used under connection storms. Each connection keeps its goroutine, which waits for a
+// worker once a request was queued. The reassembled data of a connection is queued up to
+// queueBytes without blocking the capture, a connection whose queue overflows is no longer
+// decoded. 0 workers decodes every connection as soon as its data arrives.
+func (h *KafkaStreamFactory) SetDecodeWorkers(workers, queueBytes int) error {
+	if workers < 0 {
+		return fmt.Errorf("decode workers must not be negative, got %d", workers)
+	}
+	if workers == 0 {
+		h.pool = nil
+		return nil
+	}
+	if queueBytes < MinBufferSize {
+		return fmt.Errorf("decode queue must be at least %d bytes, got %d", MinBufferSize, queueBytes)
+	}
+	h.pool = &decodePool{workers: make(chan struct{}, workers), queueBytes: queueBytes}
+	return nil
+}
+
+// acquire waits for a free worker
+func (p *decodePool) acquire() {
+	metrics.DecodeQueueDepth.Inc()
+	p.workers <- struct{}{}
+	metrics.DecodeQueueDepth.Dec()
+}
+
+// release frees a worker
+func (p *decodePool) release() {
+	<-p.workers
+}
+
+// acquireWorker waits for the next request to be queued, then for a worker to decode it, so
+// that a slow client doesn't hold a worker while its request trickles in. Requests over half
+// the queue can't be waited for, they're decoded as they arrive.
+func (h *KafkaStream) acquireWorker(buf *bufio.Reader) {
+	if h.pool == nil {
+		return
+	}
+
+	if header, err := buf.Peek(4); err == nil {
+		size := int(kafka.DecodeLength(header)) + 4 - buf.Buffered()
+		if size > 0 && size <= h.pool.queueBytes/2 {
+			h.queue.waitFor(size)
+		}
+	}
+
+	h.pool.acquire()
+	h.holdingWorker = true
+}
+
+// releaseWorker frees the worker of the stream, if it holds one
+func (h *KafkaStream) releaseWorker() {
+	if h.holdingWorker {
+		h.holdingWorker = false
+		h.pool.release()
+	}
+}
+
+// queuedReader queues the reassembled data of a stream until it's read, never blocking the
+// assembler. Once the queue is full, the data is dropped and a read fails.
+type queuedReader struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	data         []byte
+	limit        int
+	complete     bool
+	overflow     bool
+	overflowRead bool   // the overflow was returned by Read
+	stream       string // the connection, for the overflow log
+}
+
+func newQueuedReader(limit int, stream string) *queuedReader {
+	q := &queuedReader{limit: limit, stream: stream}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Reassembled implements tcpassembly.Stream
+func (q *queuedReader) Reassembled(reassembly []tcpassembly.Reassembly) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.complete || q.overflow {
+		return
+	}
+
+	for _, r := range reassembly {
+		if len(q.data)+len(r.Bytes) > q.limit {
+			logging.Printf("stop decoding stream %s: %v, over %d bytes", q.stream, errDecodeQueueFull, q.limit)
+			q.overflow = true
+			q.data = nil
+			break
+		}
+		q.data = append(q.data, r.Bytes...)
+	}
+	q.cond.Broadcast()
+}
+
+// ReassemblyComplete implements tcpassembly.Stream
+func (q *queuedReader) ReassemblyComplete() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.complete = true
+	q.cond.Broadcast()
+}
+
+// Read reads the queued data, waiting for some to be reassembled. It returns io.EOF once the
+// stream is complete and read. An overflow is returned once, the stream then looks empty
+// until it's complete.
+func (q *queuedReader) Read(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.data) == 0 && !q.complete && (!q.overflow || q.overflowRead) {
+		q.cond.Wait()
+	}
+
+	if q.overflow && !q.overflowRead {
+		q.overflowRead = true
+		return 0, errDecodeQueueFull
+	}
+	if len(q.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, q.data)
+	q.data = q.data[n:]
+	if len(q.data) == 0 {
+		// release the array, the next data gets a new one sized after it
+		q.data = nil
+	}
+	return n, nil
+}
+
+// waitFor waits until n bytes are queued, or the stream ends
+func (q *queuedReader) waitFor(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.data) < n && !q.complete && !q.overflow {
+		q.cond.Wait()
+	}
+}
@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+const (
+	// duplicateWindow is how long a correlation id isn't expected to be used again on a
+	// connection. Clients increment it with each request, only a buggy retry reuses it.
+	duplicateWindow = time.Minute
+
+	// recentCorrelationIDs is the number of last correlation ids of a connection checked for
+	// duplicates
+	recentCorrelationIDs = 128
+)
+
+// sentRequest is a request recently sent on a connection
+type sentRequest struct {
+	correlationID int32
+	key           int16
+	at            time.Time
+}
+
+// recentRequests are the last requests of a connection, in a ring buffer
+type recentRequests struct {
+	requests [recentCorrelationIDs]sentRequest
+	next     int
+	count    int
+}
+
+// add records a request, returning the previous one with the same correlation id within the
+// window, if any
+func (r *recentRequests) add(req sentRequest) (sentRequest, bool) {
+	var previous sentRequest
+	var found bool
+	for i := 0; i < r.count; i++ {
+		sent := r.requests[i]
+		if sent.correlationID == req.correlationID && req.at.Sub(sent.at) < duplicateWindow {
+			// the latest one, in case of several
+			if !found || sent.at.After(previous.at) {
+				previous, found = sent, true
+			}
+		}
+	}
+
+	r.requests[r.next] = req
+	r.next = (r.next + 1) % len(r.requests)
+	if r.count < len(r.requests) {
+		r.count++
+	}
+	return previous, found
+}
+
+// checkDuplicate reports a request reusing the correlation id of a recent request of the stream
+func (h *KafkaStream) checkDuplicate(req *kafka.Request) {
+	if h.sent == nil {
+		// only allocated by request streams, about 4KiB
+		h.sent = &recentRequests{}
+	}
+	at := h.packetTime()
+	previous, ok := h.sent.add(sentRequest{correlationID: req.CorrelationID, key: req.Key, at: at})
+	if !ok {
+		return
+	}
+
+	metrics.DuplicateCorrelationTotal.WithLabelValues(h.srcHost).Inc()
+	logging.Event("duplicate_correlation_id", logging.Fields{
+		"client_ip":      h.srcHost,
+		"src_port":       h.srcPort,
+		"correlation_id": req.CorrelationID,
+		"api":            kafka.ApiName(req.Key),
+		"version":        req.Version,
+		"previous_api":   kafka.ApiName(previous.key),
+	}, "client %s:%s reused correlation id %d for %s v%d, sent with %s %s before",
+		h.srcHost, h.srcPort, req.CorrelationID, kafka.ApiName(req.Key), req.Version,
+		kafka.ApiName(previous.key), at.Sub(previous.at).Round(time.Millisecond))
+}
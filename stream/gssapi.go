@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+)
+
+// gssapiMechanism is the SASL mechanism name of Kerberos authentication
+const gssapiMechanism = "GSSAPI"
+
+// markGssapiToken labels the SaslAuthenticate requests of a GSSAPI exchange. Its tokens are
+// binary and carry no readable username, so a username guessed from their printable bytes is
+// dropped before it's logged or correlated with the client.
+func (h *KafkaStream) markGssapiToken(req *kafka.Request) {
+	body, ok := req.Body.(*kafka.SaslAuthenticateRequest)
+	if !ok || (h.currentMechanism != gssapiMechanism && body.Mechanism != gssapiMechanism) {
+		return
+	}
+
+	body.Mechanism = gssapiMechanism
+	body.Username = ""
+}
+
+// auditGssapi records that the connection authenticates with Kerberos. The client principal
+// of the initial token is encrypted, only the service principal of its ticket is logged.
+func (h *KafkaStream) auditGssapi(token *kafka.GssapiInitialToken) {
+	h.currentMechanism = gssapiMechanism
+	// the session is GSSAPI even if its SaslHandshake wasn't captured
+	h.auth.StoreHandshake(h.srcHost, gssapiMechanism)
+
+	logging.Audit("auth", logging.Fields{
+		"client_ip":         h.srcHost,
+		"src_port":          h.srcPort,
+		"mechanism":         gssapiMechanism,
+		"service_principal": token.ServicePrincipal,
+		"realm":             token.Realm,
+		"spnego":            token.Spnego,
+	}, "Client: %s, SASL GSSAPI Auth, Service: %s, Realm: %s", h.srcHost, token.ServicePrincipal, token.Realm)
+}
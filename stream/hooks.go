@@ -0,0 +1,25 @@
+package stream
+
+import "github.com/d-ulyanov/kafka-sniffer/kafka"
+
+// RequestHook is called for every successfully decoded request with the address of the client
+// that sent it. It lets programs embedding the sniffer run custom logic (alerting, enrichment)
+// without changing the stream handling.
+type RequestHook func(req *kafka.Request, clientAddr string)
+
+// RegisterHook adds a hook called for every decoded request. Hooks must be registered before
+// streams are created, they are not safe to add while capturing.
+//
+// Hooks run in registration order on the goroutine reading the connection, after the metrics
+// and logs of the request have been handled. They must not block: the connection isn't read
+// while a hook runs. Hooks of different connections run concurrently.
+func (h *KafkaStreamFactory) RegisterHook(hook RequestHook) {
+	h.hooks = append(h.hooks, hook)
+}
+
+// runHooks calls the registered hooks with the given request
+func (h *KafkaStream) runHooks(req *kafka.Request) {
+	for _, hook := range h.hooks {
+		hook(req, h.clientAddress)
+	}
+}
@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+)
+
+func TestHookFiresForMetadataRequest(t *testing.T) {
+	f := newTestFactory()
+
+	var calls []string
+	var decoded *kafka.MetadataRequest
+	var client string
+	f.RegisterHook(func(req *kafka.Request, clientAddr string) {
+		calls = append(calls, "first")
+		decoded, _ = req.Body.(*kafka.MetadataRequest)
+		client = clientAddr
+	})
+	f.RegisterHook(func(req *kafka.Request, clientAddr string) {
+		calls = append(calls, "second")
+	})
+
+	f.ReadStream(bytes.NewReader(metadataRequest("orders", "payments")), "10.0.0.1")
+
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Fatalf("hooks ran as %v, want [first second]", calls)
+	}
+	if decoded == nil {
+		t.Fatal("the hook didn't get a metadata request")
+	}
+	if client != "10.0.0.1" {
+		t.Errorf("the hook got client %q, want 10.0.0.1", client)
+	}
+	if len(decoded.Topics) != 2 || decoded.Topics[0] != "orders" || decoded.Topics[1] != "payments" {
+		t.Errorf("metadata topics are %v, want [orders payments]", decoded.Topics)
+	}
+}
+
+func TestHookSkipsMalformedRequests(t *testing.T) {
+	f := newTestFactory()
+
+	calls := 0
+	f.RegisterHook(func(req *kafka.Request, clientAddr string) {
+		calls++
+	})
+	f.ReadStream(bytes.NewReader(frame(3, 1, int32s(5))), "10.0.0.1")
+
+	if calls != 0 {
+		t.Errorf("the hook ran %d times for a malformed request", calls)
+	}
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// SetContext sets the context of the streams. Once it's done, streams stop decoding and
+// release their buffers, whatever is left of them is discarded.
+func (h *KafkaStreamFactory) SetContext(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// SetIdleTimeout stops decoding captured streams which received no data for the given
+// duration, e.g. half-open connections whose end was never captured. The assembler only
+// closes connections when it's flushed. 0 disables the timeout.
+func (h *KafkaStreamFactory) SetIdleTimeout(timeout time.Duration) {
+	h.idleTimeout = timeout
+}
+
+// Reassembled implements tcpassembly.Stream. It remembers the capture time of the data
+// before handing it over to the reader, and drops it once the stream was closed.
+func (h *KafkaStream) Reassembled(reassembly []tcpassembly.Reassembly) {
+	if n := len(reassembly); n > 0 && !reassembly[n-1].Seen.IsZero() {
+		atomic.StoreInt64(&h.seen, reassembly[n-1].Seen.UnixNano())
+	}
+	for _, r := range reassembly {
+		if len(r.Bytes) > 0 {
+			atomic.StoreInt64(&h.active, time.Now().UnixNano())
+			break
+		}
+	}
+
+	// the lock is held while the reader consumes the data, it can't be closed meanwhile
+	h.closeMu.Lock()
+	defer h.closeMu.Unlock()
+	if !h.closed {
+		h.r.Reassembled(reassembly)
+	}
+}
+
+// ReassemblyComplete implements tcpassembly.Stream
+func (h *KafkaStream) ReassemblyComplete() {
+	h.close()
+}
+
+// close ends the reader of the stream with EOF, the data reassembled afterwards is dropped
+func (h *KafkaStream) close() {
+	h.closeMu.Lock()
+	defer h.closeMu.Unlock()
+	if !h.closed {
+		h.closed = true
+		h.r.ReassemblyComplete()
+	}
+}
+
+// watch closes the stream when ctx is done or no data was reassembled for idleTimeout,
+// until done is closed
+func (h *KafkaStream) watch(ctx context.Context, idleTimeout time.Duration, done <-chan struct{}) {
+	// a nil channel never fires, without timeout only ctx closes the stream
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if idleTimeout > 0 {
+		timer = time.NewTimer(idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			h.close()
+			return
+		case <-idle:
+			since := time.Since(time.Unix(0, atomic.LoadInt64(&h.active)))
+			if since >= idleTimeout {
+				logging.Printf("closing stream %s:%s -> %s:%s, idle for %s",
+					h.srcHost, h.srcPort, h.dstHost, h.dstPort, since.Round(time.Second))
+				h.close()
+				return
+			}
+			timer.Reset(idleTimeout - since)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// DefaultInvalidLengthThreshold is the number of messages of invalid size from a client
+// after which it's reported
+const DefaultInvalidLengthThreshold = 10
+
+// invalidLengths counts the messages of invalid size of each client, across its connections
+type invalidLengths struct {
+	threshold int
+	mu        sync.Mutex
+	counts    map[string]int
+}
+
+func newInvalidLengths(threshold int) *invalidLengths {
+	return &invalidLengths{threshold: threshold, counts: make(map[string]int)}
+}
+
+// add counts a message of the client and returns its count, and whether it should be reported:
+// every threshold messages, so that ongoing probing is reported without flooding the log
+func (t *invalidLengths) add(client string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts[client]++
+	count := t.counts[client]
+	return count, t.threshold > 0 && count%t.threshold == 0
+}
+
+// SetInvalidLengthThreshold sets the number of messages of invalid size (negative, too small
+// or over the maximum request size) after which a client is reported, and again every as
+// many messages. They're the sign of a malformed client or of a probe. 0 disables the report,
+// the messages are still counted in metrics.
+func (h *KafkaStreamFactory) SetInvalidLengthThreshold(threshold int) {
+	h.invalidLengths = newInvalidLengths(threshold)
+}
+
+// reportInvalidLength counts a message of invalid size sent on the stream
+func (h *KafkaStream) reportInvalidLength(err error) {
+	metrics.InvalidLengthTotal.WithLabelValues(h.srcHost).Inc()
+
+	count, report := h.invalidLengths.add(h.srcHost)
+	if !report {
+		return
+	}
+	logging.Audit("invalid_length", logging.Fields{
+		"client_ip":   h.srcHost,
+		"src_port":    h.srcPort,
+		"broker_ip":   h.dstHost,
+		"broker_port": h.dstPort,
+		"count":       count,
+		"error":       err.Error(),
+	}, "[SECURITY] Client: %s sent %d messages of invalid size, last on %s:%s -> %s:%s: %v",
+		h.srcHost, count, h.srcHost, h.srcPort, h.dstHost, h.dstPort, err)
+}
@@ -2,13 +2,20 @@ package stream
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
 	kafkalog "github.com/d-ulyanov/kafka-sniffer/kafka"
 	"fmt"
 	"io"
-	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/d-ulyanov/kafka-sniffer/events"
 	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
 	"github.com/d-ulyanov/kafka-sniffer/metrics"
 
 	"github.com/google/gopacket"
@@ -18,15 +25,122 @@ import (
 
 // We don't need this function anymore as we've simplified buffer handling
 
+// Bounds and default of the read buffer size of streams
+const (
+	MinBufferSize     = 4 * 1024
+	DefaultBufferSize = 64 * 1024
+	MaxBufferSize     = 64 * 1024 * 1024
+)
+
 // KafkaStreamFactory implements tcpassembly.StreamFactory
 type KafkaStreamFactory struct {
 	metricsStorage *metrics.Storage
 	verbose        bool
+	events         events.Sink
+	detectRawSasl  bool
+	saslPorts      map[string]bool
+	brokerPorts    map[string]bool
+	detector       *brokerPortDetector // nil unless broker ports are detected
+	latency        *latencyTracker
+	topicFilter    *TopicFilter
+	bufferSize     int
+	headerCapture  *headerCapture
+	keyMaxLength   int // 0 unless produced record keys are logged
+	hooks          []RequestHook
+	auth           *kafka.AuthTracker
+	ctx            context.Context
+	idleTimeout    time.Duration
+	anonymizeKey   []byte // nil unless client addresses are anonymized
+	invalidLengths *invalidLengths
+	pool           *decodePool // nil unless decoding is bounded to a worker pool
+	includePort    bool // per-connection metrics are labeled with the client ip:port
+	wg             sync.WaitGroup
 }
 
 // NewKafkaStreamFactory assembles streams
 func NewKafkaStreamFactory(metricsStorage *metrics.Storage, verbose bool) *KafkaStreamFactory {
-	return &KafkaStreamFactory{metricsStorage: metricsStorage, verbose: verbose}
+	return &KafkaStreamFactory{metricsStorage: metricsStorage, verbose: verbose, events: events.NopSink{}, auth: kafka.DefaultAuthTracker(), detectRawSasl: true, bufferSize: DefaultBufferSize, ctx: context.Background(), invalidLengths: newInvalidLengths(DefaultInvalidLengthThreshold)}
+}
+
+// SetBufferSize sets the size of the read buffer of each stream. Every captured connection
+// allocates its own buffer (two with latency measurement), so memory grows with
+// size * concurrent connections.
+func (h *KafkaStreamFactory) SetBufferSize(size int) error {
+	if size < MinBufferSize || size > MaxBufferSize {
+		return fmt.Errorf("stream buffer size must be between %d and %d bytes, got %d", MinBufferSize, MaxBufferSize, size)
+	}
+	h.bufferSize = size
+	return nil
+}
+
+// SetDetectRawSasl enables or disables the detection of raw (unframed) SASL tokens sent
+// after a SaslHandshake. It is enabled by default.
+func (h *KafkaStreamFactory) SetDetectRawSasl(enabled bool) {
+	h.detectRawSasl = enabled
+}
+
+// SetSaslPorts sets the broker ports of listeners requiring SASL authentication.
+// Data requests on these ports without an observed SaslAuthenticate are reported.
+func (h *KafkaStreamFactory) SetSaslPorts(ports []string) {
+	h.saslPorts = make(map[string]bool, len(ports))
+	for _, port := range ports {
+		h.saslPorts[strings.TrimSpace(port)] = true
+	}
+}
+
+// SetBrokerPorts sets the ports of the brokers, telling the direction of each stream.
+// Streams to a broker port carry requests and are decoded, streams from a broker port
+// carry responses. When neither or both ports of a connection are broker ports, the lower
+// port is assumed to be the broker's.
+func (h *KafkaStreamFactory) SetBrokerPorts(ports []string) {
+	h.brokerPorts = make(map[string]bool, len(ports))
+	for _, port := range ports {
+		h.brokerPorts[strings.TrimSpace(port)] = true
+	}
+}
+
+// SetLatency enables the decoding of responses, used to measure request latency. The BPF
+// filter must then capture both directions of the connections.
+func (h *KafkaStreamFactory) SetLatency(enabled bool) {
+	h.latency = nil
+	if enabled {
+		h.latency = newLatencyTracker()
+	}
+}
+
+// fromBroker tells whether a stream with the given ports comes from the broker
+func (h *KafkaStreamFactory) fromBroker(srcPort, dstPort string) bool {
+	srcBroker, dstBroker := h.isBrokerPort(srcPort), h.isBrokerPort(dstPort)
+	if srcBroker != dstBroker {
+		return srcBroker
+	}
+
+	// neither or both are broker ports, clients usually connect from a higher ephemeral port
+	src, srcErr := strconv.Atoi(srcPort)
+	dst, dstErr := strconv.Atoi(dstPort)
+	return srcErr == nil && dstErr == nil && src < dst
+}
+
+// SetTopicFilter sets the filter of topics tracked in relation metrics and the summary log
+func (h *KafkaStreamFactory) SetTopicFilter(f *TopicFilter) {
+	h.topicFilter = f
+}
+
+// SetCaptureHeaders enables the capture of produced record headers. The given header keys
+// are logged for every record carrying them, "*" logs every key.
+func (h *KafkaStreamFactory) SetCaptureHeaders(keys []string) {
+	h.headerCapture = newHeaderCapture(keys)
+}
+
+// SetAuthTracker sets the tracker correlating SASL authentications with client addresses.
+// Streams use the package default tracker unless set.
+func (h *KafkaStreamFactory) SetAuthTracker(t *kafka.AuthTracker) {
+	h.auth = t
+}
+
+// SetEventSink sets the sink receiving high-level events (auth anomalies, topic deletions, ...)
+func (h *KafkaStreamFactory) SetEventSink(sink events.Sink) {
+	h.events = sink
 }
 
 // New assembles new stream
@@ -34,30 +148,197 @@ func (h *KafkaStreamFactory) New(net, transport gopacket.Flow) tcpassembly.Strea
 	s := &KafkaStream{
 		net:            net,
 		transport:      transport,
-		r:              tcpreader.NewReaderStream(),
 		metricsStorage: h.metricsStorage,
 		verbose:        h.verbose,
+		events:         h.events,
+		detectRawSasl:  h.detectRawSasl,
+		topicFilter:    h.topicFilter,
+		bufferSize:     h.bufferSize,
+		headerCapture:  h.headerCapture,
+		keyMaxLength:   h.keyMaxLength,
+		hooks:          h.hooks,
+		auth:           h.auth,
+		invalidLengths: h.invalidLengths,
+		includePort:    h.includePort,
+		ctx:            h.ctx,
+		active:         time.Now().UnixNano(),
+		srcHost:        fmt.Sprint(net.Src()),
+		srcPort:        fmt.Sprint(transport.Src()),
+		dstHost:        fmt.Sprint(net.Dst()),
+		dstPort:        fmt.Sprint(transport.Dst()),
+	}
+	s.saslListener = h.saslPorts[s.dstPort]
+
+	// The client address enters the stream here only, everything downstream gets the
+	// anonymized one
+	fromBroker := h.fromBroker(s.srcPort, s.dstPort)
+	if fromBroker {
+		s.dstHost = h.anonymize(s.dstHost)
+	} else {
+		s.srcHost = h.anonymize(s.srcHost)
+	}
+
+	// Requests decoded by the worker pool are queued, responses are only matched to them
+	if h.pool != nil && !fromBroker {
+		s.pool = h.pool
+		s.queue = newQueuedReader(h.pool.queueBytes, fmt.Sprintf("%s:%s -> %s:%s", s.srcHost, s.srcPort, s.dstHost, s.dstPort))
+		s.r = s.queue
+	} else {
+		r := tcpreader.NewReaderStream()
+		s.r = &r
+	}
+
+	// Important... we must guarantee that data from the reader stream is read.
+	done := make(chan struct{})
+	if h.idleTimeout > 0 || h.ctx.Done() != nil {
+		go s.watch(h.ctx, h.idleTimeout, done)
+	}
+	h.wg.Add(1)
+	if fromBroker {
+		// broker -> client direction of the connection, only decoded to measure latency
+		go func() {
+			defer h.wg.Done()
+			defer close(done)
+			if h.latency == nil {
+				_ = tcpreader.DiscardBytesToEOF(s.r)
+				return
+			}
+			s.latency = h.latency
+			s.conn = connectionKey(s.dstHost, s.dstPort, s.srcHost, s.srcPort)
+			s.runResponses(s.r)
+		}()
+		return s
 	}
 
-	go s.run() // Important... we must guarantee that data from the reader stream is read.
+	if h.latency != nil {
+		s.latency = h.latency
+		s.conn = connectionKey(s.srcHost, s.srcPort, s.dstHost, s.dstPort)
+	}
+	// Streams to other ports than the broker ones are only decoded once they look like Kafka
+	if h.detector != nil && !h.isBrokerPort(s.dstPort) {
+		if h.detector.full() {
+			go func() {
+				defer h.wg.Done()
+				defer close(done)
+				_ = tcpreader.DiscardBytesToEOF(s.r)
+			}()
+			return s
+		}
+		s.detector = h.detector
+	}
+	go func() {
+		defer h.wg.Done()
+		defer close(done)
+		r := io.Reader(s.r)
+		if s.detector != nil {
+			buf := bufio.NewReaderSize(s.r, h.bufferSize)
+			if !s.detectBrokerPort(buf) {
+				_ = tcpreader.DiscardBytesToEOF(s.r)
+				return
+			}
+			r = buf
+		}
+		s.run(r)
+		// run stops early once the context is done, the rest of the stream must still be read
+		_ = tcpreader.DiscardBytesToEOF(s.r)
+	}()
+
+	return s
+}
 
-	return &s.r
+// Wait blocks until all streams created by New have been read to the end, e.g. after
+// the assembler has been flushed at the end of a capture file
+func (h *KafkaStreamFactory) Wait() {
+	h.wg.Wait()
+}
+
+// ReadStream decodes framed Kafka requests from r until EOF, bypassing TCP reassembly.
+// It is used for sources libpcap can't see, e.g. a Unix domain socket or a pipe
+// fed by a sidecar proxy. The source name is used in place of the client address.
+func (h *KafkaStreamFactory) ReadStream(r io.Reader, source string) {
+	s := &KafkaStream{
+		metricsStorage: h.metricsStorage,
+		verbose:        h.verbose,
+		events:         h.events,
+		detectRawSasl:  h.detectRawSasl,
+		topicFilter:    h.topicFilter,
+		bufferSize:     h.bufferSize,
+		headerCapture:  h.headerCapture,
+		keyMaxLength:   h.keyMaxLength,
+		hooks:          h.hooks,
+		auth:           h.auth,
+		invalidLengths: h.invalidLengths,
+		includePort:    h.includePort,
+		ctx:            h.ctx,
+		srcHost:        source,
+		srcPort:        "0",
+		dstHost:        "broker",
+		dstPort:        "0",
+	}
+
+	s.run(r)
 }
 
 // KafkaStream will handle the actual decoding of http requests.
 type KafkaStream struct {
+	// seen is the capture time (unix nanoseconds) of the last reassembled data, it is
+	// accessed atomically and kept first for 64-bit alignment on 32-bit platforms
+	seen int64
+	// active is the wall clock time (unix nanoseconds) at which data was last reassembled
+	active int64
+
 	net, transport gopacket.Flow
-	r              tcpreader.ReaderStream
+	r              streamReader
+	queue          *queuedReader // r in worker pool mode, nil otherwise
+	pool           *decodePool
+	holdingWorker  bool
+	closeMu        sync.Mutex
+	closed         bool // the reader got EOF, later data is dropped
+	ctx            context.Context
 	metricsStorage *metrics.Storage
 	verbose        bool
+	events         events.Sink
+	topicFilter    *TopicFilter
+	bufferSize     int
+	headerCapture  *headerCapture // nil unless record headers are captured
+	keyMaxLength   int            // 0 unless produced record keys are logged
+	hooks          []RequestHook
+	auth           *kafka.AuthTracker
+	detectRawSasl  bool
 	clientAddress  string
+	srcHost, srcPort string
+	dstHost, dstPort string
 	currentUsername string
 	currentMechanism string
+	application    string
+	authFlow       authFlow
+	saslListener   bool
+	authSeen       bool
+	unauthWarned   bool
+	// relationsPublished are the produce and consume relations already published, by event type and topic
+	relationsPublished map[string]bool
+	// autoCreateAudited are the topics whose auto-creation attempt was already audited
+	autoCreateAudited map[string]bool
+	latency        *latencyTracker // nil when responses aren't captured
+	invalidLengths *invalidLengths
+	includePort    bool
+	detector       *brokerPortDetector // set while the destination port isn't a known broker port
+	sent           *recentRequests     // the last requests, checked for reused correlation ids
+	conn           string
 }
 
 // truncateBytes returns a string representation of byte array, truncated to maxLen if needed
 // We don't need this function as we've simplified the logging
 
+// packetTime returns the capture time of the data being decoded, so that replayed traffic
+// keeps its original timeline. Sources without capture time (Unix sockets) use the wall clock.
+// As the reader buffers ahead, the time may belong to a slightly later packet of the stream.
+func (h *KafkaStream) packetTime() time.Time {
+	if seen := atomic.LoadInt64(&h.seen); seen != 0 {
+		return time.Unix(0, seen)
+	}
+	return time.Now()
+}
 
 // valueOrNil safely returns the value of a string pointer or "nil" if it's nil
 func valueOrNil(s *string) interface{} {
@@ -67,125 +348,173 @@ func valueOrNil(s *string) interface{} {
 	return *s
 }
 
-func (h *KafkaStream) run() {
+func (h *KafkaStream) run(r io.Reader) {
 	// Initialize clientAddress at the start of processing
-	h.clientAddress = h.net.Src().String()
+	h.clientAddress = h.srcHost
 	
-	srcHost := fmt.Sprint(h.net.Src())
-	srcPort := fmt.Sprint(h.transport.Src())
-	dstHost := fmt.Sprint(h.net.Dst())
-	dstPort := fmt.Sprint(h.transport.Dst())
+	srcHost := h.srcHost
+	srcPort := h.srcPort
+	dstHost := h.dstHost
+	dstPort := h.dstPort
 	
-	// Track the last seen SASL Handshake mechanism
+	// Track the SASL Handshake mechanism that hasn't been followed by a SaslAuthenticate yet
 	lastSaslMechanism := ""
 
 	// Simple connection log with source -> destination format
-	log.Printf("%s:%s -> %s:%s", srcHost, srcPort, dstHost, dstPort)
+	logging.Event("connection_open", logging.Fields{
+		"client_ip":   srcHost,
+		"src_port":    srcPort,
+		"broker_ip":   dstHost,
+		"broker_port": dstPort,
+	}, "%s:%s -> %s:%s", srcHost, srcPort, dstHost, dstPort)
+
+	metrics.StreamsActive.Inc()
+	defer metrics.StreamsActive.Dec()
 
-	buf := bufio.NewReaderSize(&h.r, 2<<15) // 65k
+	stats := &connectionStats{
+		opened: h.packetTime(),
+		reader: &countingReader{r: r, counter: metrics.ConnectionBytesTotal.WithLabelValues(h.clientLabel())},
+	}
+	defer h.logConnectionClosed(stats)
+
+	buf := bufio.NewReaderSize(stats.reader, h.bufferSize)
 
 	// add new client ip to metric
-	h.metricsStorage.AddActiveConnectionsTotal(h.net.Src().String())
+	h.metricsStorage.AddActiveConnectionsTotal(h.clientLabel())
+
+	if h.skipTLS(buf) {
+		return
+	}
 
+	defer h.releaseWorker()
 	for {
-		// Try to peek at the next 16 bytes to check for raw SASL tokens after a SASL handshake
-		if lastSaslMechanism == "PLAIN" {
-			peekData, err := buf.Peek(16)
-			if err == nil && len(peekData) >= 4 {
+		// the worker is held until the request is processed
+		h.releaseWorker()
+
+		if err := h.ctx.Err(); err != nil {
+			logging.Printf("stop reading from stream: %v", err)
+			h.emitAuthFlow()
+			return
+		}
+
+		// Peek at the next frame to check for raw SASL tokens after a SASL handshake. Only its
+		// length and first byte are needed: peeking further would wait for the request following
+		// a short token, and look into it.
+		if h.detectRawSasl && lastSaslMechanism == "PLAIN" {
+			peekData, err := buf.Peek(5)
+			if err == nil {
 				// Check if this looks like a raw SASL token (not a Kafka protocol message)
 				// Real Kafka messages start with a 4-byte length followed by API key, version, etc.
 				// SASL tokens typically start with 0x00 for PLAIN mechanism
 				msgSize := int(binary.BigEndian.Uint32(peekData[:4]))
-				
-				// If this is a small message and starts with a null byte, it might be a raw SASL token
-				if msgSize < 1000 && len(peekData) > 4 && peekData[4] == 0 {
-					// Read the full message
-					tokenData := make([]byte, msgSize+4) // +4 for the length field
-					_, err := io.ReadFull(buf, tokenData)
+
+				// If this is a small message and starts with a null byte, it might be a raw SASL token.
+				// The first byte of an empty message would be the next frame's.
+				if msgSize > 0 && msgSize < 1000 && peekData[4] == 0 {
+					// Peek the full message, it's only consumed once complete so that exactly its
+					// bytes are taken, never a part of the next frame
+					tokenData, err := buf.Peek(msgSize + 4) // +4 for the length field
 					if err == nil {
-						// Attempt to extract username from the SASL token
-						username, ok := extractSaslPlainUsername(tokenData[4:])
+						// A request sent right after the handshake starts with a null byte as well. The
+						// frame is only taken for a token when it isn't a plausible request and holds a
+						// username, otherwise it's left to DecodeRequest.
+						username, ok := "", false
+						if !looksLikeRequestHeader(tokenData[4:]) {
+							username, ok = extractSaslPlainUsername(tokenData[4:])
+						}
 						if ok {
-							log.Printf("Client: %s, Raw SASL Auth, Mechanism: %s, Username: %s", 
-								srcHost, lastSaslMechanism, username)
+							_, _ = buf.Discard(len(tokenData))
+							logRawSaslAuth(srcHost, srcPort, lastSaslMechanism, username)
+							h.observeRawAuth(username)
+							h.publish(events.Event{Type: events.PlaintextCredentials, Username: username, Mechanism: lastSaslMechanism})
+							h.publish(events.Event{Type: events.Authentication, Username: username, Mechanism: lastSaslMechanism})
 							
 							// Store the client address for this session
-							h.clientAddress = h.net.Src().String() // Make sure clientAddress is set
+							h.clientAddress = h.srcHost // Make sure clientAddress is set
 							
 							// Store username information for this stream
 							h.currentUsername = username
 							h.currentMechanism = lastSaslMechanism
 							
 							// Store in global auth tracker for use across connections
-							kafkalog.StoreAuthHandshake(srcHost, lastSaslMechanism)
-							kafkalog.UpdateAuthSession(srcHost, username)
+							h.auth.StoreHandshake(srcHost, lastSaslMechanism)
+							h.auth.UpdateSession(srcHost, username)
 							
 							// Track metrics
 							h.metricsStorage.AddActiveConnectionsTotal(fmt.Sprintf("%s:%s", srcHost, username))
 							
-							// Record the auth user in metrics and storage - critical for tracking
-							metrics.RecordAuthUser(h.clientAddress, username, lastSaslMechanism)
-							
-							// Also directly add the user-client mapping in the metrics storage
-							h.metricsStorage.AddUserClientMapping(h.clientAddress, username, lastSaslMechanism)
+							// Record the auth user and the user-client mapping in the metrics storage
+							h.metricsStorage.RecordAuthUser(h.clientAddress, username, lastSaslMechanism)
 							
-							// Update existing topic relationships with this username
+							// Update existing topic and group relationships with this username
 							h.updateExistingTopicRelationships()
+							h.updateExistingGroupRelationships()
+
+							// Reset the last mechanism so we don't try to process raw tokens again
+							lastSaslMechanism = ""
+							continue
 						}
-						// Reset the last mechanism so we don't try to process raw tokens again
+						// Not a token, the client doesn't send raw tokens on this connection
 						lastSaslMechanism = ""
-						continue
 					}
 				}
 			}
 		}
 		// Proceed with decoding as usual
+		h.acquireWorker(buf)
 		req, readBytes, err := kafka.DecodeRequest(buf)
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			log.Println("got EOF - stop reading from stream")
+			logging.Println("got EOF - stop reading from stream")
+			h.checkAuthFailure()
+			h.emitAuthFlow()
 			return
 		}
 
 		if err != nil {
 			// Skip detailed error logging
 
-			if _, ok := err.(kafka.PacketDecodingError); ok {
-				_, _ = buf.Discard(readBytes)
+			if e, ok := err.(kafka.PacketDecodingError); ok {
+				if e.InvalidLength {
+					h.reportInvalidLength(e)
+				}
+				// a body failing to decode was read whole, the next request follows it
+				_, _ = buf.Discard(kafka.UnreadBytes(e, readBytes))
+				continue
 			}
 
-			continue
+			// The source itself failed (e.g. it was closed on shutdown), read errors are sticky
+			logging.Printf("stop reading from stream: %v", err)
+			h.emitAuthFlow()
+			return
 		}
 
-		// API name will be determined by getApiName function
-		// No need for this switch statement as we have a complete mapping function
-		/*
-		switch req.Key {
-		case 0:
-			apiName = "Produce"
-		case 1:
-			apiName = "Fetch"
-		case 2:
-			apiName = "ListOffsets"
-		case 3:
-			apiName = "Metadata"
-		case 8:
-			apiName = "DescribeGroups"
-		case 10:
-			apiName = "FindCoordinator"
-		case 17:
-			apiName = "SaslHandshake"
-		case 18:
-			apiName = "ApiVersions"
-		case 19:
-			apiName = "CreateTopics"
-		case 20:
-			apiName = "DeleteTopics"
-		case 36:
-			apiName = "SaslAuthenticate"
+		stats.requests++
+		h.checkDuplicate(req)
+
+		// Keep track of the highest api key to notice newer protocol versions. The header of a
+		// misframed stream would pin the gauge to a garbage key for good.
+		if plausibleApiKey(req.Key, req.Version) {
+			metrics.RecordApiKeySeen(req.Key)
 		}
-		*/
+
+		if h.latency != nil && expectsResponse(req) {
+			h.latency.request(h.conn, req.CorrelationID, kafka.ApiName(req.Key), h.packetTime())
+		}
+
+		// Aggregate relation metrics by the application derived from ClientID
+		if application := metrics.ApplicationFromClientID(req.ClientID, h.srcHost); application != h.application {
+			h.application = application
+			h.metricsStorage.SetClientApplication(h.srcHost, application)
+		}
+
+		h.markGssapiToken(req)
+
 		// Print detailed request header information for all requests
-		logRequestHeaderDetails(req, srcHost, srcPort, dstHost, dstPort)
+		logRequestHeaderDetails(req, h.clientLabel(), srcHost, srcPort)
+
+		// Follow the SASL flow of this connection for the auth summary log
+		h.observeAuthFlow(req)
+		h.checkAuthenticated(req)
 		
 		// Track SASL Handshake mechanism for raw token processing
 		if req.Key == 17 { // SaslHandshake
@@ -193,22 +522,32 @@ func (h *KafkaStream) run() {
 				lastSaslMechanism = handshakeReq.Mechanism
 			}
 		}
+		if req.Key == 36 { // SaslAuthenticate
+			// the client uses framed authentication, there is no raw token to look for
+			lastSaslMechanism = ""
+		}
 		
 		// Process specific request types for topic tracking and authentication
 		switch body := req.Body.(type) {
 		case *kafka.ProduceRequest:
 			for _, topic := range body.ExtractTopics() {
+				if !h.trackTopic(topic) {
+					continue
+				}
+
 				// Log topic write access in both the standard format and the summary log
 				// Log production activity
 
 				// Set client address if not already set
 				if h.clientAddress == "" {
-					h.clientAddress = h.net.Src().String()
+					h.clientAddress = h.srcHost
 					// Set client address
 				}
 
 				// Add producer-topic relation to metrics
 				h.metricsStorage.AddProducerTopicRelationInfo(h.clientAddress, topic)
+				h.metricsStorage.SetProducePartitions(h.clientAddress, topic, body.PartitionCount(topic))
+				metrics.ProduceBytesTotal.WithLabelValues(h.clientAddress, topic).Add(float64(body.TopicRecordsSize(topic)))
 				// Track producer-topic relationship
 				
 				// First check if we have a username in the current stream
@@ -218,12 +557,12 @@ func (h *KafkaStream) run() {
 				// If not, try to get it from the global auth tracker using base IP
 				if username == "" {
 					// Try base IP lookup first - most reliable
-					baseUsername := kafkalog.GetUsernameByIP(h.clientAddress)
+					baseUsername := h.auth.GetUsernameByIP(h.clientAddress)
 					if baseUsername != "" {
 						username = baseUsername
 						// Store this for future use
 						h.currentUsername = username
-					} else if session, found := kafka.GetAuthSession(srcHost); found && session.Username != "" {
+					} else if session, found := h.auth.GetSession(srcHost); found && session.Username != "" {
 						username = session.Username
 						// Also update the current stream with this username for future use
 						h.currentUsername = username
@@ -235,29 +574,49 @@ func (h *KafkaStream) run() {
 				
 				// Now update the metrics with the username (if found)
 				if username != "" {
-					metrics.ProducerUserTopicInfo.WithLabelValues(h.clientAddress, username, topic).Set(1)
+					metrics.SetProducerUserTopic(h.clientAddress, username, topic)
 				} else {
 					// Log topic write access without username
-					log.Printf("client %s produced to topic %s", srcHost, topic)
+					logging.Printf("client %s produced to topic %s", srcHost, topic)
 				}
 				
 				// Write to both standard logs and summary file
 				summaryLogger := kafkalog.GetSummaryLogger()
-				summaryLogger.LogTopicProduction(srcHost, srcPort, topic, username)
+				summaryLogger.LogTopicProduction(h.packetTime(), srcHost, srcPort, topic, username)
+				h.publishRelation(events.ProduceRelation, topic, username)
 			}
+
+			// Record count and size of the produced batches
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+
+			if h.headerCapture != nil {
+				h.logRecordHeaders(body)
+			}
+			h.countRecordKeys(body)
 		case *kafka.FetchRequest:
+			metrics.FetchTotal.WithLabelValues(h.srcHost, body.FetcherType()).Inc()
+			// Followers replicate the partitions they host, they don't consume the topics
+			if body.FromFollower() {
+				break
+			}
+
 			for _, topic := range body.ExtractTopics() {
+				if !h.trackTopic(topic) {
+					continue
+				}
+
 				// Log topic read access in the debug format
 				// Client is consuming from topic
 
 				// Set client address if not already set
 				if h.clientAddress == "" {
-					h.clientAddress = h.net.Src().String()
+					h.clientAddress = h.srcHost
 					// Set client address
 				}
 
 				// Add consumer-topic relation to metrics
 				h.metricsStorage.AddConsumerTopicRelationInfo(h.clientAddress, topic)
+				h.metricsStorage.SetFetchPartitions(h.clientAddress, topic, body.PartitionCount(topic))
 				// Consumer-topic relation added
 				
 				// First check if we have a username in the current stream
@@ -266,12 +625,12 @@ func (h *KafkaStream) run() {
 				// If not, try to get it from the global auth tracker
 				if username == "" {
 					// Try base IP lookup first - most reliable
-					baseUsername := kafka.GetUsernameByIP(h.clientAddress)
+					baseUsername := h.auth.GetUsernameByIP(h.clientAddress)
 					if baseUsername != "" {
 						username = baseUsername
 						// Store this for future use
 						h.currentUsername = username
-					} else if session, found := kafkalog.GetAuthSession(srcHost); found && session.Username != "" {
+					} else if session, found := h.auth.GetSession(srcHost); found && session.Username != "" {
 						username = session.Username
 						// Also update the current stream with this username for future use
 						h.currentUsername = username
@@ -283,60 +642,365 @@ func (h *KafkaStream) run() {
 				
 				// Now update the metrics with the username (if found)
 				if username != "" {
-					metrics.ConsumerUserTopicInfo.WithLabelValues(h.clientAddress, username, topic).Set(1)
+					metrics.SetConsumerUserTopic(h.clientAddress, username, topic)
 				} else {
 					// Log topic read access without username
-					log.Printf("client %s consumed from topic %s", srcHost, topic)
+					logging.Printf("client %s consumed from topic %s", srcHost, topic)
 				}
 				
 				// Write to both standard logs and summary file
 				summaryLogger := kafkalog.GetSummaryLogger()
-				summaryLogger.LogTopicConsumption(srcHost, srcPort, topic, username)
+				summaryLogger.LogTopicConsumption(h.packetTime(), srcHost, srcPort, topic, username)
+				h.publishRelation(events.ConsumeRelation, topic, username)
 			}
+
+			h.metricsStorage.SetFetchWait(h.srcHost, body.MaxWaitTime, body.MinBytes)
 		case *kafka.ListOffsetsRequest:
 			for _, topic := range body.ExtractTopics() {
+				if !h.trackTopic(topic) {
+					continue
+				}
 				// Log topic information queries
-				log.Printf("client %s queried offsets for topic %s", srcHost, topic)
+				logging.Printf("client %s queried offsets for topic %s", srcHost, topic)
 				// Add consumer-topic relation as this often precedes actual consumption
-				h.metricsStorage.AddConsumerTopicRelationInfo(h.net.Src().String(), topic)
+				h.metricsStorage.AddConsumerTopicRelationInfo(h.srcHost, topic)
 				
 				// Directly update the user-topic metrics if we have a username
 				if h.currentUsername != "" {
-					metrics.ConsumerUserTopicInfo.WithLabelValues(h.clientAddress, h.currentUsername, topic).Set(1)
+					metrics.SetConsumerUserTopic(h.clientAddress, h.currentUsername, topic)
 				}
 			}
 		case *kafka.MetadataRequest:
 			for _, topic := range body.ExtractTopics() {
 				// Only log actual topic names, not empty queries for all topics
 				if topic != "" {
-					log.Printf("client %s requested metadata for topic %s", srcHost, topic)
+					logging.Printf("client %s requested metadata for topic %s", srcHost, topic)
+				}
+			}
+			if body.AllowAutoTopicCreation {
+				h.auditAutoTopicCreation(body.ExtractTopics())
+			}
+		case *kafka.CreateTopicsRequest:
+			h.auditTopicCreation(body)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.DeleteTopicsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			for _, topic := range body.ExtractTopics() {
+				logging.Audit("topic_delete", logging.Fields{
+					"client_ip": srcHost,
+					"username":  username,
+					"topic":     topic,
+				}, "client %s deleted topic %s", srcHost, topic)
+				h.publish(events.Event{Type: events.TopicDeletion, Username: h.currentUsername, Topic: topic})
+			}
+		case *kafka.DeleteRecordsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			for _, topic := range body.Topics {
+				for _, partition := range topic.Partitions {
+					logging.Audit("delete_records", logging.Fields{
+						"client_ip": srcHost,
+						"username":  username,
+						"topic":     topic.Topic,
+						"partition": partition.Partition,
+						"offset":    partition.Offset,
+					}, "[AUDIT] Client: %s, User: %s, DeleteRecords topic: %s, Partition: %d, Before offset: %d",
+						srcHost, username, topic.Topic, partition.Partition, partition.Offset)
+				}
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.GenericRequest:
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.ListGroupsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			logging.Audit("list_groups", logging.Fields{
+				"client_ip":     srcHost,
+				"username":      username,
+				"states_filter": body.StatesFilter,
+				"types_filter":  body.TypesFilter,
+			}, "[AUDIT] Client: %s, User: %s, ListGroups States: %v, Types: %v",
+				srcHost, username, body.StatesFilter, body.TypesFilter)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.DescribeProducersRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			for _, topic := range body.Topics {
+				logging.Audit("describe_producers", logging.Fields{
+					"client_ip":  srcHost,
+					"username":   username,
+					"topic":      topic.Topic,
+					"partitions": topic.Partitions,
+				}, "[AUDIT] Client: %s, User: %s, DescribeProducers topic: %s, Partitions: %v",
+					srcHost, username, topic.Topic, topic.Partitions)
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.InitProducerIdRequest:
+			if body.TransactionalID != "" {
+				logging.Printf("client %s initialized transactional id %s", srcHost, body.TransactionalID)
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.AddPartitionsToTxnRequest:
+			// A transactional producer's produce requests follow, the relations are added
+			// here as well so they are known from the start of the transaction
+			for _, topic := range body.ExtractTopics() {
+				if !h.trackTopic(topic) {
+					continue
+				}
+				h.metricsStorage.AddProducerTopicRelationInfo(h.clientAddress, topic)
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.DescribeConfigsRequest:
+			for _, resource := range body.Resources {
+				if resource.ResourceType != kafka.ConfigResourceBroker && resource.ResourceType != kafka.ConfigResourceBrokerLogger {
+					continue
+				}
+				username := h.currentUsername
+				if username == "" {
+					username = h.auth.GetUsernameByIP(h.srcHost)
+				}
+				resourceType := kafka.ConfigResourceTypeName(resource.ResourceType)
+				configs := "all"
+				if len(resource.ConfigNames) > 0 {
+					configs = strings.Join(resource.ConfigNames, ",")
+				}
+				logging.Audit("describe_configs", logging.Fields{
+					"client_ip":     srcHost,
+					"username":      username,
+					"resource_type": resourceType,
+					"resource_name": resource.ResourceName,
+					"configs":       resource.ConfigNames,
+				}, "[AUDIT] Client: %s, User: %s, DescribeConfigs %s: %s, Configs: %s",
+					srcHost, username, resourceType, resource.ResourceName, configs)
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.AlterConfigsRequest:
+			h.auditConfigChanges("AlterConfigs", body.ValidateOnly, body.Resources)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.IncrementalAlterConfigsRequest:
+			h.auditConfigChanges("IncrementalAlterConfigs", body.ValidateOnly, body.Resources)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.CreateAclsRequest:
+			h.auditAcls("create", body.Creations)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.DeleteAclsRequest:
+			h.auditAcls("delete", body.Filters)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.OffsetCommitRequest:
+			// Relations are added here rather than by CollectClientMetrics so that filtered topics are skipped
+			for _, topic := range body.ExtractTopics() {
+				if !h.trackTopic(topic) {
+					continue
+				}
+				logging.Printf("client %s committed offsets of topic %s for group %s", srcHost, topic, body.GroupID())
+				h.metricsStorage.AddConsumerTopicRelationInfo(h.clientAddress, topic)
+				h.metricsStorage.AddConsumerGroupTopicRelationInfo(h.clientAddress, body.GroupID(), topic)
+				h.trackUserConsumerTopic(topic)
+			}
+			h.trackUserGroup(body.GroupID())
+		case *kafka.OffsetFetchRequest:
+			// Relations are added here rather than by CollectClientMetrics so that filtered topics are skipped
+			for _, group := range body.Groups {
+				for _, topic := range group.Topics {
+					if !h.trackTopic(topic.Topic) {
+						continue
+					}
+					logging.Printf("client %s fetched offsets of topic %s for group %s", srcHost, topic.Topic, group.GroupID)
+					h.metricsStorage.AddConsumerTopicRelationInfo(h.clientAddress, topic.Topic)
+					h.metricsStorage.AddConsumerGroupTopicRelationInfo(h.clientAddress, group.GroupID, topic.Topic)
+					h.trackUserConsumerTopic(topic.Topic)
+				}
+				h.trackUserGroup(group.GroupID)
+			}
+		case *kafka.FindCoordinatorRequest:
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+			if body.CoordinatorType == kafka.CoordinatorTypeGroup {
+				for _, group := range body.CoordinatorKeys {
+					h.trackUserGroup(group)
+				}
+			}
+		case *kafka.JoinGroupRequest:
+			logging.Printf("client %s joined group %s, Member: %s, Protocol type: %s",
+				srcHost, body.GroupID, body.MemberID, body.ProtocolType)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+			h.trackUserGroup(body.GroupID)
+		case *kafka.SyncGroupRequest:
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+			h.trackUserGroup(body.GroupID)
+			// Only the group leader sends assignments, members are mapped back to their clients
+			// through the membership seen in their own JoinGroup/SyncGroup requests
+			for _, assignment := range body.Assignments {
+				clientIP, ok := h.metricsStorage.GroupMemberClient(body.GroupID, assignment.MemberID)
+				for _, assigned := range assignment.Topics {
+					topic := assigned.Topic
+					if !h.trackTopic(topic) {
+						continue
+					}
+					h.metricsStorage.SetMemberPartitionAssignment(body.GroupID, assignment.MemberID, topic, len(assigned.Partitions))
+					if !ok {
+						continue
+					}
+					logging.Printf("group %s assigned topic %s to member %s of client %s",
+						body.GroupID, topic, assignment.MemberID, clientIP)
+					h.metricsStorage.AddConsumerTopicRelationInfo(clientIP, topic)
+					h.metricsStorage.AddConsumerGroupTopicRelationInfo(clientIP, body.GroupID, topic)
+				}
+			}
+		case *kafka.HeartbeatRequest:
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.LeaveGroupRequest:
+			logging.Printf("client %s left group %s, Members: %s",
+				srcHost, body.GroupID, strings.Join(body.MemberIDs(), ","))
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.OffsetForLeaderEpochRequest:
+			// Followers use it to truncate their log, only consumers are interested in the topics
+			if !body.FromFollower() {
+				for _, topic := range body.ExtractTopics() {
+					if !h.trackTopic(topic) {
+						continue
+					}
+					h.metricsStorage.AddConsumerTopicRelationInfo(h.clientAddress, topic)
 				}
 			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.ApiVersionsRequest:
+			// A client pins the api versions of the connection after the ApiVersions exchange.
+			// We only see requests, so the version of the ApiVersions request itself is what we can report.
+			logging.Printf("[NEGOTIATION] Connection %s:%s -> %s:%s negotiated protocol with ApiVersions v%d, Software: %s/%s",
+				srcHost, srcPort, dstHost, dstPort, body.Version, body.ClientSoftwareName, body.ClientSoftwareVersion)
+			metrics.NegotiatedProtocolInfo.WithLabelValues(h.srcHost, fmt.Sprintf("%d", body.Version)).Set(1)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.CreatePartitionsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			for _, topic := range body.Topics {
+				logging.Audit("create_partitions", logging.Fields{
+					"client_ip":     srcHost,
+					"username":      username,
+					"topic":         topic.Topic,
+					"count":         topic.Count,
+					"validate_only": body.ValidateOnly,
+				}, "[AUDIT] Client: %s, User: %s, CreatePartitions topic: %s, New count: %d, Validate only: %t",
+					srcHost, username, topic.Topic, topic.Count, body.ValidateOnly)
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.DescribeUserScramCredentialsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			users := "all"
+			if !body.AllUsers() {
+				users = strings.Join(body.Users, ",")
+			}
+			logging.Audit("describe_scram_credentials", logging.Fields{
+				"client_ip": srcHost,
+				"username":  username,
+				"users":     body.Users,
+				"all_users": body.AllUsers(),
+			}, "[AUDIT] Client: %s, User: %s, DescribeUserScramCredentials users: %s", srcHost, username, users)
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.AlterUserScramCredentialsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			for _, deletion := range body.Deletions {
+				logging.Audit("alter_scram_credentials", logging.Fields{
+					"client_ip": srcHost,
+					"username":  username,
+					"operation": "delete",
+					"user":      deletion.User,
+					"mechanism": deletion.Mechanism,
+				}, "[AUDIT] Client: %s, User: %s, AlterUserScramCredentials delete: %s, Mechanism: %s",
+					srcHost, username, deletion.User, deletion.Mechanism)
+			}
+			for _, upsertion := range body.Upsertions {
+				logging.Audit("alter_scram_credentials", logging.Fields{
+					"client_ip":  srcHost,
+					"username":   username,
+					"operation":  "upsert",
+					"user":       upsertion.User,
+					"mechanism":  upsertion.Mechanism,
+					"iterations": upsertion.Iterations,
+				}, "[AUDIT] Client: %s, User: %s, AlterUserScramCredentials upsert: %s, Mechanism: %s, Iterations: %d",
+					srcHost, username, upsertion.User, upsertion.Mechanism, upsertion.Iterations)
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.DescribeLogDirsRequest:
+			if body.AllTopics() {
+				logging.Printf("client %s described log dirs for all topics", srcHost)
+			} else {
+				logging.Printf("client %s described log dirs for topics %v", srcHost, body.ExtractTopics())
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
+		case *kafka.AlterReplicaLogDirsRequest:
+			username := h.currentUsername
+			if username == "" {
+				username = h.auth.GetUsernameByIP(h.srcHost)
+			}
+			for _, dir := range body.Dirs {
+				for _, topic := range dir.Topics {
+					logging.Audit("alter_replica_log_dirs", logging.Fields{
+						"client_ip":  srcHost,
+						"username":   username,
+						"topic":      topic.Topic,
+						"partitions": topic.Partitions,
+						"log_dir":    dir.Path,
+					}, "client %s moved replicas of topic %s to log dir %s", srcHost, topic.Topic, dir.Path)
+				}
+			}
+			body.CollectClientMetrics(h.metricsStorage, h.srcHost)
 		case *kafka.SaslAuthenticateRequest:
 			// Handle the SaslAuthenticate request (API key 36)
 			// SASL authentication request received
+
+			// The SCRAM variant (SHA-256 or SHA-512) is only named by the handshake
+			if body.Mechanism == "SCRAM" && strings.HasPrefix(h.currentMechanism, "SCRAM-") {
+				body.Mechanism = h.currentMechanism
+			}
+			if body.Gssapi != nil {
+				h.auditGssapi(body.Gssapi)
+			}
 			
 			if body.Username != "" {
 				// Authenticated username found
 				
 				// Store username for this stream
-				h.clientAddress = h.net.Src().String() // Ensure clientAddress is set
+				h.clientAddress = h.srcHost // Ensure clientAddress is set
 				h.currentUsername = body.Username
 				h.currentMechanism = body.Mechanism
 				
 				// Store authentication in the global auth tracker
 				// This makes the username available for other connections from the same client
-				kafkalog.StoreAuthHandshake(srcHost, body.Mechanism)
-				kafkalog.UpdateAuthSession(srcHost, body.Username)
+				h.auth.StoreHandshake(srcHost, body.Mechanism)
+				h.auth.UpdateSession(srcHost, body.Username)
+				
+				if body.Mechanism == "PLAIN" {
+					h.publish(events.Event{Type: events.PlaintextCredentials, Username: body.Username, Mechanism: body.Mechanism})
+				}
+				h.publish(events.Event{Type: events.Authentication, Username: body.Username, Mechanism: body.Mechanism})
 				
 				// Directly track authentication in metrics
-				metrics.AuthenticationInfo.WithLabelValues(h.clientAddress, h.currentMechanism, h.currentUsername).Inc()
+				metrics.IncAuthentication(h.clientAddress, h.currentMechanism, h.currentUsername)
 				
 				// Add user tracking in metrics
-				metrics.TrackSaslAuthentication(h.clientAddress, h.currentMechanism, h.currentUsername)
+				h.metricsStorage.TrackSaslAuthentication(h.clientAddress, h.currentMechanism, h.currentUsername)
 				
-				// Update existing topic relationships with this username
+				// Update existing topic and group relationships with this username
 				h.updateExistingTopicRelationships()
+				h.updateExistingGroupRelationships()
 			} else {
 				// Empty username in SaslAuthenticateRequest
 			}
@@ -347,12 +1011,16 @@ func (h *KafkaStream) run() {
 			
 			// Store the handshake in the global auth tracker for later correlation
 			// This helps with SASL authentication tracking
-			kafka.StoreAuthHandshake(srcHost, body.Mechanism)
+			h.auth.StoreHandshake(srcHost, body.Mechanism)
 			
 			// After a handshake, we should check if there's authentication data in the buffer
 			// that might not be properly parsed as a SaslAuthenticate request
-			h.tryExtractAuthData(buf, srcHost, body.Mechanism)
+			if h.detectRawSasl {
+				h.tryExtractAuthData(buf, srcHost, body.Mechanism)
+			}
 		}
+
+		h.runHooks(req)
 	}
 }
 
@@ -362,7 +1030,7 @@ func (h *KafkaStream) updateExistingTopicRelationships() {
 	if h.currentUsername == "" || h.clientAddress == "" {
 		// Try to get the username from the auth tracker if we don't have it locally
 		if h.currentUsername == "" && h.clientAddress != "" {
-			if session, found := kafka.GetAuthSession(h.clientAddress); found && session.Username != "" {
+			if session, found := h.auth.GetSession(h.clientAddress); found && session.Username != "" {
 				h.currentUsername = session.Username
 				h.currentMechanism = session.Mechanism
 			}
@@ -376,12 +1044,12 @@ func (h *KafkaStream) updateExistingTopicRelationships() {
 
 	// Set client address if not already set
 	if h.clientAddress == "" {
-		h.clientAddress = h.net.Src().String()
+		h.clientAddress = h.srcHost
 		// Setting client address
 		
 		// Try to get username immediately after setting client address
 		if h.currentUsername == "" {
-			username := kafka.GetUsernameByIP(h.clientAddress)
+			username := h.auth.GetUsernameByIP(h.clientAddress)
 			if username != "" {
 				h.currentUsername = username
 				// Associated username with client
@@ -397,7 +1065,7 @@ func (h *KafkaStream) updateExistingTopicRelationships() {
 	
 	for _, topic := range producerTopics {
 		// Updating producer topic relation
-		metrics.ProducerUserTopicInfo.WithLabelValues(h.clientAddress, h.currentUsername, topic).Set(1)
+		metrics.SetProducerUserTopic(h.clientAddress, h.currentUsername, topic)
 	}
 
 	// Get topics this client has consumed from
@@ -406,8 +1074,115 @@ func (h *KafkaStream) updateExistingTopicRelationships() {
 	
 	for _, topic := range consumerTopics {
 		// Updating consumer topic relation
-		metrics.ConsumerUserTopicInfo.WithLabelValues(h.clientAddress, h.currentUsername, topic).Set(1)
+		metrics.SetConsumerUserTopic(h.clientAddress, h.currentUsername, topic)
 	}
 
 	// Finished updating topic relationships
 }
+
+// updateExistingGroupRelationships updates existing consumer group relationships with username information.
+// It must be called after updateExistingTopicRelationships, which resolves the username.
+func (h *KafkaStream) updateExistingGroupRelationships() {
+	if h.currentUsername == "" || h.clientAddress == "" {
+		return
+	}
+
+	for _, group := range h.metricsStorage.GetClientGroups(h.clientAddress) {
+		metrics.SetUserGroup(h.clientAddress, h.currentUsername, group)
+	}
+}
+
+// trackUserGroup associates the user of the connection, if known, with a consumer group
+func (h *KafkaStream) trackUserGroup(group string) {
+	if group == "" {
+		return
+	}
+
+	if username := h.resolveUsername(); username != "" {
+		metrics.SetUserGroup(h.clientAddress, username, group)
+	}
+}
+
+// trackUserConsumerTopic sets the user_topic series of a topic consumed by the authenticated user
+func (h *KafkaStream) trackUserConsumerTopic(topic string) {
+	if username := h.resolveUsername(); username != "" {
+		metrics.SetConsumerUserTopic(h.clientAddress, username, topic)
+	}
+}
+
+// resolveUsername returns the username of the stream, looking it up in the auth tracker
+// when the stream didn't see the authentication itself
+func (h *KafkaStream) resolveUsername() string {
+	// First check if we have a username in the current stream
+	username := h.currentUsername
+
+	// If not, try to get it from the global auth tracker
+	if username == "" {
+		if baseUsername := h.auth.GetUsernameByIP(h.clientAddress); baseUsername != "" {
+			username = baseUsername
+			h.currentUsername = username
+		} else if session, found := h.auth.GetSession(h.srcHost); found && session.Username != "" {
+			username = session.Username
+			h.currentUsername = username
+			h.currentMechanism = session.Mechanism
+		}
+	}
+	return username
+}
+
+// auditAutoTopicCreation reports the topics of a metadata request allowing auto topic creation
+// that look nonexistent, having never been produced to or consumed from. The attempts are
+// counted each time, but audited once per topic and connection as clients retry them.
+func (h *KafkaStream) auditAutoTopicCreation(topics []string) {
+	for _, topic := range topics {
+		if topic == "" || h.metricsStorage.TopicSeen(topic) {
+			continue
+		}
+		metrics.AutoTopicCreateAttemptTotal.WithLabelValues(h.srcHost, topic).Inc()
+
+		if h.autoCreateAudited[topic] {
+			continue
+		}
+		if h.autoCreateAudited == nil {
+			h.autoCreateAudited = make(map[string]bool)
+		}
+		h.autoCreateAudited[topic] = true
+
+		username := h.currentUsername
+		if username == "" {
+			username = h.auth.GetUsernameByIP(h.srcHost)
+		}
+		logging.Audit("auto_topic_create_attempt", logging.Fields{
+			"client_ip": h.srcHost,
+			"username":  username,
+			"topic":     topic,
+		}, "[AUDIT] Client: %s, User: %s, Metadata request may auto-create unknown topic: %s",
+			h.srcHost, username, topic)
+	}
+}
+
+// publishRelation publishes a produce or consume relation event the first time the connection
+// produces to or consumes from a topic
+func (h *KafkaStream) publishRelation(eventType, topic, username string) {
+	key := eventType + "/" + topic
+	if h.relationsPublished[key] {
+		return
+	}
+	if h.relationsPublished == nil {
+		h.relationsPublished = make(map[string]bool)
+	}
+	h.relationsPublished[key] = true
+
+	h.publish(events.Event{Type: eventType, Username: username, Mechanism: h.currentMechanism, Topic: topic})
+}
+
+// publish sends an event about this connection to the configured sink
+func (h *KafkaStream) publish(e events.Event) {
+	if e.Time.IsZero() {
+		e.Time = h.packetTime()
+	}
+	if e.ClientIP == "" {
+		e.ClientIP = h.srcHost
+	}
+	h.events.Publish(e)
+}
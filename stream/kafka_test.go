@@ -0,0 +1,240 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// frame encodes a request of the given api key and version, with correlation id 7 and client
+// id "test", in front of the body. Only non-flexible versions are supported.
+func frame(key, version int16, body ...[]byte) []byte {
+	payload := cat(int16s(key), int16s(version), int32s(7), str("test"))
+	payload = append(payload, cat(body...)...)
+	return cat(int32s(int32(len(payload))), payload)
+}
+
+func int16s(v int16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func int32s(v int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func str(s string) []byte {
+	return append(int16s(int16(len(s))), s...)
+}
+
+func cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+// metadataRequest is a Metadata v1 request for the given topics
+func metadataRequest(topics ...string) []byte {
+	body := int32s(int32(len(topics)))
+	for _, topic := range topics {
+		body = append(body, str(topic)...)
+	}
+	return frame(3, 1, body)
+}
+
+// produceRequest is a Produce v3 request to partition 0 of a topic, without records
+func produceRequest(topic string) []byte {
+	return frame(0, 3, int16s(-1), int16s(1), int32s(1000), int32s(1), str(topic), int32s(1), int32s(0), int32s(-1))
+}
+
+// newTestFactory returns a factory with its own metrics storage
+func newTestFactory() *KafkaStreamFactory {
+	return NewKafkaStreamFactory(metrics.NewStorage(prometheus.NewRegistry(), 0), false)
+}
+
+// readRequests feeds data to a stream and returns the requests decoded
+func readRequests(f *KafkaStreamFactory, data []byte) []*kafka.Request {
+	var reqs []*kafka.Request
+	f.RegisterHook(func(req *kafka.Request, clientAddr string) {
+		reqs = append(reqs, req)
+	})
+	f.ReadStream(bytes.NewReader(data), "10.0.0.1")
+	return reqs
+}
+
+// apiKeys returns the api keys of requests
+func apiKeys(reqs []*kafka.Request) []int16 {
+	keys := make([]int16, len(reqs))
+	for i, req := range reqs {
+		keys[i] = req.Key
+	}
+	return keys
+}
+
+func TestRequestAfterMalformedBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		malformed []byte
+	}{
+		{"truncated body", frame(3, 1, int32s(5))},
+		{"invalid string length", frame(3, 1, int32s(1), int16s(-5))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := readRequests(newTestFactory(), cat(tt.malformed, metadataRequest("orders")))
+			if len(reqs) != 1 {
+				t.Fatalf("decoded %d requests, want the one following the malformed body", len(reqs))
+			}
+			body, ok := reqs[0].Body.(*kafka.MetadataRequest)
+			if !ok || len(body.Topics) != 1 || body.Topics[0] != "orders" {
+				t.Errorf("decoded %#v, want the metadata request of topic orders", reqs[0].Body)
+			}
+		})
+	}
+}
+
+func TestRequestAfterInvalidLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		invalid []byte
+	}{
+		{"negative", cat(int32s(2), int16s(3), int16s(1))},
+		{"too small", cat(int32s(6), int16s(3), int16s(1), int16s(0))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := readRequests(newTestFactory(), cat(tt.invalid, metadataRequest("orders")))
+			if len(reqs) != 1 || reqs[0].Key != 3 {
+				t.Fatalf("decoded api keys %v, want [3]", apiKeys(reqs))
+			}
+		})
+	}
+}
+
+// saslHandshake is a SaslHandshake v0 request, followed by raw SASL tokens
+func saslHandshake(mechanism string) []byte {
+	return frame(17, 0, str(mechanism))
+}
+
+func TestProduceAfterSaslHandshake(t *testing.T) {
+	reqs := readRequests(newTestFactory(), cat(saslHandshake("PLAIN"), produceRequest("orders")))
+	if len(reqs) != 2 {
+		t.Fatalf("decoded api keys %v, want [17 0]", apiKeys(reqs))
+	}
+
+	handshake, ok := reqs[0].Body.(*kafka.SaslHandshakeRequest)
+	if !ok || handshake.Mechanism != "PLAIN" {
+		t.Errorf("decoded %#v, want a PLAIN handshake", reqs[0].Body)
+	}
+	produce, ok := reqs[1].Body.(*kafka.ProduceRequest)
+	if !ok {
+		t.Fatalf("decoded %#v, want a produce request", reqs[1].Body)
+	}
+	if topics := produce.ExtractTopics(); len(topics) != 1 || topics[0] != "orders" {
+		t.Errorf("produce topics are %v, want [orders]", topics)
+	}
+}
+
+func TestRequestAfterPlainHandshake(t *testing.T) {
+	// A Metadata request starts like a PLAIN token, a null byte then "\x03" as username
+	reqs := readRequests(newTestFactory(), cat(saslHandshake("PLAIN"), metadataRequest("orders")))
+	if len(reqs) != 2 || reqs[1].Key != 3 {
+		t.Fatalf("decoded api keys %v, want [17 3]", apiKeys(reqs))
+	}
+	if body := reqs[1].Body.(*kafka.MetadataRequest); len(body.Topics) != 1 || body.Topics[0] != "orders" {
+		t.Errorf("metadata topics are %v, want [orders]", body.Topics)
+	}
+}
+
+func TestRawPlainTokenAfterHandshake(t *testing.T) {
+	token := []byte("\x00alice\x00secret")
+	data := cat(saslHandshake("PLAIN"), int32s(int32(len(token))), token, metadataRequest("orders"))
+
+	f := newTestFactory()
+	tracker := kafka.NewAuthTracker()
+	f.SetAuthTracker(tracker)
+	reqs := readRequests(f, data)
+	if len(reqs) != 2 || reqs[1].Key != 3 {
+		t.Fatalf("decoded api keys %v, want [17 3], the token isn't a request", apiKeys(reqs))
+	}
+	if username := tracker.GetUsernameByIP("10.0.0.1"); username != "alice" {
+		t.Errorf("username is %q, want alice from the raw token", username)
+	}
+}
+
+func TestIndependentFactories(t *testing.T) {
+	token := []byte("\x00alice\x00secret")
+	data := cat(saslHandshake("PLAIN"), int32s(int32(len(token))), token, offsetCommitRequest("group", "orders"))
+
+	first, firstStorage := newIsolatedFactory()
+	second, secondStorage := newIsolatedFactory()
+	readRequests(first, data)
+
+	if username := firstStorage.GetUsernameForClient("10.0.0.1"); username != "alice" {
+		t.Errorf("username in the storage of the first factory is %q, want alice", username)
+	}
+	if topics := firstStorage.GetClientConsumerTopics("10.0.0.1"); !contains(topics, "orders") {
+		t.Errorf("consumer topics of the first factory are %v, want orders", topics)
+	}
+	if username := second.auth.GetUsernameByIP("10.0.0.1"); username != "" {
+		t.Errorf("tracker of the second factory has username %q", username)
+	}
+	if username := secondStorage.GetUsernameForClient("10.0.0.1"); username != "" {
+		t.Errorf("storage of the second factory has username %q", username)
+	}
+	if topics := secondStorage.GetClientConsumerTopics("10.0.0.1"); len(topics) != 0 {
+		t.Errorf("storage of the second factory has consumer topics %v", topics)
+	}
+}
+
+// saslAuthenticate is a SaslAuthenticate v0 request carrying a SASL token
+func saslAuthenticate(token string) []byte {
+	return frame(36, 0, int32s(int32(len(token))), []byte(token))
+}
+
+func TestScramMechanismFromHandshake(t *testing.T) {
+	for _, mechanism := range []string{"SCRAM-SHA-256", "SCRAM-SHA-512"} {
+		t.Run(mechanism, func(t *testing.T) {
+			f, storage := newIsolatedFactory()
+			reqs := readRequests(f, cat(saslHandshake(mechanism), saslAuthenticate("n,,n=alice,r=1xgc3xmeb6ccthlbyduvm84vmb")))
+			if len(reqs) != 2 {
+				t.Fatalf("decoded api keys %v, want [17 36]", apiKeys(reqs))
+			}
+
+			auth, ok := reqs[1].Body.(*kafka.SaslAuthenticateRequest)
+			if !ok || auth.Mechanism != mechanism || auth.Username != "alice" {
+				t.Errorf("decoded %#v, want the %s client-first message of alice", reqs[1].Body, mechanism)
+			}
+			if got := storage.GetAuthMechanismForClient("10.0.0.1"); got != mechanism {
+				t.Errorf("mechanism in the storage is %q, want %s", got, mechanism)
+			}
+		})
+	}
+}
+
+func TestMaxApiKeySeenIgnoresGarbageHeaders(t *testing.T) {
+	f := newTestFactory()
+
+	// A misframed stream's key, then a plausible key with a garbage version
+	readRequests(f, flexibleFrame(30000, 0))
+	readRequests(f, flexibleFrame(250, 9999))
+	if v := testutil.ToFloat64(metrics.MaxApiKeySeen); v >= 250 {
+		t.Errorf("max api key seen is %v after garbage headers", v)
+	}
+
+	// An api key newer than the sniffer
+	readRequests(f, flexibleFrame(200, 0))
+	if v := testutil.ToFloat64(metrics.MaxApiKeySeen); v != 200 {
+		t.Errorf("max api key seen is %v, want 200", v)
+	}
+}
@@ -0,0 +1,17 @@
+package stream
+
+// SetLabelIncludePort labels the per-connection metrics (active connections, connection bytes
+// and request counts) with the client ip:port instead of the ip, telling apart the connections
+// of a host. Every connection then gets its own series, which raises the cardinality. Usernames
+// are still correlated by ip.
+func (h *KafkaStreamFactory) SetLabelIncludePort(include bool) {
+	h.includePort = include
+}
+
+// clientLabel returns the client label of the per-connection metrics
+func (h *KafkaStream) clientLabel() string {
+	if h.includePort {
+		return h.srcHost + ":" + h.srcPort
+	}
+	return h.srcHost
+}
@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// pendingRequestTimeout is how long a request waits for its response. Requests whose
+// response was not captured (or never sent) are forgotten after it.
+const pendingRequestTimeout = 2 * time.Minute
+
+// pendingRequest is a request waiting for its response
+type pendingRequest struct {
+	apiName string
+	at      time.Time
+}
+
+// latencyTracker matches responses with the requests of the same connection by
+// correlation id and observes the round-trip time. Requests and responses of a
+// connection are read by two different streams, hence the lock.
+type latencyTracker struct {
+	mu          sync.Mutex
+	connections map[string]map[int32]pendingRequest
+	lastSweep   time.Time
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{connections: make(map[string]map[int32]pendingRequest)}
+}
+
+// connectionKey identifies a connection the same way from both of its directions
+func connectionKey(clientHost, clientPort, brokerHost, brokerPort string) string {
+	return clientHost + ":" + clientPort + "-" + brokerHost + ":" + brokerPort
+}
+
+// request registers a request expecting a response
+func (t *latencyTracker) request(conn string, correlationID int32, apiName string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending, ok := t.connections[conn]
+	if !ok {
+		pending = make(map[int32]pendingRequest)
+		t.connections[conn] = pending
+	}
+	pending[correlationID] = pendingRequest{apiName: apiName, at: at}
+
+	t.sweep(at)
+}
+
+// response observes the latency of the request matching a response
+func (t *latencyTracker) response(conn string, correlationID int32, at time.Time) {
+	t.mu.Lock()
+	req, ok := t.connections[conn][correlationID]
+	if ok {
+		delete(t.connections[conn], correlationID)
+	}
+	t.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// packet times of the two directions come from different streams and may be slightly off
+	if latency := at.Sub(req.at); latency >= 0 {
+		metrics.RequestLatencySeconds.WithLabelValues(req.apiName).Observe(latency.Seconds())
+	}
+}
+
+// forget drops the pending requests of a closed connection
+func (t *latencyTracker) forget(conn string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.connections, conn)
+}
+
+// sweep drops requests older than pendingRequestTimeout, at most once per timeout.
+// Must be called with the lock held.
+func (t *latencyTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < pendingRequestTimeout {
+		return
+	}
+	t.lastSweep = now
+
+	for conn, pending := range t.connections {
+		for correlationID, req := range pending {
+			if now.Sub(req.at) > pendingRequestTimeout {
+				delete(pending, correlationID)
+			}
+		}
+		if len(pending) == 0 {
+			delete(t.connections, conn)
+		}
+	}
+}
+
+// runResponses matches the responses of a broker -> client stream with their requests
+func (h *KafkaStream) runResponses(r io.Reader) {
+	defer h.latency.forget(h.conn)
+
+	buf := bufio.NewReaderSize(r, h.bufferSize)
+
+	for {
+		resp, _, err := kafka.DecodeResponseHeader(buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		if err != nil {
+			// Response boundaries are lost (e.g. the capture started in the middle of a
+			// response), there is no way to resync. The stream must still be drained.
+			_, _ = io.Copy(ioutil.Discard, buf)
+			return
+		}
+
+		h.latency.response(h.conn, resp.CorrelationID, h.packetTime())
+	}
+}
+
+// expectsResponse reports whether the broker answers a request. Produce requests
+// with acks=0 are fire-and-forget.
+func expectsResponse(req *kafka.Request) bool {
+	if produce, ok := req.Body.(*kafka.ProduceRequest); ok {
+		return produce.RequiredAcks != kafka.NoResponse
+	}
+	return true
+}
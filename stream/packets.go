@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"io"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// packetRetryDelay is the delay before reading a packet again after a transient error
+const packetRetryDelay = 5 * time.Millisecond
+
+// PacketSource is a source of captured packets, e.g. a live capture or a capture file. Next
+// returns io.EOF after the last packet.
+type PacketSource interface {
+	Next() (gopacket.Packet, error)
+}
+
+// gopacketSource is the PacketSource of a gopacket.PacketSource
+type gopacketSource struct {
+	source *gopacket.PacketSource
+}
+
+// NewPacketSource returns the PacketSource of the packets decoded by a gopacket.PacketSource,
+// e.g. the one of a pcap handle
+func NewPacketSource(source *gopacket.PacketSource) PacketSource {
+	return gopacketSource{source: source}
+}
+
+func (s gopacketSource) Next() (gopacket.Packet, error) {
+	return s.source.NextPacket()
+}
+
+// PacketSlice is a PacketSource of the packets of a slice, e.g. crafted packets replacing a
+// capture
+type PacketSlice struct {
+	packets []gopacket.Packet
+}
+
+// NewPacketSlice returns a PacketSource of the given packets
+func NewPacketSlice(packets ...gopacket.Packet) *PacketSlice {
+	return &PacketSlice{packets: packets}
+}
+
+// Next returns the next packet of the slice
+func (s *PacketSlice) Next() (gopacket.Packet, error) {
+	if len(s.packets) == 0 {
+		return nil, io.EOF
+	}
+	packet := s.packets[0]
+	s.packets = s.packets[1:]
+	return packet, nil
+}
+
+// ReadPackets calls fn with each packet of the source, until its end. Transient errors are
+// retried as the packet channel of gopacket does, the error ending the source is returned
+// unless it's io.EOF.
+func ReadPackets(source PacketSource, fn func(gopacket.Packet)) error {
+	for {
+		packet, err := source.Next()
+		switch {
+		case err == nil:
+			fn(packet)
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF || err == io.ErrNoProgress || err == io.ErrClosedPipe ||
+			err == io.ErrShortBuffer || err == syscall.EBADF || strings.Contains(err.Error(), "use of closed file"):
+			return err
+		case err == syscall.EAGAIN:
+		default:
+			time.Sleep(packetRetryDelay)
+		}
+	}
+}
+
+// AssemblePacket hands the TCP segment of a packet to the assembler, at the capture time of
+// the packet. It returns false for packets without a TCP layer.
+func AssemblePacket(assembler *tcpassembly.Assembler, packet gopacket.Packet) bool {
+	if packet.NetworkLayer() == nil || packet.TransportLayer() == nil || packet.TransportLayer().LayerType() != layers.LayerTypeTCP {
+		return false
+	}
+
+	tcp := packet.TransportLayer().(*layers.TCP)
+	assembler.AssembleWithTimestamp(packet.NetworkLayer().NetworkFlow(), tcp, packet.Metadata().Timestamp)
+	return true
+}
@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+)
+
+// RecentRequest summarizes a decoded request
+type RecentRequest struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	ClientID string    `json:"client_id,omitempty"`
+	API      string    `json:"api"`
+	Version  int16     `json:"version"`
+	Topics   []string  `json:"topics,omitempty"`
+}
+
+// RecentRequests keeps the summaries of the last decoded requests in a ring buffer, for a
+// quick look at what just happened without Prometheus, e.g. at a client connecting briefly
+type RecentRequests struct {
+	mu       sync.Mutex
+	requests []RecentRequest
+	next     int  // index of the next write
+	full     bool // the buffer wrapped around, requests[next] is the oldest
+}
+
+// NewRecentRequests returns a ring buffer of the given number of requests
+func NewRecentRequests(size int) *RecentRequests {
+	if size < 1 {
+		size = 1
+	}
+	return &RecentRequests{requests: make([]RecentRequest, size)}
+}
+
+// Record is a RequestHook adding the request to the buffer. The summary is built before
+// taking the lock, which is only held to store it.
+func (b *RecentRequests) Record(req *kafka.Request, clientAddr string) {
+	summary := RecentRequest{
+		Time:     time.Now(),
+		Client:   clientAddr,
+		ClientID: req.ClientID,
+		API:      kafka.ApiName(req.Key),
+		Version:  req.Version,
+	}
+	if body, ok := req.Body.(interface{ ExtractTopics() []string }); ok {
+		summary.Topics = body.ExtractTopics()
+	}
+
+	b.mu.Lock()
+	b.requests[b.next] = summary
+	b.next++
+	if b.next == len(b.requests) {
+		b.next = 0
+		b.full = true
+	}
+	b.mu.Unlock()
+}
+
+// Requests returns the buffered requests, oldest first
+func (b *RecentRequests) Requests() []RecentRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append(make([]RecentRequest, 0, b.next), b.requests[:b.next]...)
+	}
+	requests := make([]RecentRequest, 0, len(b.requests))
+	requests = append(requests, b.requests[b.next:]...)
+	return append(requests, b.requests[:b.next]...)
+}
+
+// ServeHTTP serves the buffered requests as JSON, oldest first
+func (b *RecentRequests) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(b.Requests()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+const (
+	// maxHeaderValueLength bounds header values in logs, trace ids and such are much shorter
+	maxHeaderValueLength = 128
+
+	// maxHeaderRecordsLogged bounds the records logged per produce request
+	maxHeaderRecordsLogged = 100
+)
+
+// headerCapture selects the record header keys logged for produce requests
+type headerCapture struct {
+	all  bool
+	keys map[string]bool
+}
+
+// newHeaderCapture returns the capture of the given keys, "*" captures every key
+func newHeaderCapture(keys []string) *headerCapture {
+	c := &headerCapture{keys: make(map[string]bool)}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		switch key {
+		case "":
+		case "*":
+			c.all = true
+		default:
+			c.keys[key] = true
+		}
+	}
+	return c
+}
+
+func (c *headerCapture) captures(key string) bool {
+	return c.all || c.keys[key]
+}
+
+// logRecordHeaders counts the header keys of produced records and logs the captured ones
+func (h *KafkaStream) logRecordHeaders(req *kafka.ProduceRequest) {
+	logged := 0
+	for topic, records := range req.RecordHeaders() {
+		if !h.topicFilter.Allow(topic) {
+			continue
+		}
+
+		for _, headers := range records {
+			captured := make(map[string]string)
+			for _, header := range headers {
+				key := kafka.BoundString("header_key", formatHeaderValue(header.Key))
+				metrics.ProduceHeaderSeenTotal.WithLabelValues(h.srcHost, key).Inc()
+
+				if h.headerCapture.captures(key) {
+					captured[key] = formatHeaderValue(header.Value)
+				}
+			}
+
+			if len(captured) == 0 || logged >= maxHeaderRecordsLogged {
+				continue
+			}
+			logged++
+
+			fields := logging.Fields{
+				"client_ip": h.srcHost,
+				"src_port":  h.srcPort,
+				"topic":     topic,
+				"headers":   captured,
+			}
+			logging.Event("produce_headers", fields, "client %s:%s produced to topic %s with headers %s",
+				h.srcHost, h.srcPort, topic, formatHeaders(captured))
+		}
+	}
+}
+
+// formatHeaderValue returns a printable header value, bounded to maxHeaderValueLength.
+// Binary values are replaced by their length.
+func formatHeaderValue(value []byte) string {
+	if !utf8.Valid(value) {
+		return fmt.Sprintf("<binary %d bytes>", len(value))
+	}
+
+	s := string(value)
+	for _, c := range s {
+		if !unicode.IsPrint(c) {
+			return fmt.Sprintf("<binary %d bytes>", len(value))
+		}
+	}
+
+	if len(s) > maxHeaderValueLength {
+		// don't split a multi-byte character
+		cut := maxHeaderValueLength
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "..."
+	}
+	return s
+}
+
+// formatHeaders returns captured headers as sorted key=value pairs
+func formatHeaders(headers map[string]string) string {
+	pairs := make([]string, 0, len(headers))
+	for key, value := range headers {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
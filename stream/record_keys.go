@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+const (
+	// DefaultProduceKeyMaxLength is the default number of key bytes logged, partition keys
+	// such as ids fit
+	DefaultProduceKeyMaxLength = 64
+
+	// maxKeysLogged bounds the keys logged per topic of a produce request
+	maxKeysLogged = 20
+)
+
+// SetLogProduceKeys enables the logging of the keys of produced records, up to maxLength
+// bytes of each key. Record values are never logged. 0 disables it.
+func (h *KafkaStreamFactory) SetLogProduceKeys(maxLength int) {
+	h.keyMaxLength = maxLength
+}
+
+// countRecordKeys counts the records produced without a key, and logs the keys when enabled
+func (h *KafkaStream) countRecordKeys(req *kafka.ProduceRequest) {
+	for topic, keys := range req.RecordKeys() {
+		if !h.topicFilter.Allow(topic) {
+			continue
+		}
+
+		nullKeys := 0
+		for _, key := range keys {
+			if key == nil {
+				nullKeys++
+			}
+		}
+		if nullKeys > 0 {
+			metrics.ProduceNullKeyTotal.WithLabelValues(topic).Add(float64(nullKeys))
+		}
+
+		if h.keyMaxLength > 0 {
+			h.logRecordKeys(topic, keys)
+		}
+	}
+}
+
+// logRecordKeys logs the keys of the records produced to a topic, up to maxKeysLogged
+func (h *KafkaStream) logRecordKeys(topic string, keys [][]byte) {
+	logged := keys
+	if len(logged) > maxKeysLogged {
+		logged = logged[:maxKeysLogged]
+	}
+
+	formatted := make([]string, len(logged))
+	for i, key := range logged {
+		formatted[i] = formatRecordKey(key, h.keyMaxLength)
+	}
+
+	more := ""
+	if len(keys) > len(logged) {
+		more = fmt.Sprintf(" and %d more", len(keys)-len(logged))
+	}
+
+	fields := logging.Fields{
+		"client_ip": h.srcHost,
+		"src_port":  h.srcPort,
+		"topic":     topic,
+		"keys":      formatted,
+		"records":   len(keys),
+	}
+	logging.Event("produce_keys", fields, "client %s:%s produced to topic %s with keys %s%s",
+		h.srcHost, h.srcPort, topic, strings.Join(formatted, ", "), more)
+}
+
+// formatRecordKey returns a printable record key, bounded to maxLength bytes. Binary keys are
+// hex encoded with a 0x prefix, null keys are <null> and empty ones <empty>.
+func formatRecordKey(key []byte, maxLength int) string {
+	if key == nil {
+		return "<null>"
+	}
+	if len(key) == 0 {
+		return "<empty>"
+	}
+
+	truncated := len(key) > maxLength
+	if truncated {
+		key = key[:maxLength]
+	}
+
+	if printable(key, truncated) {
+		s := string(key)
+		if truncated {
+			// don't split a multi-byte character
+			for len(s) > 0 && !utf8.ValidString(s) {
+				s = s[:len(s)-1]
+			}
+			s += "..."
+		}
+		return s
+	}
+
+	s := "0x" + hex.EncodeToString(key)
+	if truncated {
+		s += "..."
+	}
+	return s
+}
+
+// printable reports whether a key is printable UTF-8 text. A truncated key may end with a
+// partial character.
+func printable(key []byte, truncated bool) bool {
+	for len(key) > 0 {
+		c, size := utf8.DecodeRune(key)
+		if c == utf8.RuneError && size <= 1 {
+			return truncated && !utf8.FullRune(key)
+		}
+		if !unicode.IsPrint(c) {
+			return false
+		}
+		key = key[size:]
+	}
+	return true
+}
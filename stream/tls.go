@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// Content types of TLS records, from change_cipher_spec to application_data
+const (
+	tlsFirstContentType = 0x14
+	tlsLastContentType  = 0x17
+)
+
+// isTLSRecord reports whether data starts with a TLS record header: content type, then a
+// major version of 3 (SSL 3.0 to TLS 1.3) and a known minor version. Application data records
+// are accepted too, as capture often starts in the middle of a connection. A Kafka request
+// starts with its size, which would have to be over 335MB to match.
+func isTLSRecord(data []byte) bool {
+	return len(data) >= 3 &&
+		data[0] >= tlsFirstContentType && data[0] <= tlsLastContentType &&
+		data[1] == 0x03 && data[2] <= 0x04
+}
+
+// skipTLS checks whether the stream starts with a TLS record. Encrypted streams can't be
+// decoded, they are reported once and drained.
+func (h *KafkaStream) skipTLS(buf *bufio.Reader) bool {
+	start, err := buf.Peek(3)
+	if err != nil || !isTLSRecord(start) {
+		return false
+	}
+
+	metrics.TLSConnectionsTotal.WithLabelValues(h.srcHost).Inc()
+	logging.Event("tls_connection", logging.Fields{
+		"client_ip":   h.srcHost,
+		"src_port":    h.srcPort,
+		"broker_ip":   h.dstHost,
+		"broker_port": h.dstPort,
+	}, "[TLS] Connection %s:%s -> %s:%s is encrypted, its requests can't be decoded",
+		h.srcHost, h.srcPort, h.dstHost, h.dstPort)
+
+	_, _ = io.Copy(ioutil.Discard, buf)
+	return true
+}
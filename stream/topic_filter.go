@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/d-ulyanov/kafka-sniffer/metrics"
+)
+
+// TopicFilter decides which topics are tracked in relation metrics and the summary log.
+// It is compiled once and only read afterwards, so streams share it without locking.
+type TopicFilter struct {
+	include []topicPattern
+	exclude []topicPattern
+}
+
+// topicPattern is either a glob (path.Match syntax) or a regexp written between slashes
+type topicPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// NewTopicFilter compiles include and exclude patterns. Patterns between slashes, e.g.
+// /^orders\.v[0-9]+$/, are regexps, anything else is a glob such as "orders.*".
+// Topics are allowed when they match an include pattern (or there is none) and no exclude pattern.
+func NewTopicFilter(include, exclude []string) (*TopicFilter, error) {
+	var (
+		f   TopicFilter
+		err error
+	)
+	if f.include, err = compileTopicPatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileTopicPatterns(exclude); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func compileTopicPatterns(patterns []string) ([]topicPattern, error) {
+	var compiled []topicPattern
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid topic regexp %s: %v", p, err)
+			}
+			compiled = append(compiled, topicPattern{re: re})
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid topic glob %s: %v", p, err)
+		}
+		compiled = append(compiled, topicPattern{glob: p})
+	}
+	return compiled, nil
+}
+
+func (p topicPattern) match(topic string) bool {
+	if p.re != nil {
+		return p.re.MatchString(topic)
+	}
+	matched, _ := path.Match(p.glob, topic)
+	return matched
+}
+
+// Allow reports whether a topic is tracked. A nil filter allows every topic.
+func (f *TopicFilter) Allow(topic string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, p := range f.exclude {
+		if p.match(topic) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.match(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackTopic reports whether the stream tracks a topic, counting the filtered ones
+func (h *KafkaStream) trackTopic(topic string) bool {
+	if h.topicFilter.Allow(topic) {
+		return true
+	}
+	metrics.FilteredTopicsTotal.Inc()
+	return false
+}
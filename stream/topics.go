@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/d-ulyanov/kafka-sniffer/kafka"
+	"github.com/d-ulyanov/kafka-sniffer/logging"
+)
+
+// auditTopicCreation writes an audit log for each topic created, or whose creation is validated,
+// by the client. Config values are only logged with kafka.CaptureConfigValues.
+func (h *KafkaStream) auditTopicCreation(req *kafka.CreateTopicsRequest) {
+	username := h.currentUsername
+	if username == "" {
+		username = h.auth.GetUsernameByIP(h.srcHost)
+	}
+
+	for _, topic := range req.Topics {
+		configs := make([]string, 0, len(topic.ConfigEntries))
+		for name, value := range topic.ConfigEntries {
+			if kafka.CaptureConfigValues {
+				configs = append(configs, name+"="+value)
+			} else {
+				configs = append(configs, name)
+			}
+		}
+		sort.Strings(configs)
+
+		logging.Audit("topic_create", logging.Fields{
+			"client_ip":          h.srcHost,
+			"username":           username,
+			"topic":              topic.Topic,
+			"partitions":         topic.NumPartitions,
+			"replication_factor": topic.ReplicationFactor,
+			"replica_assignment": len(topic.ReplicaAssignment) > 0,
+			"configs":            configs,
+			"validate_only":      req.ValidateOnly,
+		}, "[AUDIT] Client: %s, User: %s, CreateTopics topic: %s, Partitions: %s, Replication: %s, Configs: %s, Validate only: %t",
+			h.srcHost, username, topic.Topic, createTopicSetting(int64(topic.NumPartitions), len(topic.ReplicaAssignment)),
+			createTopicSetting(int64(topic.ReplicationFactor), len(topic.ReplicaAssignment)), strings.Join(configs, ", "), req.ValidateOnly)
+	}
+}
+
+// createTopicSetting formats the partition count or replication factor of a created topic,
+// -1 being the broker default, or set by the replica assignment
+func createTopicSetting(value int64, assignedPartitions int) string {
+	switch {
+	case value >= 0:
+		return fmt.Sprint(value)
+	case assignedPartitions > 0:
+		return "assigned"
+	default:
+		return "default"
+	}
+}